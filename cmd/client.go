@@ -7,6 +7,10 @@ import (
 )
 
 func main() {
-	//menu.StartMenu("http://127.0.0.1:5232", os.Stdin)       //radicale
-	menu.StartMenu("http://127.0.0.1:90/dav.php", os.Stdin) // baikal
+	//url := menu.Profiles["radicale"]
+	url := menu.Profiles["baikal"]
+	if err := menu.Run(url, os.Args[1:], os.Stdin); err != nil {
+		menu.RedLine(err)
+		os.Exit(1)
+	}
 }
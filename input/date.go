@@ -0,0 +1,410 @@
+package input
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Location is time zone of entered dates without offset, set by -timezone flag
+var Location = time.Local
+
+// Now is moment relative dates are counted from
+var Now = time.Now
+
+// DateHint is example of accepted input shown by prompts
+const DateHint = "e.g. 2024-07-01 10:00, tomorrow 10am, next fri 14:30, +2h"
+
+// absolute layouts, layouts with offset keep it and ignore location
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"20060102T150405Z",
+	"20060102T150405",
+	"20060102",
+	"2006.01.02 15.04.05",
+	"2006.01.02 15.04",
+	"2006.01.02 15:04",
+	"2006.01.02",
+}
+
+var dayLayouts = []string{"2006-01-02", "2006.01.02", "20060102"}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January,
+	"feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December,
+}
+
+var (
+	clockPattern    = regexp.MustCompile(`^(\d{1,2})(?:[:.](\d{2}))?(?:[:.](\d{2}))?(am|pm)?$`)
+	durationPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([a-z]+)`)
+)
+
+// duration units, days and weeks are calendar days so wall clock survives DST change
+var durationUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "wk": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// offset is parsed duration, days are kept apart from clock time
+type offset struct {
+	days  int
+	clock time.Duration
+}
+
+func (o offset) add(t time.Time, sign int) time.Time {
+	return t.AddDate(0, 0, sign*o.days).Add(time.Duration(sign) * o.clock)
+}
+
+func parseOffset(s string) (offset, error) {
+	var o offset
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "for "))
+	if rest == "" {
+		return o, fmt.Errorf("empty duration")
+	}
+	for rest != "" {
+		m := durationPattern.FindStringSubmatch(rest)
+		if m == nil {
+			return o, fmt.Errorf("invalid duration %q", s)
+		}
+		unit, ok := durationUnits[m[2]]
+		if !ok {
+			return o, fmt.Errorf("unknown unit %q in %q", m[2], s)
+		}
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return o, err
+		}
+		if unit >= 24*time.Hour && n == float64(int(n)) {
+			o.days += int(n) * int(unit/(24*time.Hour))
+		} else {
+			o.clock += time.Duration(n * float64(unit))
+		}
+		rest = strings.TrimSpace(rest[len(m[0]):])
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "and "))
+	}
+	return o, nil
+}
+
+// ParseDuration parses durations such as 45m, 1h30m, 1.5h, 2 hours, 1 day,
+// optionally after "for"
+func ParseDuration(s string) (time.Duration, error) {
+	o, err := parseOffset(s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(o.days)*24*time.Hour + o.clock, nil
+}
+
+// ParseClock parses time of day (9, 9am, 9:30pm, 14:30, 14.30, noon, midnight)
+// and returns time since midnight
+func ParseClock(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	switch s {
+	case "noon":
+		return 12 * time.Hour, nil
+	case "midnight":
+		return 0, nil
+	}
+	m := clockPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi("0" + m[2])
+	second, _ := strconv.Atoi("0" + m[3])
+	switch m[4] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, fmt.Errorf("invalid hour in %q", s)
+		}
+		hour %= 12
+		if m[4] == "pm" {
+			hour += 12
+		}
+	case "":
+		// bare number is hour only with minutes or as 0..23
+		if hour > 23 {
+			return 0, fmt.Errorf("invalid hour in %q", s)
+		}
+	}
+	if minute > 59 || second > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second, nil
+}
+
+// ParseDate parses date and time in loc relative to now. Accepted are
+//
+//	ISO 8601 and YYYY.MM.DD HH.MM.SS: 2024-07-01, 2024-07-01T10:00, 2024-07-01T10:00:00+03:00
+//	days: today, tomorrow, yesterday, mon..sun, next fri, last fri, jul 1, 1 july 2025
+//	times: 10am, 2:30pm, 14:30, noon, midnight, alone or after day ("tomorrow 10am")
+//	offsets from now: now, +2h, -30m, in 3 days
+//
+// Weekday alone is the nearest such day from today on, "next" skips today and
+// "last" looks back. Day without time is its midnight, time without day is today.
+func ParseDate(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	return parseDate(s, now.In(loc), now.In(loc), loc)
+}
+
+// parseDate takes day of time without day from base, everything else is relative to now
+func parseDate(s string, now, base time.Time, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+	for _, layout := range dateLayouts {
+		layoutLoc := loc
+		if strings.HasSuffix(layout, "Z") {
+			layoutLoc = time.UTC
+		}
+		if t, err := time.ParseInLocation(layout, strings.ToUpper(s), layoutLoc); err == nil {
+			return t, nil
+		}
+	}
+	lower := strings.ToLower(s)
+	switch {
+	case lower == "now":
+		return now, nil
+	case strings.HasPrefix(lower, "+"), strings.HasPrefix(lower, "in "):
+		o, err := parseOffset(strings.TrimPrefix(strings.TrimPrefix(lower, "+"), "in "))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return o.add(now, 1), nil
+	case strings.HasPrefix(lower, "-"):
+		o, err := parseOffset(lower[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return o.add(now, -1), nil
+	}
+
+	var day time.Time
+	var clock time.Duration
+	hasDay, hasClock := false, false
+	setDay := func(t time.Time) error {
+		if hasDay {
+			return fmt.Errorf("two days in %q", s)
+		}
+		day, hasDay = t, true
+		return nil
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	tokens := strings.Fields(lower)
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		next := ""
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		var err error
+		switch {
+		case token == "at" || token == "on":
+			continue
+		case token == "today":
+			err = setDay(today)
+		case token == "tomorrow":
+			err = setDay(today.AddDate(0, 0, 1))
+		case token == "yesterday":
+			err = setDay(today.AddDate(0, 0, -1))
+		case token == "this" || token == "next" || token == "last":
+			wd, ok := weekdays[next]
+			if !ok {
+				return time.Time{}, fmt.Errorf("%q must be followed by weekday in %q", token, s)
+			}
+			err = setDay(weekday(today, wd, token))
+			i++
+		case weekdays[token] != 0 || token == "sun" || token == "sunday":
+			err = setDay(weekday(today, weekdays[token], ""))
+		case months[token] != 0:
+			// jul 1 [2025]
+			var t time.Time
+			t, i, err = monthDay(tokens, i+1, months[token], today, loc)
+			if err == nil {
+				err = setDay(t)
+			}
+		case months[next] != 0 && isNumber(token):
+			// 1 jul [2025]
+			var t time.Time
+			t, i, err = monthDay(tokens, i, months[next], today, loc)
+			if err == nil {
+				err = setDay(t)
+			}
+		case isDay(token, loc):
+			t, _ := parseDay(token, loc)
+			err = setDay(t)
+		default:
+			// "10 am" is written with space
+			if next == "am" || next == "pm" {
+				token += next
+				i++
+			}
+			if hasClock {
+				return time.Time{}, fmt.Errorf("two times in %q", s)
+			}
+			if clock, err = ParseClock(token); err != nil {
+				return time.Time{}, fmt.Errorf("can't understand %q in %q", token, s)
+			}
+			hasClock = true
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	if !hasDay {
+		day = base
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc).Add(clock), nil
+}
+
+func weekday(today time.Time, wd time.Weekday, modifier string) time.Time {
+	diff := (int(wd) - int(today.Weekday()) + 7) % 7
+	switch modifier {
+	case "next":
+		if diff == 0 {
+			diff = 7
+		}
+	case "last":
+		diff -= 7
+	}
+	return today.AddDate(0, 0, diff)
+}
+
+// monthDay reads day and optional year from tokens[i:], returns index of last used token
+func monthDay(tokens []string, i int, month time.Month, today time.Time, loc *time.Location) (time.Time, int, error) {
+	if i >= len(tokens) || !isNumber(tokens[i]) {
+		return time.Time{}, i, fmt.Errorf("day of month missing after %s", month)
+	}
+	day, _ := strconv.Atoi(tokens[i])
+	if i+1 < len(tokens) && months[tokens[i+1]] == month {
+		// day came before month
+		i++
+	}
+	year := today.Year()
+	if i+1 < len(tokens) && len(tokens[i+1]) == 4 && isNumber(tokens[i+1]) {
+		year, _ = strconv.Atoi(tokens[i+1])
+		i++
+	}
+	t := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	if t.Day() != day {
+		return time.Time{}, i, fmt.Errorf("%s has no day %d", month, day)
+	}
+	return t, i, nil
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+func parseDay(s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range dayLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+func isDay(s string, loc *time.Location) bool {
+	_, err := parseDay(s, loc)
+	return err == nil
+}
+
+// ParseEnd parses end of period that starts at start: duration after it
+// ("for 45m", "+1h", "90m") or date where time alone is on day of start.
+// End time of day before start is taken on the next day.
+func ParseEnd(s string, start, now time.Time, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	if strings.HasPrefix(lower, "for ") || strings.HasPrefix(lower, "+") {
+		o, err := parseOffset(strings.TrimPrefix(lower, "+"))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return o.add(start, 1), nil
+	}
+	end, err := parseDate(s, now.In(loc), start.In(loc), loc)
+	if err != nil {
+		// bare duration such as 45m
+		if o, derr := parseOffset(lower); derr == nil {
+			return o.add(start, 1), nil
+		}
+		return time.Time{}, err
+	}
+	if end.Before(start) && onlyClock(lower) {
+		end = end.AddDate(0, 0, 1)
+	}
+	if end.Before(start) {
+		return time.Time{}, fmt.Errorf("end %s is before start %s", end.Format(time.DateTime), start.Format(time.DateTime))
+	}
+	return end, nil
+}
+
+func onlyClock(s string) bool {
+	_, err := ParseClock(strings.TrimPrefix(s, "at "))
+	return err == nil || s == "noon" || s == "midnight"
+}
+
+// Date asks until answer is understood by ParseDate, empty answer is an error
+func Date(r io.Reader, message string) (time.Time, error) {
+	for {
+		str, err := String(r, message+" ("+DateHint+"): ")
+		if err != nil {
+			return time.Time{}, err
+		}
+		t, err := ParseDate(str, Now(), Location)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		return t, nil
+	}
+}
+
+// End asks for end of period as date or as duration after start
+func End(r io.Reader, message string, start time.Time) (time.Time, error) {
+	for {
+		str, err := String(r, message+" (e.g. 11:00, for 45m, tomorrow 9am): ")
+		if err != nil {
+			return time.Time{}, err
+		}
+		t, err := ParseEnd(str, start, Now(), Location)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		return t, nil
+	}
+}
@@ -0,0 +1,286 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testZone = time.FixedZone("UTC+3", 3*60*60)
+	// Wednesday
+	testNow = time.Date(2024, 7, 3, 15, 20, 0, 0, testZone)
+)
+
+func day(month time.Month, d, hour, min int) time.Time {
+	return time.Date(2024, month, d, hour, min, 0, 0, testZone)
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		// absolute
+		{"2024-07-01", day(7, 1, 0, 0)},
+		{"2024-07-01T10:00", day(7, 1, 10, 0)},
+		{"2024-07-01t10:00", day(7, 1, 10, 0)},
+		{"2024-07-01T10:00:30", day(7, 1, 10, 0).Add(30 * time.Second)},
+		{"2024-07-01 10:00", day(7, 1, 10, 0)},
+		{"2024-07-01T10:00:00Z", day(7, 1, 13, 0)},
+		{"2024-07-01T10:00:00+01:00", day(7, 1, 12, 0)},
+		{"20240701T100000Z", day(7, 1, 13, 0)},
+		{"20240701T100000", day(7, 1, 10, 0)},
+		{"20240701", day(7, 1, 0, 0)},
+		{"2024.07.01", day(7, 1, 0, 0)},
+		{"2024.07.01 10.00.00", day(7, 1, 10, 0)},
+		{"2024.07.01 10.00", day(7, 1, 10, 0)},
+		{"2024-07-01 3pm", day(7, 1, 15, 0)},
+		{"  2024-07-01  ", day(7, 1, 0, 0)},
+		// days
+		{"today", day(7, 3, 0, 0)},
+		{"tomorrow", day(7, 4, 0, 0)},
+		{"yesterday", day(7, 2, 0, 0)},
+		{"Tomorrow 10am", day(7, 4, 10, 0)},
+		{"tomorrow at 10:30", day(7, 4, 10, 30)},
+		{"wed", day(7, 3, 0, 0)},
+		{"this wed", day(7, 3, 0, 0)},
+		{"next wed", day(7, 10, 0, 0)},
+		{"last wed", day(6, 26, 0, 0)},
+		{"fri", day(7, 5, 0, 0)},
+		{"friday 9am", day(7, 5, 9, 0)},
+		{"next fri 14:30", day(7, 5, 14, 30)},
+		{"last fri", day(6, 28, 0, 0)},
+		{"sun", day(7, 7, 0, 0)},
+		{"next sunday noon", day(7, 7, 12, 0)},
+		{"mon", day(7, 8, 0, 0)},
+		{"on tue 8 am", day(7, 9, 8, 0)},
+		{"jul 10", day(7, 10, 0, 0)},
+		{"10 jul 2pm", day(7, 10, 14, 0)},
+		{"december 31 2025", time.Date(2025, 12, 31, 0, 0, 0, 0, testZone)},
+		{"1 jan 2025 9:15", time.Date(2025, 1, 1, 9, 15, 0, 0, testZone)},
+		// times of today
+		{"10am", day(7, 3, 10, 0)},
+		{"10 am", day(7, 3, 10, 0)},
+		{"12am", day(7, 3, 0, 0)},
+		{"12pm", day(7, 3, 12, 0)},
+		{"2:30pm", day(7, 3, 14, 30)},
+		{"14:30", day(7, 3, 14, 30)},
+		{"14.30", day(7, 3, 14, 30)},
+		{"9", day(7, 3, 9, 0)},
+		{"23:59:59", day(7, 3, 23, 59).Add(59 * time.Second)},
+		{"noon", day(7, 3, 12, 0)},
+		{"midnight", day(7, 3, 0, 0)},
+		{"10am tomorrow", day(7, 4, 10, 0)},
+		// offsets
+		{"now", testNow},
+		{"+2h", day(7, 3, 17, 20)},
+		{"+90m", day(7, 3, 16, 50)},
+		{"+1h30m", day(7, 3, 16, 50)},
+		{"-30m", day(7, 3, 14, 50)},
+		{"+3d", day(7, 6, 15, 20)},
+		{"+1w", day(7, 10, 15, 20)},
+		{"-1w", day(6, 26, 15, 20)},
+		{"in 2 days", day(7, 5, 15, 20)},
+		{"in 1 hour and 15 minutes", day(7, 3, 16, 35)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDate(tt.in, testNow, testZone)
+			if assert.NoError(t, err) {
+				assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseDateErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"   ",
+		"someday",
+		"2024-13-01",
+		"2024-02-30",
+		"25:00",
+		"10:61",
+		"13pm",
+		"0am",
+		"next",
+		"next week",
+		"feb 30",
+		"jul",
+		"tomorrow today",
+		"10am 11am",
+		"+",
+		"+2x",
+		"in soon",
+	} {
+		t.Run(in, func(t *testing.T) {
+			_, err := ParseDate(in, testNow, testZone)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseDateLocation(t *testing.T) {
+	// now is converted to location, so "today" is day there
+	utc := time.Date(2024, 7, 3, 22, 0, 0, 0, time.UTC)
+	got, err := ParseDate("today 9am", utc, testZone)
+	assert.NoError(t, err)
+	assert.Equal(t, day(7, 4, 9, 0), got)
+	assert.Equal(t, testZone, got.Location())
+
+	got, err = ParseDate("2024-07-01 10:00", utc, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC), got)
+}
+
+func TestParseDateDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	// clocks go forward on 2024-03-31, days keep wall clock, hours don't
+	now := time.Date(2024, 3, 30, 12, 0, 0, 0, loc)
+	got, err := ParseDate("+1d", now, loc)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 31, 12, 0, 0, 0, loc), got)
+	got, err = ParseDate("+24h", now, loc)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 31, 13, 0, 0, 0, loc), got)
+}
+
+func TestParseEnd(t *testing.T) {
+	start := day(7, 4, 10, 0)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"for 45m", day(7, 4, 10, 45)},
+		{"for 1h30m", day(7, 4, 11, 30)},
+		{"for 1.5 hours", day(7, 4, 11, 30)},
+		{"for 2 days", day(7, 6, 10, 0)},
+		{"+45m", day(7, 4, 10, 45)},
+		{"45m", day(7, 4, 10, 45)},
+		{"90 minutes", day(7, 4, 11, 30)},
+		{"11:00", day(7, 4, 11, 0)},
+		{"2pm", day(7, 4, 14, 0)},
+		{"9am", day(7, 5, 9, 0)},
+		{"midnight", day(7, 5, 0, 0)},
+		{"10:00", day(7, 4, 10, 0)},
+		{"fri 9am", day(7, 5, 9, 0)},
+		{"2024-07-10 18:00", day(7, 10, 18, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseEnd(tt.in, start, testNow, testZone)
+			if assert.NoError(t, err) {
+				assert.True(t, tt.want.Equal(got), "want %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	for _, in := range []string{"", "for", "for ever", "2024-07-01", "yesterday 11:00"} {
+		t.Run("error "+in, func(t *testing.T) {
+			_, err := ParseEnd(in, start, testNow, testZone)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"45m", 45 * time.Minute},
+		{"for 45m", 45 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"1h 30m", 90 * time.Minute},
+		{"1.5h", 90 * time.Minute},
+		{"2 hours", 2 * time.Hour},
+		{"1 hour and 15 minutes", 75 * time.Minute},
+		{"30s", 30 * time.Second},
+		{"1d", 24 * time.Hour},
+		{"2 weeks", 14 * 24 * time.Hour},
+		{"FOR 10 MIN", 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDuration(tt.in)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	for _, in := range []string{"", "45", "m", "2 fortnights", "1h foo", "-1h"} {
+		t.Run("error "+in, func(t *testing.T) {
+			_, err := ParseDuration(in)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"9", 9 * time.Hour},
+		{"09:00", 9 * time.Hour},
+		{"9am", 9 * time.Hour},
+		{"9 AM", 9 * time.Hour},
+		{"9.30", 9*time.Hour + 30*time.Minute},
+		{"6pm", 18 * time.Hour},
+		{"6:15pm", 18*time.Hour + 15*time.Minute},
+		{"18:00", 18 * time.Hour},
+		{"noon", 12 * time.Hour},
+		{"midnight", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseClock(tt.in)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	for _, in := range []string{"", "24", "9:60", "13am", "9:5", "nine"} {
+		t.Run("error "+in, func(t *testing.T) {
+			_, err := ParseClock(in)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDatePrompts(t *testing.T) {
+	Now = func() time.Time { return testNow }
+	Location = testZone
+	defer func() { Now, Location = time.Now, time.Local }()
+
+	// wrong answer is asked again
+	r := bufio.NewReader(bytes.NewBufferString("someday\ntomorrow 10am\nfor 45m\n"))
+	start, err := Date(r, "start")
+	assert.NoError(t, err)
+	assert.Equal(t, day(7, 4, 10, 0), start)
+	end, err := End(r, "end", start)
+	assert.NoError(t, err)
+	assert.Equal(t, day(7, 4, 10, 45), end)
+
+	_, err = Date(bytes.NewBufferString(""), "start")
+	assert.Error(t, err)
+}
+
+func TestEventUTC(t *testing.T) {
+	Now = func() time.Time { return testNow }
+	Location = testZone
+	defer func() { Now, Location = time.Now, time.Local }()
+
+	r := bufio.NewReader(bytes.NewBufferString("Review\nevent\ntomorrow 10am\nfor 45m\n0\nn\n"))
+	event, err := Event(r)
+	assert.NoError(t, err)
+	assert.Equal(t, time.UTC, event.DateTimeStart.Location())
+	assert.True(t, day(7, 4, 10, 0).Equal(event.DateTimeStart))
+	assert.True(t, day(7, 4, 10, 45).Equal(event.DateTimeEnd))
+}
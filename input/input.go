@@ -2,8 +2,10 @@ package input
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -13,8 +15,23 @@ import (
 	"github.com/trvita/go-ical"
 )
 
+var fileReaders = make(map[*os.File]*bufio.Reader)
+
+// Buffered returns reader for prompts, files such as stdin get one shared reader
+// because separate bufio readers swallow input buffered by each other
+func Buffered(r io.Reader) *bufio.Reader {
+	f, ok := r.(*os.File)
+	if !ok {
+		return bufio.NewReader(r)
+	}
+	if fileReaders[f] == nil {
+		fileReaders[f] = bufio.NewReader(f)
+	}
+	return fileReaders[f]
+}
+
 func String(r io.Reader, message string) (string, error) {
-	reader := bufio.NewReader(r)
+	reader := Buffered(r)
 	if r == r {
 		fmt.Print(message)
 	}
@@ -32,20 +49,16 @@ func Commands(comms string) []string {
 }
 
 func Int(r io.Reader, message string) (int, error) {
-	var num int
-	reader := bufio.NewReader(r)
-	if r == r {
-		fmt.Print(message)
-	}
-	_, err := fmt.Fscanf(reader, "%d\n", &num)
+	str, err := String(r, message)
 	if err != nil {
 		return 0, err
 	}
-	return num, nil
+	// whole line is read, so wrong input doesn't stay for next prompt
+	return strconv.Atoi(str)
 }
 
 func Ints(r io.Reader, message string) ([]int, error) {
-	reader := bufio.NewReader(r)
+	reader := Buffered(r)
 	if r == r {
 		fmt.Print(message)
 	}
@@ -75,7 +88,7 @@ func Ints(r io.Reader, message string) ([]int, error) {
 
 func Event(r io.Reader) (*mycal.Event, error) {
 	var attendees []string
-	var summary, organizer, name, startDate, startTime, endDate, endTime, action, trigger string
+	var summary, organizer, name, action, trigger string
 	var startDateTime, endDateTime time.Time
 
 	uid, err := uuid.NewUUID()
@@ -101,38 +114,16 @@ func Event(r io.Reader) (*mycal.Event, error) {
 			break
 		}
 	}
-	for {
-		startDate, err = String(r, "Enter event start date (YYYY.MM.DD): ")
-		if err != nil {
-			return nil, err
-		}
-		startTime, err = String(r, "Enter event start time (HH.MM.SS): ")
-		if err != nil {
-			return nil, err
-		}
-		startDateTime, err = time.Parse("2006.01.02 15.04.05", startDate+" "+startTime)
-		if err != nil {
-			fmt.Println("invalid start date/time format")
-			continue
-		}
-		break
+	startDateTime, err = Date(r, "Enter event start")
+	if err != nil {
+		return nil, err
 	}
-	for {
-		endDate, err = String(r, "Enter event end date (YYYY.MM.DD): ")
-		if err != nil {
-			return nil, err
-		}
-		endTime, err = String(r, "Enter event end time (HH.MM.SS): ")
-		if err != nil {
-			return nil, err
-		}
-		endDateTime, err = time.Parse("2006.01.02 15.04.05", endDate+" "+endTime)
-		if err != nil {
-			fmt.Println("invalid end date/time format")
-			continue
-		}
-		break
+	endDateTime, err = End(r, "Enter event end or duration", startDateTime)
+	if err != nil {
+		return nil, err
 	}
+	// dates are entered in Location, but stored as UTC since no VTIMEZONE goes with them
+	startDateTime, endDateTime = startDateTime.UTC(), endDateTime.UTC()
 	for {
 		attendee, err := String(r, "Enter attendee email (or 0 to finish): ")
 		if err != nil {
@@ -197,7 +188,7 @@ func Event(r io.Reader) (*mycal.Event, error) {
 func RecurrentEvent(r io.Reader) (*mycal.ReccurentEvent, error) {
 	var attendees []string
 	var byDay, byMonthDay, byYearDay, byMonth, byWeekNo, bySetPos, byHour []int
-	var summary, name, startDate, startTime, freq, untilDate, untilTime, organizer string
+	var summary, name, freq, organizer string
 	var startDateTime, untilDateTime time.Time
 	var frequency, interval, count, ans int
 	name = "VEVENT"
@@ -209,23 +200,11 @@ func RecurrentEvent(r io.Reader) (*mycal.ReccurentEvent, error) {
 	if err != nil {
 		return nil, err
 	}
-	for {
-		startDate, err = String(r, "Enter event start date (YYYY.MM.DD): ")
-		if err != nil {
-			return nil, err
-		}
-		startTime, err = String(r, "Enter event start time (HH.MM.SS): ")
-		if err != nil {
-			return nil, err
-		}
-
-		startDateTime, err = time.Parse("2006.01.02 15.04.05", startDate+" "+startTime)
-		if err != nil {
-			fmt.Println("invalid start date/time format")
-			continue
-		}
-		break
+	startDateTime, err = Date(r, "Enter event start")
+	if err != nil {
+		return nil, err
 	}
+	startDateTime = startDateTime.UTC()
 	cont := true
 	for cont {
 		freq, err = String(r, "Enter frequency [Y, MO, W, D, H, MI, S]: ")
@@ -271,23 +250,11 @@ func RecurrentEvent(r io.Reader) (*mycal.ReccurentEvent, error) {
 			return nil, err
 		}
 	case 2:
-		for {
-			untilDate, err = String(r, "Enter event start date (YYYY.MM.DD): ")
-			if err != nil {
-				return nil, err
-			}
-			untilTime, err = String(r, "Enter event start time (HH.MM.SS): ")
-			if err != nil {
-				return nil, err
-			}
-
-			untilDateTime, err = time.Parse("2006.01.02 15.04.05", untilDate+" "+untilTime)
-			if err != nil {
-				fmt.Println("invalid start date/time format")
-				continue
-			}
-			break
+		untilDateTime, err = End(r, "Enter repeat until", startDateTime.In(Location))
+		if err != nil {
+			return nil, err
 		}
+		untilDateTime = untilDateTime.UTC()
 	}
 
 	byDay, err = Ints(r, "Enter by days [num of day in week, num of day in year]: ")
@@ -358,44 +325,172 @@ func RecurrentEvent(r io.Reader) (*mycal.ReccurentEvent, error) {
 		ByHour:     byHour}, nil
 }
 
-func Modifications(r io.Reader) (*mycal.Modifications, error) {
-	var partstat, delegateto, calendarName, email, answer string
+// ErrUnknownAnswer means answer to invitation is none of y, t, n, d
+var ErrUnknownAnswer = errors.New("unknown answer")
+
+func Modifications(r io.Reader, email, answer string) (*mycal.Modifications, error) {
+	var partstat, delegateto string
 	var err error
 
-	email, err = String(r, "Enter your email: ")
-	if err != nil {
-		return nil, err
-	}
-	fmt.Println("-1")
-	answer, err = String(r, "Accept, decline, delegate event? [y, n, d]: ")
-	if err != nil {
-		return nil, err
-	}
-	fmt.Println("0")
 	switch answer {
 	case "y":
-		fmt.Println("1")
 		partstat = "ACCEPTED"
-		calendarName, err = String(r, "Enter which calendar event goes to: ")
-		if err != nil {
-			return nil, err
-		}
+	case "t":
+		partstat = "TENTATIVE"
 	case "d":
-		partstat = string(ical.ParamDelegatedTo)
+		partstat = "DELEGATED"
 		delegateto, err = String(r, "Enter who to delegate: ")
 		if err != nil {
 			return nil, err
 		}
-	default:
-		fmt.Println("2")
+	case "n":
 		partstat = "DECLINED"
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownAnswer, answer)
+	}
+	calendarName, err := String(r, "Enter which calendar event goes to: ")
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println("3")
 	return &mycal.Modifications{
 		Email:        email,
 		PartStat:     partstat,
-		DelegateTo:   "mailto:" + delegateto,
+		DelegateTo:   delegateto,
 		CalendarName: calendarName,
 		LastModified: time.Now(),
 	}, nil
 }
+
+func Counter(r io.Reader) (time.Time, time.Time, string, error) {
+	start, err := Date(r, "Enter proposed start")
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	end, err := End(r, "Enter proposed end or duration", start)
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	comment, err := String(r, "Enter comment for organizer: ")
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	return start.UTC(), end.UTC(), comment, nil
+}
+
+func Meeting(r io.Reader) (*mycal.MeetingRequest, error) {
+	var attendees []string
+	var from, to time.Time
+	var workStart, workEnd time.Duration
+	var loc *time.Location
+
+	summary, err := String(r, "Enter meeting summary: ")
+	if err != nil {
+		return nil, err
+	}
+	organizer, err := String(r, "Enter organizer email: ")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		attendee, err := String(r, "Enter attendee email (or 0 to finish): ")
+		if err != nil {
+			return nil, err
+		}
+		if attendee == "0" {
+			break
+		}
+		attendees = append(attendees, attendee)
+	}
+	for {
+		tz, err := String(r, "Enter time zone (empty for configured): ")
+		if err != nil {
+			return nil, err
+		}
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			fmt.Println("unknown time zone")
+			continue
+		}
+		if tz == "" {
+			loc = Location
+		}
+		break
+	}
+	var duration time.Duration
+	for {
+		str, err := String(r, "Enter duration (e.g. 45m, 1h30m): ")
+		if err != nil {
+			return nil, err
+		}
+		// plain number is minutes as before
+		if minutes, err := strconv.Atoi(str); err == nil {
+			str = strconv.Itoa(minutes) + "m"
+		}
+		if duration, err = ParseDuration(str); err != nil || duration <= 0 {
+			fmt.Println("invalid duration")
+			continue
+		}
+		break
+	}
+	for {
+		fromDate, err := String(r, "Enter first day to search (e.g. today, 2024-07-01, next mon): ")
+		if err != nil {
+			return nil, err
+		}
+		toDate, err := String(r, "Enter last day to search (e.g. fri, +1w): ")
+		if err != nil {
+			return nil, err
+		}
+		now := Now()
+		from, err = ParseDate(fromDate, now, loc)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		to, err = ParseDate(toDate, now, loc)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+		to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+		break
+	}
+	for {
+		startTime, err := String(r, "Enter working hours start (e.g. 9am, 09:00): ")
+		if err != nil {
+			return nil, err
+		}
+		endTime, err := String(r, "Enter working hours end (e.g. 6pm, 18:00): ")
+		if err != nil {
+			return nil, err
+		}
+		if workStart, err = ParseClock(startTime); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if workEnd, err = ParseClock(endTime); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		break
+	}
+	count, err := Int(r, "Enter number of slots to offer: ")
+	if err != nil {
+		return nil, err
+	}
+	return &mycal.MeetingRequest{
+		Summary:   summary,
+		Organizer: organizer,
+		Attendees: attendees,
+		Options: mycal.SlotOptions{
+			Duration:  duration,
+			From:      from,
+			To:        to,
+			WorkStart: workStart,
+			WorkEnd:   workEnd,
+			Location:  loc,
+			Count:     count,
+		},
+	}, nil
+}
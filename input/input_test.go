@@ -82,3 +82,14 @@ func TetIntsFail(t *testing.T) {
 }
 
 // testing Event is a problem since first call of String s all input and others just  eof
+
+func TestModifications(t *testing.T) {
+	mods, err := Modifications(bytes.NewBufferString("work\n"), "some-mail@mail.com", "n")
+	assert.NoError(t, err)
+	assert.Equal(t, "DECLINED", mods.PartStat)
+	assert.Equal(t, "work", mods.CalendarName)
+
+	mods, err = Modifications(bytes.NewBufferString("work\n"), "some-mail@mail.com", "x")
+	assert.ErrorIs(t, err, ErrUnknownAnswer)
+	assert.Nil(t, mods)
+}
@@ -0,0 +1,211 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+
+	"github.com/trvita/caldav-client/input"
+	"github.com/trvita/caldav-client/mycal"
+)
+
+// parseShift parses duration with optional sign, e.g. -1h or +2d
+func parseShift(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+	}
+	d, err := input.ParseDuration(strings.TrimLeft(s, "+-"))
+	return sign * d, err
+}
+
+// bulkOp builds operation from values of command line flags, exactly one must be set
+func bulkOp(shift, set, addAttendee, removeAttendee, moveTo string, del bool) (*mycal.BulkOp, error) {
+	var ops []*mycal.BulkOp
+	if shift != "" {
+		d, err := parseShift(shift)
+		if err != nil {
+			return nil, fmt.Errorf("shift: %v", err)
+		}
+		ops = append(ops, &mycal.BulkOp{Kind: mycal.BulkShift, Shift: d})
+	}
+	if set != "" {
+		prop, value, ok := strings.Cut(set, "=")
+		if !ok {
+			return nil, fmt.Errorf("set: expected PROPERTY=value, e.g. STATUS=CANCELLED")
+		}
+		ops = append(ops, &mycal.BulkOp{Kind: mycal.BulkSet, Prop: strings.TrimSpace(prop), Value: value})
+	}
+	if addAttendee != "" {
+		ops = append(ops, &mycal.BulkOp{Kind: mycal.BulkAddAttendee, Attendee: addAttendee})
+	}
+	if removeAttendee != "" {
+		ops = append(ops, &mycal.BulkOp{Kind: mycal.BulkRemoveAttendee, Attendee: removeAttendee})
+	}
+	if moveTo != "" {
+		ops = append(ops, &mycal.BulkOp{Kind: mycal.BulkMove, Calendar: moveTo})
+	}
+	if del {
+		ops = append(ops, &mycal.BulkOp{Kind: mycal.BulkDelete})
+	}
+	if len(ops) != 1 {
+		return nil, fmt.Errorf("exactly one operation is required: -shift, -set, -add-attendee, -remove-attendee, -move-to or -delete")
+	}
+	return ops[0], ops[0].Check()
+}
+
+// PrintBulkReport prints result of every object and returns how many failed
+func PrintBulkReport(report []mycal.BulkResult, dryRun bool) int {
+	failed := 0
+	for _, res := range report {
+		if res.Err != nil {
+			failed++
+		}
+	}
+	if Output != "text" {
+		type resultJSON struct {
+			Calendar string `json:"calendar"`
+			Path     string `json:"path"`
+			UID      string `json:"uid"`
+			Summary  string `json:"summary"`
+			Change   string `json:"change,omitempty"`
+			Error    string `json:"error,omitempty"`
+		}
+		list := make([]resultJSON, 0, len(report))
+		for _, res := range report {
+			item := resultJSON{res.Calendar, res.Path, res.UID, res.Summary, res.Change, ""}
+			if res.Err != nil {
+				item.Error = res.Err.Error()
+			}
+			list = append(list, item)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(list); err != nil {
+			RedLine(err)
+		}
+		return failed
+	}
+	done := "ok"
+	if dryRun {
+		done = "would"
+	}
+	for _, res := range report {
+		status, detail := done, res.Change
+		switch {
+		case res.Err != nil:
+			status, detail = "fail", res.Err.Error()
+		case res.Change == "":
+			status, detail = "skip", "nothing to change"
+		}
+		fmt.Printf("%-5s %s %s %s\n", status, fit(res.Calendar, 12), fit(res.Summary, 24), detail)
+	}
+	changed := len(report) - failed
+	for _, res := range report {
+		if res.Err == nil && res.Change == "" {
+			changed--
+		}
+	}
+	verb := "changed"
+	if dryRun {
+		verb = "to change"
+	}
+	BlueLine(fmt.Sprintf("%d found, %d %s, %d failed\n", len(report), changed, verb, failed))
+	return failed
+}
+
+// notifyBulk emails cancellations of deleted events and invitations to added attendee
+func notifyBulk(op *mycal.BulkOp, results []mycal.SearchResult, report []mycal.BulkResult) {
+	var cals []*ical.Calendar
+	for i, res := range report {
+		switch {
+		case res.Err != nil:
+		case op.Kind == mycal.BulkDelete:
+			cals = append(cals, results[i].Object.Data)
+		case op.Kind == mycal.BulkAddAttendee && res.Data != nil:
+			cals = append(cals, res.Data)
+		}
+	}
+	switch op.Kind {
+	case mycal.BulkDelete:
+		NotifyCancelled(cals, "")
+	case mycal.BulkAddAttendee:
+		NotifyAdded(cals, op.Attendee, "")
+	}
+}
+
+// BulkMenu asks for query and operation, shows preview and applies operation to
+// found objects of calendar
+func BulkMenu(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset, calendarName string, r io.Reader) error {
+	var answers [5]string
+	for i, prompt := range []string{
+		"Text to search, empty for every object: ",
+		"From (e.g. 2024-07-01, today), empty for no limit: ",
+		"To (e.g. +1w), empty for no limit: ",
+		"Category, empty for any: ",
+		"Operation [shift 1h / set PROP=value / add-attendee email / remove-attendee email / move calendar / delete]: ",
+	} {
+		answer, err := input.String(r, prompt)
+		if err != nil {
+			return err
+		}
+		answers[i] = answer
+	}
+	kind, arg, _ := strings.Cut(answers[4], " ")
+	var flags [5]string
+	for i, name := range []string{"shift", "set", "add-attendee", "remove-attendee", "move"} {
+		if kind == name {
+			flags[i] = strings.TrimSpace(arg)
+		}
+	}
+	op, err := bulkOp(flags[0], flags[1], flags[2], flags[3], flags[4], kind == "delete")
+	if err != nil {
+		return err
+	}
+	q, err := searchQuery(answers[0], nil, nil, "", answers[1], answers[2], "")
+	if err != nil {
+		return err
+	}
+	q.Category = answers[3]
+	props, err := mycal.GetCalendarProps(ctx, httpClient, URL, homeset, calendarName)
+	if err != nil {
+		return err
+	}
+	results, err := mycal.Search(ctx, httpClient, URL, []mycal.CalendarProps{*props}, q)
+	if err != nil {
+		return err
+	}
+	end := &mycal.Endpoint{HTTPClient: httpClient, Client: client, URL: URL, Homeset: homeset}
+	opts := mycal.BulkOptions{DryRun: true, Trash: Trash()}
+	preview, err := mycal.Bulk(ctx, end, results, op, opts)
+	if err != nil {
+		return err
+	}
+	PrintBulkReport(preview, true)
+	if len(results) == 0 {
+		return nil
+	}
+	answer, err := input.String(r, fmt.Sprintf("Apply %s to %d object(s)? [y/N]: ", op.Kind, len(results)))
+	if err != nil || !strings.EqualFold(answer, "y") {
+		return err
+	}
+	opts.DryRun = false
+	report, err := mycal.Bulk(ctx, end, results, op, opts)
+	if err != nil {
+		return err
+	}
+	notifyBulk(op, results, report)
+	if failed := PrintBulkReport(report, false); failed > 0 {
+		return fmt.Errorf("%d of %d objects failed", failed, len(report))
+	}
+	return nil
+}
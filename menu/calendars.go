@@ -0,0 +1,201 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+
+	"github.com/trvita/caldav-client/input"
+	"github.com/trvita/caldav-client/mycal"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}([0-9A-Fa-f]{2})?$`)
+
+// parseComponents turns "event,todo" into component names, empty or "all" means all
+func parseComponents(value string) ([]string, error) {
+	if strings.EqualFold(value, "all") {
+		return nil, nil
+	}
+	var comps []string
+	for _, typ := range strings.Split(value, ",") {
+		if typ = strings.TrimSpace(typ); typ == "" {
+			continue
+		}
+		name, ok := componentNames[strings.ToLower(typ)]
+		if !ok {
+			return nil, fmt.Errorf("unknown component %s, expected event, todo or journal", typ)
+		}
+		comps = append(comps, name)
+	}
+	return comps, nil
+}
+
+// calendarValue checks value of property given by name, time zone is turned into VTIMEZONE
+func calendarValue(name, value string) (string, error) {
+	switch {
+	case value == "":
+		return "", nil
+	case name == "color" && !colorPattern.MatchString(value):
+		return "", fmt.Errorf("color must be #RRGGBB or #RRGGBBAA")
+	case name == "timezone":
+		return mycal.TimezoneCalendar(value)
+	}
+	return value, nil
+}
+
+// setCalendarChange puts checked value of property into changes
+func setCalendarChange(changes *mycal.CalendarChanges, name, value string) error {
+	if name == "components" {
+		comps, err := parseComponents(value)
+		if err != nil {
+			return err
+		}
+		if len(comps) == 0 {
+			// component set can't be removed, all of them are set instead
+			comps = append([]string(nil), mycal.ObjectComponents...)
+		}
+		changes.Components = comps
+		return nil
+	}
+	value, err := calendarValue(name, value)
+	if err != nil {
+		return err
+	}
+	switch name {
+	case "displayname":
+		changes.DisplayName = &value
+	case "description":
+		changes.Description = &value
+	case "color":
+		changes.Color = &value
+	case "order":
+		changes.Order = &value
+	case "timezone":
+		changes.Timezone = &value
+	default:
+		return fmt.Errorf("unknown calendar property %s", name)
+	}
+	return nil
+}
+
+func componentsText(comps []string) string {
+	if len(comps) == 0 {
+		return "all"
+	}
+	names := make([]string, len(comps))
+	for i, comp := range comps {
+		names[i] = strings.ToLower(strings.TrimPrefix(comp, "V"))
+	}
+	return strings.Join(names, ",")
+}
+
+// sortCalendars puts calendars with calendar-order first, in that order, others by name
+func sortCalendars(calendars []mycal.CalendarProps) {
+	sort.SliceStable(calendars, func(i, j int) bool {
+		a, b := calendars[i].Order, calendars[j].Order
+		if (a == "") != (b == "") {
+			return a != ""
+		}
+		x, errA := strconv.ParseFloat(a, 64)
+		y, errB := strconv.ParseFloat(b, 64)
+		if (errA == nil) != (errB == nil) {
+			return errA == nil
+		}
+		if errA == nil && x != y {
+			return x < y
+		}
+		if errA != nil && a != b {
+			return a < b
+		}
+		return calendars[i].Name < calendars[j].Name
+	})
+}
+
+// PrintCalendars lists calendars with their properties
+func PrintCalendars(calendars []mycal.CalendarProps) {
+	sortCalendars(calendars)
+	if Output != "text" {
+		type calendarJSON struct {
+			Name        string   `json:"name"`
+			Path        string   `json:"path"`
+			DisplayName string   `json:"displayname,omitempty"`
+			Description string   `json:"description,omitempty"`
+			Color       string   `json:"color,omitempty"`
+			Order       string   `json:"order,omitempty"`
+			Timezone    string   `json:"timezone,omitempty"`
+			Components  []string `json:"components,omitempty"`
+		}
+		list := make([]calendarJSON, 0, len(calendars))
+		for _, props := range calendars {
+			list = append(list, calendarJSON{props.Name, props.Path, props.DisplayName, props.Description,
+				props.Color, props.Order, props.TimezoneID(), props.Components})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(list); err != nil {
+			RedLine(err)
+		}
+		return
+	}
+	for _, props := range calendars {
+		color := colorOf(&mycal.Occurrence{Calendar: props.Name, Color: props.Color})
+		fmt.Printf("%s●%s %s", color, reset, props.Name)
+		if props.DisplayName != "" && props.DisplayName != props.Name {
+			fmt.Printf(" (%s)", props.DisplayName)
+		}
+		fmt.Println()
+		for _, line := range calendarFields(&props)[1:] {
+			if line[1] != "" {
+				fmt.Printf("    %-12s %s\n", line[0]+":", line[1])
+			}
+		}
+	}
+}
+
+// calendarFields are names and current values of properties that can be changed
+func calendarFields(props *mycal.CalendarProps) [][2]string {
+	return [][2]string{
+		{"displayname", props.DisplayName},
+		{"description", props.Description},
+		{"color", props.Color},
+		{"order", props.Order},
+		{"timezone", props.TimezoneID()},
+		{"components", componentsText(props.Components)},
+	}
+}
+
+// ChangeCalendar asks for new calendar properties, empty answer keeps value and "-" removes it
+func ChangeCalendar(ctx context.Context, httpClient webdav.HTTPClient, homeset, calendarName string, r io.Reader) error {
+	props, err := mycal.GetCalendarProps(ctx, httpClient, URL, homeset, calendarName)
+	if err != nil {
+		return err
+	}
+	changes := &mycal.CalendarChanges{}
+	for _, field := range calendarFields(props) {
+		for {
+			value, err := input.String(r, fmt.Sprintf("%s [%s]: ", field[0], field[1]))
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				break
+			}
+			if value == "-" {
+				value = ""
+			}
+			if err = setCalendarChange(changes, field[0], value); err == nil {
+				break
+			}
+			RedLine(err)
+		}
+	}
+	return mycal.UpdateCalendar(ctx, httpClient, URL, homeset, calendarName, changes)
+}
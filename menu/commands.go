@@ -0,0 +1,1058 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+
+	"github.com/trvita/caldav-client/input"
+	"github.com/trvita/caldav-client/mycal"
+)
+
+// Run executes command from command line, without one interactive menu is started
+func Run(url string, args []string, r io.Reader) error {
+	URL = url
+	flags := flag.NewFlagSet("client", flag.ContinueOnError)
+	outputFlag(flags)
+	flags.BoolVar(&Plain, "plain", false, "numbered menus instead of full-screen interface")
+	timezone := flags.String("timezone", "", "time zone of entered dates without offset, local when not set")
+	flags.Var(&BusyCalendars, "busy", "calendars checked for conflicts before creating or accepting events, all when not set")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *timezone != "" {
+		loc, err := time.LoadLocation(*timezone)
+		if err != nil {
+			return err
+		}
+		input.Location = loc
+	}
+	if err := checkOutput(); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		StartMenu(url, r)
+		return nil
+	}
+	switch args[0] {
+	case "sync":
+		return SyncCommand(url, args[1:], r)
+	case "import":
+		return ImportCommand(url, args[1:], r)
+	case "export":
+		return ExportCommand(url, args[1:], r)
+	case "restore":
+		return RestoreCommand(url, args[1:], r)
+	case "migrate":
+		return MigrateCommand(args[1:], r)
+	case "list":
+		return ListCommand(url, args[1:], r)
+	case "edit":
+		return EditCommand(url, args[1:], r)
+	case "search":
+		return SearchCommand(url, args[1:], r)
+	case "delete":
+		return DeleteCommand(url, args[1:], r)
+	case "trash":
+		return TrashCommand(url, args[1:], r)
+	case "undo":
+		return UndoCommand(url, args[1:], r)
+	case "bulk":
+		return BulkCommand(url, args[1:], r)
+	case "copy", "move":
+		return CopyCommand(url, args[0], args[1:], r)
+	case "calendars":
+		return CalendarsCommand(url, args[1:], r)
+	case "calendar":
+		return CalendarCommand(url, args[1:], r)
+	case "conflicts":
+		return ConflictsCommand(url, args[1:], r)
+	case "agenda", "day", "week", "month":
+		return ViewCommand(url, args[0], args[1:], r)
+	}
+	return fmt.Errorf("unknown command %s", args[0])
+}
+
+// Profiles are servers known by name, command line also accepts urls
+var Profiles = map[string]string{
+	"baikal":   "http://127.0.0.1:90/dav.php",
+	"radicale": "http://127.0.0.1:5232",
+}
+
+// Login finds calendar home set of user, credentials are taken from
+// CALDAV_USERNAME and CALDAV_PASSWORD or asked for
+func Login(url string, r io.Reader) (webdav.HTTPClient, *caldav.Client, string, context.Context, error) {
+	return login(url, "CALDAV", r)
+}
+
+func login(url, env string, r io.Reader) (webdav.HTTPClient, *caldav.Client, string, context.Context, error) {
+	if username := os.Getenv(env + "_USERNAME"); username != "" {
+		r = strings.NewReader(username + "\n" + os.Getenv(env+"_PASSWORD") + "\n")
+	}
+	httpClient, client, principal, ctx, err := mycal.CreateClient(url, r)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	homeset, err := client.FindCalendarHomeSet(ctx, principal)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	return httpClient, client, homeset, ctx, nil
+}
+
+// outputFlag lets listing commands choose format of Output
+func outputFlag(flags *flag.FlagSet) {
+	flags.StringVar(&Output, "output", Output, "format of listings: text, json or jcal")
+}
+
+func checkOutput() error {
+	switch Output {
+	case "text", "json", "jcal":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %s", Output)
+}
+
+// list is flag that can be repeated or given as comma separated values
+type list []string
+
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func SyncCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	dir := flags.String("dir", "", "local vdir directory, one subdirectory per calendar")
+	conflict := flags.String("conflict", "remote", "what to do when both sides changed: remote, local, both or prompt")
+	var calendars list
+	flags.Var(&calendars, "calendar", "calendar to sync, all when not set")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("sync: -dir is required")
+	}
+	policy, err := mycal.ParseConflictPolicy(*conflict)
+	if err != nil {
+		return err
+	}
+
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	opts := mycal.VdirOptions{
+		Policy: policy,
+		Resolve: func(c *mycal.VdirConflict) mycal.ConflictPolicy {
+			return ResolveConflict(c, r)
+		},
+	}
+	report, err := mycal.SyncVdir(ctx, httpClient, client, URL, homeset, *dir, calendars, opts)
+	if report != nil {
+		PrintVdirReport(report)
+	}
+	return err
+}
+
+// ResolveConflict shows both versions of object and asks which one to keep
+func ResolveConflict(c *mycal.VdirConflict, r io.Reader) mycal.ConflictPolicy {
+	BlueLine(fmt.Sprintf("Conflict in %s/%s\n", c.Calendar, c.File))
+	for _, side := range []struct {
+		name string
+		cal  *ical.Calendar
+	}{{"local", c.Local}, {"remote", c.Remote}} {
+		if side.cal == nil {
+			fmt.Printf("%s: deleted\n", side.name)
+			continue
+		}
+		for _, comp := range side.cal.Children {
+			if comp.Name == ical.CompTimezone {
+				continue
+			}
+			summary, _ := comp.Props.Text(ical.PropSummary)
+			start := comp.Props.Get(ical.PropDateTimeStart)
+			modified := comp.Props.Get(ical.PropLastModified)
+			fmt.Printf("%s: %s", side.name, summary)
+			if start != nil {
+				fmt.Printf(", start %s", start.Value)
+			}
+			if modified != nil {
+				fmt.Printf(", modified %s", modified.Value)
+			}
+			fmt.Println()
+		}
+	}
+	for {
+		answer, err := input.String(r, "Keep [r]emote, [l]ocal or [b]oth? ")
+		if err != nil {
+			return mycal.RemoteWins
+		}
+		switch strings.ToLower(answer) {
+		case "r":
+			return mycal.RemoteWins
+		case "l":
+			return mycal.LocalWins
+		case "b":
+			return mycal.KeepBoth
+		}
+	}
+}
+
+func PrintVdirReport(report *mycal.VdirReport) {
+	for _, part := range []struct {
+		name  string
+		files []string
+	}{
+		{"downloaded", report.Downloaded},
+		{"uploaded", report.Uploaded},
+		{"deleted locally", report.DeletedLocal},
+		{"deleted on server", report.DeletedRemote},
+		{"conflicts", report.Conflicts},
+	} {
+		fmt.Printf("%s: %d\n", part.name, len(part.files))
+		for _, file := range part.files {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+}
+
+func ImportCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	calendarName := flags.String("calendar", "", "calendar to import to")
+	modeName := flags.String("mode", "skip", "what to do with UIDs already in calendar: skip, overwrite or newuid")
+	csvInput := flags.Bool("csv", false, "read CSV, files ending with .csv are read as CSV anyway")
+	mapping := csvFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *calendarName == "" {
+		return fmt.Errorf("import: -calendar is required")
+	}
+	mode, err := mycal.ParseImportMode(*modeName)
+	if err != nil {
+		return err
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	if *csvInput || strings.HasSuffix(files[0], ".csv") {
+		return ImportCSV(url, *calendarName, files, mapping, r)
+	}
+	var cals []*ical.Calendar
+	for _, file := range files {
+		read, err := ReadCalendarFile(file, r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		cals = append(cals, read...)
+	}
+
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	return ImportCalendars(ctx, httpClient, client, homeset, *calendarName, cals, mode)
+}
+
+// ReadCalendarFile reads calendars from file, "-" is r
+func ReadCalendarFile(file string, r io.Reader) ([]*ical.Calendar, error) {
+	if file == "-" {
+		return mycal.ReadCalendars(r)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return mycal.ReadCalendars(f)
+}
+
+func ImportCalendars(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset, calendarName string, cals []*ical.Calendar, mode mycal.ImportMode) error {
+	objects, err := mycal.SplitCalendars(cals...)
+	if err != nil {
+		return err
+	}
+	report, err := mycal.ImportCalendars(ctx, httpClient, client, URL, homeset, calendarName, objects, mode)
+	if err != nil {
+		return err
+	}
+	for _, part := range []struct {
+		name string
+		uids []string
+	}{
+		{"created", report.Created},
+		{"overwritten", report.Overwritten},
+		{"new UID", report.Renamed},
+		{"skipped", report.Skipped},
+		{"failed", report.Failed},
+	} {
+		fmt.Printf("%s: %d\n", part.name, len(part.uids))
+		for _, uid := range part.uids {
+			fmt.Printf("  %s\n", uid)
+		}
+	}
+	return nil
+}
+
+// csvOptions are flags of CSV import and export, mapping file is read when flags are parsed
+type csvOptions struct {
+	file, dateFormat, timezone, typ string
+}
+
+func csvFlags(flags *flag.FlagSet) *csvOptions {
+	opts := &csvOptions{}
+	flags.StringVar(&opts.file, "mapping", "", "json file mapping CSV columns to fields, date format and time zone")
+	flags.StringVar(&opts.dateFormat, "date-format", "", "Go layout of CSV dates, e.g. 02.01.2006 15:04")
+	flags.StringVar(&opts.timezone, "timezone", "", "time zone of CSV dates without offset, local when not set")
+	flags.StringVar(&opts.typ, "type", "", "VEVENT or VTODO for CSV rows without type column")
+	return opts
+}
+
+// Mapping reads mapping file, flags override its values
+func (opts *csvOptions) Mapping() (*mycal.CSVMapping, error) {
+	mapping := &mycal.CSVMapping{}
+	if opts.file != "" {
+		var err error
+		if mapping, err = mycal.LoadCSVMapping(opts.file); err != nil {
+			return nil, err
+		}
+	}
+	if opts.dateFormat != "" {
+		mapping.DateFormat = opts.dateFormat
+	}
+	if opts.timezone != "" {
+		mapping.Timezone = opts.timezone
+	}
+	if opts.typ != "" {
+		mapping.Type = opts.typ
+	}
+	return mapping, nil
+}
+
+// ImportCSV creates event or todo of every row, rows are checked before
+// anything is uploaded
+func ImportCSV(url, calendarName string, files []string, opts *csvOptions, r io.Reader) error {
+	mapping, err := opts.Mapping()
+	if err != nil {
+		return err
+	}
+	var records []mycal.CSVRecord
+	for _, file := range files {
+		var read []mycal.CSVRecord
+		if file == "-" {
+			read, err = mycal.ReadCSV(r, mapping)
+		} else {
+			var f *os.File
+			if f, err = os.Open(file); err != nil {
+				return err
+			}
+			read, err = mycal.ReadCSV(f, mapping)
+			f.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		records = append(records, read...)
+	}
+	events := make([]*ical.Event, len(records))
+	for i := range records {
+		if events[i], err = records[i].Component(); err != nil {
+			return fmt.Errorf("line %d: %v", records[i].Line, err)
+		}
+	}
+
+	_, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for i, event := range events {
+		if err := CreateEvent(ctx, client, homeset, calendarName, event); err != nil {
+			failed++
+			RedLine(fmt.Errorf("line %d: %v", records[i].Line, err))
+		}
+	}
+	fmt.Printf("created: %d\n", len(events)-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d rows failed", failed)
+	}
+	return nil
+}
+
+func ExportCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	var calendars list
+	flags.Var(&calendars, "calendar", "calendar to export, all when not set")
+	output := flags.String("o", "-", "file to write all calendars to, - is stdout")
+	dir := flags.String("dir", "", "directory to write one file per calendar to")
+	format := flags.String("format", "ics", "format of written calendars: ics, jcal, xcal or csv")
+	var columns list
+	flags.Var(&columns, "columns", "CSV columns: "+strings.Join(mycal.CSVFields, ", "))
+	csvOpts := csvFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ext, ok := calendarFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %s, expected ics, jcal, xcal or csv", *format)
+	}
+	if *format == "csv" {
+		return ExportCSV(url, *output, calendars, columns, csvOpts, r)
+	}
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	exported, err := mycal.ExportCalendars(ctx, httpClient, client, URL, homeset, calendars)
+	if err != nil {
+		return err
+	}
+
+	if *dir != "" {
+		if err := os.MkdirAll(*dir, 0o700); err != nil {
+			return err
+		}
+		for _, cal := range exported {
+			name, _ := cal.Props.Text(mycal.PropCalendarID)
+			if err := WriteCalendarFile(filepath.Join(*dir, name+ext), *format, cal); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return WriteCalendarFile(*output, *format, exported...)
+}
+
+// calendarFormats maps format names to file extensions
+var calendarFormats = map[string]string{
+	"ics":  ".ics",
+	"jcal": ".json",
+	"xcal": ".xml",
+	"csv":  ".csv",
+}
+
+// ExportCSV writes events and todos of calendars as one table
+func ExportCSV(url, file string, calendars, columns []string, opts *csvOptions, r io.Reader) error {
+	mapping, err := opts.Mapping()
+	if err != nil {
+		return err
+	}
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	exported, err := mycal.ExportCalendars(ctx, httpClient, client, URL, homeset, calendars)
+	if err != nil {
+		return err
+	}
+	var comps []*ical.Component
+	for _, cal := range exported {
+		comps = append(comps, cal.Children...)
+	}
+	w := io.Writer(os.Stdout)
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return mycal.ExportCSV(w, comps, columns, mapping)
+}
+
+// WriteCalendarFile writes calendars in format, "-" is stdout
+func WriteCalendarFile(file, format string, cals ...*ical.Calendar) error {
+	w := io.Writer(os.Stdout)
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case "jcal":
+		jcal := make([]interface{}, 0, len(cals))
+		for _, cal := range cals {
+			jcal = append(jcal, mycal.JCalComponent(cal.Component))
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if len(jcal) == 1 {
+			return enc.Encode(jcal[0])
+		}
+		return enc.Encode(jcal)
+	case "xcal":
+		return mycal.EncodeXCal(w, cals...)
+	}
+	enc := ical.NewEncoder(w)
+	for _, cal := range cals {
+		if err := enc.Encode(cal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RestoreCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	modeName := flags.String("mode", "skip", "what to do with UIDs already in calendar: skip, overwrite or newuid")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	mode, err := mycal.ParseImportMode(*modeName)
+	if err != nil {
+		return err
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var cals []*ical.Calendar
+	for _, file := range files {
+		read, err := ReadCalendarFile(file, r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		cals = append(cals, read...)
+	}
+
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	for _, cal := range cals {
+		report, err := mycal.RestoreCalendar(ctx, httpClient, client, URL, homeset, cal, mode)
+		if err != nil {
+			return err
+		}
+		name, _ := cal.Props.Text(mycal.PropCalendarID)
+		BlueLine(fmt.Sprintf("%s: %d created, %d overwritten, %d skipped, %d failed\n", name, len(report.Created)+len(report.Renamed), len(report.Overwritten), len(report.Skipped), len(report.Failed)))
+		for _, failed := range report.Failed {
+			RedLine(fmt.Errorf("%s", failed))
+		}
+	}
+	return nil
+}
+
+func MigrateCommand(args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := flags.String("from", "baikal", "source profile or url")
+	to := flags.String("to", "radicale", "destination profile or url")
+	var calendars list
+	flags.Var(&calendars, "calendar", "calendar to migrate, all when not set")
+	dryRun := flags.Bool("dry-run", false, "only show what would be done")
+	statePath := flags.String("state", "", "file with progress of migration to resume from")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *statePath == "" {
+		dir, err := mycal.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+		*statePath = filepath.Join(dir, "migrate.json")
+	}
+
+	var endpoints []*mycal.Endpoint
+	for _, side := range []struct{ name, profile, env string }{
+		{"Source", *from, "CALDAV_SOURCE"},
+		{"Destination", *to, "CALDAV_DESTINATION"},
+	} {
+		url, ok := Profiles[side.profile]
+		if !ok {
+			url = side.profile
+		}
+		BlueLine(fmt.Sprintf("%s %s\n", side.name, url))
+		httpClient, client, homeset, _, err := login(url, side.env, r)
+		if err != nil {
+			return err
+		}
+		endpoints = append(endpoints, &mycal.Endpoint{HTTPClient: httpClient, Client: client, URL: url, Homeset: homeset})
+	}
+
+	report, err := mycal.Migrate(context.Background(), endpoints[0], endpoints[1], mycal.MigrateOptions{
+		Calendars: calendars,
+		DryRun:    *dryRun,
+		StatePath: *statePath,
+	})
+	if report != nil {
+		if *dryRun {
+			BlueLine("Dry run, nothing changed\n")
+		}
+		for _, part := range []struct {
+			name  string
+			items []string
+		}{
+			{"calendars created", report.CreatedCalendars},
+			{"objects copied", report.Copied},
+			{"objects copied before", report.Skipped},
+			{"objects already there, not copied", report.Existing},
+			{"mismatches", report.Mismatches},
+		} {
+			fmt.Printf("%s: %d\n", part.name, len(part.items))
+			if part.name != "objects copied before" {
+				for _, item := range part.items {
+					fmt.Printf("  %s\n", item)
+				}
+			}
+		}
+	}
+	return err
+}
+
+// EditCommand edits object with uid in $EDITOR: edit [-calendar name] [-raw] [-yes] uid
+func EditCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("edit", flag.ContinueOnError)
+	calendarName := flags.String("calendar", "", "calendar of object, all are searched when not set")
+	raw := flags.Bool("raw", false, "edit text as server stores it instead of prettified")
+	yes := flags.Bool("yes", false, "save without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("edit: one UID is required")
+	}
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	return EditObject(ctx, httpClient, client, homeset, *calendarName, flags.Arg(0), *raw, *yes, r)
+}
+
+func ListCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	calendarName := flags.String("calendar", "", "calendar to list")
+	todos := flags.Bool("todos", false, "list todos instead of events")
+	outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(); err != nil {
+		return err
+	}
+	if *calendarName == "" {
+		return fmt.Errorf("list: -calendar is required")
+	}
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	resp, offline, err := mycal.CachedObjects(ctx, httpClient, client, URL, homeset, *calendarName, Cache())
+	if err != nil {
+		return err
+	}
+	if offline {
+		fmt.Fprintln(os.Stderr, "Server is unreachable, showing cached data")
+	}
+	if *todos {
+		PrintEvents(mycal.FilterComponents(resp, ical.CompToDo))
+	} else {
+		PrintEvents(mycal.FilterComponents(resp, ical.CompEvent))
+	}
+	return nil
+}
+
+// SearchCommand finds events, todos and journals by text, time range and status:
+// search [-calendar names] [-in fields] [-type types] [-from date] [-to date] [-status s] text
+func SearchCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	var calendars, fields, types list
+	flags.Var(&calendars, "calendar", "calendar to search, all when not set")
+	flags.Var(&fields, "in", "properties to search text in: summary, description, location, attendee, categories; all when not set")
+	flags.Var(&types, "type", "event, todo or journal, all when not set")
+	collation := flags.String("collation", "ascii", "text comparison: ascii or unicode ignore case, octet doesn't")
+	from := flags.String("from", "", "start of time range, e.g. 2024-07-01 or today")
+	to := flags.String("to", "", "end of time range, e.g. +1w or next fri")
+	status := flags.String("status", "", "status such as CONFIRMED, TENTATIVE, CANCELLED or NEEDS-ACTION")
+	outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(); err != nil {
+		return err
+	}
+	q, err := searchQuery(strings.Join(flags.Args(), " "), fields, types, *collation, *from, *to, *status)
+	if err != nil {
+		return err
+	}
+	httpClient, _, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	selected, err := selectCalendars(ctx, httpClient, homeset, calendars)
+	if err != nil {
+		return err
+	}
+	results, err := mycal.Search(ctx, httpClient, URL, selected, q)
+	if err != nil {
+		return err
+	}
+	PrintSearchResults(results)
+	return nil
+}
+
+// DeleteCommand deletes objects by UID or found by text after asking, they are kept
+// in trash: delete [-calendar name] [-search] [-yes] uid...|text
+func DeleteCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	calendarName := flags.String("calendar", "", "calendar of objects, all are searched when not set")
+	search := flags.Bool("search", false, "delete objects found by text instead of UIDs")
+	yes := flags.Bool("yes", false, "delete without asking")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("delete: UID or text to search is required")
+	}
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	var objects []caldav.CalendarObject
+	if *search {
+		var names []string
+		if *calendarName != "" {
+			names = append(names, *calendarName)
+		}
+		calendars, err := selectCalendars(ctx, httpClient, homeset, names)
+		if err != nil {
+			return err
+		}
+		results, err := mycal.Search(ctx, httpClient, URL, calendars, &mycal.SearchQuery{Text: strings.Join(flags.Args(), " ")})
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return fmt.Errorf("nothing found")
+		}
+		for _, res := range results {
+			objects = append(objects, res.Object)
+		}
+	} else {
+		for _, uid := range flags.Args() {
+			obj, err := mycal.FindObject(ctx, client, homeset, *calendarName, uid)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, *obj)
+		}
+	}
+	return DeleteFound(ctx, httpClient, objects, *yes, r)
+}
+
+// TrashCommand lists deleted objects, restores or forgets them: trash [list|restore id...|empty]
+func TrashCommand(url string, args []string, r io.Reader) error {
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	switch action {
+	case "list":
+		items, err := Trash().List()
+		if err != nil {
+			return err
+		}
+		PrintTrash(items)
+		return nil
+	case "empty":
+		return Trash().Empty()
+	case "restore":
+		if len(args) == 0 {
+			return fmt.Errorf("trash restore: at least one id is required")
+		}
+		var items []mycal.TrashItem
+		for _, id := range args {
+			item, err := Trash().Get(id)
+			if err != nil {
+				return err
+			}
+			items = append(items, *item)
+		}
+		httpClient, _, _, ctx, err := Login(url, r)
+		if err != nil {
+			return err
+		}
+		n, err := mycal.RestoreItems(ctx, httpClient, URL, items, Trash())
+		BlueLine(fmt.Sprintf("Restored %d item(s)\n", n))
+		return err
+	}
+	return fmt.Errorf("trash: unknown action %s, expected list, restore or empty", action)
+}
+
+// UndoCommand restores objects deleted last
+func UndoCommand(url string, args []string, r io.Reader) error {
+	if len(args) > 0 {
+		return fmt.Errorf("undo takes no arguments")
+	}
+	httpClient, _, _, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	return Undo(ctx, httpClient)
+}
+
+// BulkCommand applies one operation to every object found by query, after preview:
+// bulk [-calendar names] [-from date] [-to date] [-category c] [-type types] operation [text]
+func BulkCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("bulk", flag.ContinueOnError)
+	var calendars, types list
+	flags.Var(&calendars, "calendar", "calendar to change, all when not set")
+	flags.Var(&types, "type", "event, todo or journal, all when not set")
+	from := flags.String("from", "", "start of time range, e.g. 2024-07-01 or today")
+	to := flags.String("to", "", "end of time range, e.g. +1w or next fri")
+	category := flags.String("category", "", "category objects must have")
+	shift := flags.String("shift", "", "move dates by duration, e.g. 1h or -30m")
+	set := flags.String("set", "", "set property, e.g. STATUS=CANCELLED, empty value removes it")
+	addAttendee := flags.String("add-attendee", "", "email of attendee to add")
+	removeAttendee := flags.String("remove-attendee", "", "email of attendee to remove")
+	moveTo := flags.String("move-to", "", "calendar to move objects to")
+	del := flags.Bool("delete", false, "delete objects, undo brings them back")
+	dryRun := flags.Bool("dry-run", false, "only show what would be done")
+	jobs := flags.Int("jobs", 4, "how many objects are changed at once")
+	yes := flags.Bool("yes", false, "apply without asking")
+	outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(); err != nil {
+		return err
+	}
+	op, err := bulkOp(*shift, *set, *addAttendee, *removeAttendee, *moveTo, *del)
+	if err != nil {
+		return err
+	}
+	text := strings.Join(flags.Args(), " ")
+	if len(calendars) == 0 && *from == "" && *to == "" && *category == "" && text == "" {
+		return fmt.Errorf("bulk: query is required, give calendar, time range, category or text")
+	}
+	q, err := searchQuery(text, nil, types, "", *from, *to, "")
+	if err != nil {
+		return err
+	}
+	q.Category = *category
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	selected, err := selectCalendars(ctx, httpClient, homeset, calendars)
+	if err != nil {
+		return err
+	}
+	results, err := mycal.Search(ctx, httpClient, URL, selected, q)
+	if err != nil {
+		return err
+	}
+	end := &mycal.Endpoint{HTTPClient: httpClient, Client: client, URL: URL, Homeset: homeset}
+	opts := mycal.BulkOptions{DryRun: true, Jobs: *jobs, Trash: Trash()}
+	preview, err := mycal.Bulk(ctx, end, results, op, opts)
+	if err != nil {
+		return err
+	}
+	if *dryRun || len(results) == 0 {
+		PrintBulkReport(preview, true)
+		return nil
+	}
+	if !*yes {
+		PrintBulkReport(preview, true)
+		answer, err := input.String(r, fmt.Sprintf("Apply %s to %d object(s)? [y/N]: ", op.Kind, len(results)))
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(answer, "y") {
+			BlueLine("Nothing changed\n")
+			return nil
+		}
+	}
+	opts.DryRun = false
+	report, err := mycal.Bulk(ctx, end, results, op, opts)
+	if err != nil {
+		return err
+	}
+	notifyBulk(op, results, report)
+	if failed := PrintBulkReport(report, false); failed > 0 {
+		return fmt.Errorf("%d of %d objects failed", failed, len(report))
+	}
+	return nil
+}
+
+// CopyCommand copies or moves events and todos by UID to another calendar, also of
+// another account: copy|move [-from calendar] -to calendar [-account profile] [-overwrite] uid...
+func CopyCommand(url, kind string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet(kind, flag.ContinueOnError)
+	from := flags.String("from", "", "calendar of objects, all are searched when not set")
+	to := flags.String("to", "", "destination calendar")
+	account := flags.String("account", "", "profile or url of destination account, credentials from CALDAV_DESTINATION_USERNAME and CALDAV_DESTINATION_PASSWORD")
+	overwrite := flags.Bool("overwrite", false, "replace object with the same UID in destination calendar")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("%s: -to is required", kind)
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("%s: at least one UID is required", kind)
+	}
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	src := &mycal.Endpoint{HTTPClient: httpClient, Client: client, URL: URL, Homeset: homeset}
+	dst := src
+	if *account != "" {
+		dstURL, ok := Profiles[*account]
+		if !ok {
+			dstURL = *account
+		}
+		BlueLine(fmt.Sprintf("Destination %s\n", dstURL))
+		httpClient, client, homeset, _, err := login(dstURL, "CALDAV_DESTINATION", r)
+		if err != nil {
+			return err
+		}
+		dst = &mycal.Endpoint{HTTPClient: httpClient, Client: client, URL: dstURL, Homeset: homeset}
+	}
+	return CopyObjects(ctx, src, dst, *from, flags.Args(), *to, mycal.CopyOptions{Move: kind == "move", Overwrite: *overwrite})
+}
+
+// CalendarsCommand lists calendars with display name, color, order, time zone and components
+func CalendarsCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("calendars", flag.ContinueOnError)
+	outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(); err != nil {
+		return err
+	}
+	httpClient, _, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	calendars, err := mycal.ListCalendarProps(ctx, httpClient, URL, homeset)
+	if err != nil {
+		return err
+	}
+	PrintCalendars(calendars)
+	return nil
+}
+
+// CalendarCommand creates calendar or changes its properties: calendar create|set [flags] name,
+// set changes only given flags and empty value removes property
+func CalendarCommand(url string, args []string, r io.Reader) error {
+	if len(args) == 0 || (args[0] != "create" && args[0] != "set") {
+		return fmt.Errorf("calendar: create or set is required")
+	}
+	action := args[0]
+	flags := flag.NewFlagSet("calendar "+action, flag.ContinueOnError)
+	flags.String("displayname", "", "name shown by clients")
+	flags.String("description", "", "calendar description")
+	flags.String("color", "", "color as #RRGGBB or #RRGGBBAA")
+	flags.String("order", "", "position among calendars, a number")
+	flags.String("timezone", "", "default time zone, e.g. Europe/Berlin")
+	flags.String("components", "", "event, todo and journal separated by commas, all when not set")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("calendar %s: one calendar name is required", action)
+	}
+	changes := &mycal.CalendarChanges{}
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		if err == nil {
+			if err = setCalendarChange(changes, f.Name, f.Value.String()); err != nil {
+				err = fmt.Errorf("%s: %v", f.Name, err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	httpClient, _, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	name := flags.Arg(0)
+	if action == "set" {
+		if err := mycal.UpdateCalendar(ctx, httpClient, URL, homeset, name, changes); err != nil {
+			return err
+		}
+		BlueLine("Calendar " + name + " changed\n")
+		return nil
+	}
+	props := &mycal.CalendarProps{DisplayName: name, Components: changes.Components}
+	set := func(to, value *string) {
+		if value != nil {
+			*to = *value
+		}
+	}
+	set(&props.DisplayName, changes.DisplayName)
+	set(&props.Description, changes.Description)
+	set(&props.Color, changes.Color)
+	set(&props.Order, changes.Order)
+	set(&props.Timezone, changes.Timezone)
+	if err := mycal.MakeCalendar(ctx, httpClient, URL, homeset, name, props); err != nil {
+		return err
+	}
+	BlueLine("Calendar " + name + " created\n")
+	return nil
+}
+
+// ViewCommand shows agenda or calendar grid of day, week or month
+func ViewCommand(url, kind string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet(kind, flag.ContinueOnError)
+	var calendars list
+	flags.Var(&calendars, "calendar", "calendar to show, all when not set")
+	date := flags.String("date", "", "day to show, e.g. 2024-07-01, tomorrow or next mon; today when not set")
+	days := flags.Int("days", 7, "number of days in agenda")
+	timezone := flags.String("timezone", "", "time zone of view, the configured one when not set")
+	outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(); err != nil {
+		return err
+	}
+	loc := input.Location
+	if *timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(*timezone); err != nil {
+			return err
+		}
+	}
+	day := input.Now().In(loc)
+	if *date != "" {
+		var err error
+		if day, err = input.ParseDate(*date, input.Now(), loc); err != nil {
+			return err
+		}
+	}
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	return ShowView(ctx, httpClient, client, homeset, os.Stdout, kind, calendars, day, *days)
+}
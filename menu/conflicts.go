@@ -0,0 +1,201 @@
+package menu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+
+	"github.com/trvita/caldav-client/input"
+	"github.com/trvita/caldav-client/mycal"
+)
+
+// BusyCalendars are checked for conflicts before events are created or accepted, all when empty
+var BusyCalendars list
+
+// errOverlaps is returned by forms, submitting them again goes ahead anyway
+var errOverlaps = errors.New("submit again to go ahead anyway")
+
+func eventCalendar(event *ical.Event) *ical.Calendar {
+	cal := ical.NewCalendar()
+	cal.Children = append(cal.Children, event.Component)
+	return cal
+}
+
+// findOverlaps checks every occurrence of events in cal against busy calendars
+func findOverlaps(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset string, cal *ical.Calendar) ([]mycal.Overlap, error) {
+	calendars, err := selectCalendars(ctx, httpClient, homeset, BusyCalendars)
+	if err != nil {
+		return nil, err
+	}
+	return mycal.EventConflicts(ctx, client, calendars, cal, time.Time{}, input.Location)
+}
+
+// formatPeriod shows end without date when it is on the day of start
+func formatPeriod(occ mycal.Occurrence) string {
+	start, end := occ.Start.In(input.Location), occ.End.In(input.Location)
+	if occ.AllDay {
+		return start.Format("2006-01-02") + " all day"
+	}
+	if end.Format("2006-01-02") == start.Format("2006-01-02") {
+		return start.Format("2006-01-02 15:04") + "-" + end.Format("15:04")
+	}
+	return start.Format("2006-01-02 15:04") + " - " + end.Format("2006-01-02 15:04")
+}
+
+func describeOverlap(overlap mycal.Overlap) string {
+	with := overlap.With.Summary + " " + formatPeriod(overlap.With)
+	if overlap.With.Calendar != "" {
+		with += " (" + overlap.With.Calendar + ")"
+	}
+	return formatPeriod(overlap.Occurrence) + " overlaps " + with
+}
+
+// overlapsError describes first overlap in form, the rest are counted
+func overlapsError(overlaps []mycal.Overlap) error {
+	more := ""
+	if len(overlaps) > 1 {
+		more = fmt.Sprintf(" and %d more", len(overlaps)-1)
+	}
+	return fmt.Errorf("%s%s, %w", describeOverlap(overlaps[0]), more, errOverlaps)
+}
+
+// ConfirmConflicts prints occurrences of events in cal that overlap busy ones and asks
+// question, without conflicts there is nothing to ask. Conflicts that can't be checked
+// don't stop the caller.
+func ConfirmConflicts(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset string, cal *ical.Calendar, question string, r io.Reader) (bool, error) {
+	overlaps, err := findOverlaps(ctx, httpClient, client, homeset, cal)
+	if err != nil {
+		if !mycal.IsOffline(err) {
+			RedLine(fmt.Errorf("conflicts not checked: %v", err))
+		}
+		return true, nil
+	}
+	if len(overlaps) == 0 {
+		return true, nil
+	}
+	RedLine(fmt.Errorf("%d conflict(s):", len(overlaps)))
+	for _, overlap := range overlaps {
+		fmt.Println("  " + describeOverlap(overlap))
+	}
+	answer, err := input.String(r, question+" [y/N]: ")
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(answer, "y"), nil
+}
+
+// ListConflicts prints every pair of busy events of calendars, all when names are empty,
+// that overlap in [start, end)
+func ListConflicts(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset string, names []string, start, end time.Time) error {
+	calendars, err := selectCalendars(ctx, httpClient, homeset, names)
+	if err != nil {
+		return err
+	}
+	overlaps, err := mycal.ListConflicts(ctx, client, calendars, start, end, input.Location)
+	if err != nil {
+		return err
+	}
+	PrintConflicts(overlaps)
+	return nil
+}
+
+func PrintConflicts(overlaps []mycal.Overlap) {
+	if Output != "text" {
+		type occurrenceJSON struct {
+			Calendar string    `json:"calendar"`
+			UID      string    `json:"uid"`
+			Summary  string    `json:"summary"`
+			Start    time.Time `json:"start"`
+			End      time.Time `json:"end"`
+		}
+		type overlapJSON struct {
+			Event occurrenceJSON `json:"event"`
+			With  occurrenceJSON `json:"with"`
+		}
+		toJSON := func(occ mycal.Occurrence) occurrenceJSON {
+			return occurrenceJSON{occ.Calendar, occ.UID, occ.Summary, occ.Start, occ.End}
+		}
+		list := make([]overlapJSON, 0, len(overlaps))
+		for _, overlap := range overlaps {
+			list = append(list, overlapJSON{toJSON(overlap.Occurrence), toJSON(overlap.With)})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(list); err != nil {
+			RedLine(err)
+		}
+		return
+	}
+	if len(overlaps) == 0 {
+		BlueLine("No conflicts\n")
+		return
+	}
+	for _, overlap := range overlaps {
+		what := overlap.Summary
+		if overlap.Calendar != "" {
+			what += " (" + overlap.Calendar + ")"
+		}
+		fmt.Printf("%s  %s\n", fit(what, 30), describeOverlap(overlap))
+	}
+	BlueLine(fmt.Sprintf("%d conflict(s)\n", len(overlaps)))
+}
+
+// conflictRange parses range of conflicts listing, from is today and to is 30 days after it when empty
+func conflictRange(from, to string) (time.Time, time.Time, error) {
+	now := input.Now()
+	start := startOfDay(now.In(input.Location))
+	var err error
+	if from != "" {
+		if start, err = input.ParseDate(from, now, input.Location); err != nil {
+			return start, start, fmt.Errorf("from: %v", err)
+		}
+	}
+	end := start.AddDate(0, 0, 30)
+	if to != "" {
+		if end, err = input.ParseDate(to, now, input.Location); err != nil {
+			return start, end, fmt.Errorf("to: %v", err)
+		}
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("to must be after from")
+	}
+	return start, end, nil
+}
+
+// ConflictsCommand lists overlapping busy events: conflicts [-calendar names] [-from date] [-to date]
+func ConflictsCommand(url string, args []string, r io.Reader) error {
+	flags := flag.NewFlagSet("conflicts", flag.ContinueOnError)
+	var calendars list
+	flags.Var(&calendars, "calendar", "calendar to check, the -busy ones or all when not set")
+	from := flags.String("from", "", "start of range, e.g. 2024-07-01 or mon; today when not set")
+	to := flags.String("to", "", "end of range, e.g. +1w; 30 days after start when not set")
+	outputFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := checkOutput(); err != nil {
+		return err
+	}
+	start, end, err := conflictRange(*from, *to)
+	if err != nil {
+		return err
+	}
+	if len(calendars) == 0 {
+		calendars = BusyCalendars
+	}
+	httpClient, client, homeset, ctx, err := Login(url, r)
+	if err != nil {
+		return err
+	}
+	return ListConflicts(ctx, httpClient, client, homeset, calendars, start, end)
+}
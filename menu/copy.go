@@ -0,0 +1,32 @@
+package menu
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/trvita/caldav-client/mycal"
+)
+
+// CopyObjects copies or moves objects with uids one by one, failures are printed
+// and don't stop the rest
+func CopyObjects(ctx context.Context, src, dst *mycal.Endpoint, srcCalendar string, uids []string, dstCalendar string, opts mycal.CopyOptions) error {
+	verb := "Copied"
+	if opts.Move {
+		verb = "Moved"
+	}
+	failed := 0
+	for _, uid := range uids {
+		res, err := mycal.CopyObject(ctx, src, dst, srcCalendar, uid, dstCalendar, opts)
+		if err != nil {
+			failed++
+			RedLine(fmt.Errorf("%s: %v", uid, err))
+			continue
+		}
+		BlueLine(fmt.Sprintf("%s %s to %s (%s)\n", verb, uid, res.Destination, strings.ToLower(res.Method)))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects were not %s", failed, len(uids), strings.ToLower(verb))
+	}
+	return nil
+}
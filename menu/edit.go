@@ -0,0 +1,131 @@
+package menu
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+
+	"github.com/trvita/caldav-client/input"
+	"github.com/trvita/caldav-client/mycal"
+)
+
+// errAbandoned is returned when user leaves editor without saving
+var errAbandoned = fmt.Errorf("edit abandoned, nothing was saved")
+
+// editor returns command of $VISUAL or $EDITOR, vi when neither is set
+func editor() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return "vi"
+}
+
+// runEditor opens file in editor on terminal, editor may have arguments such as "code -w"
+func runEditor(path string) error {
+	cmd := exec.Command("sh", "-c", editor()+` "$1"`, "editor", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s: %v", editor(), err)
+	}
+	return nil
+}
+
+func printDiff(lines []string) {
+	for _, line := range lines {
+		switch line[0] {
+		case '-':
+			fmt.Printf("\u001b[31m%s\u001b[0m\n", line)
+		case '+':
+			fmt.Printf("\u001b[32m%s\u001b[0m\n", line)
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
+// EditObject opens object with uid as iCalendar text in $EDITOR, prettified unless raw
+// is set. Text that doesn't parse is opened again, changes are shown as diff and put
+// back only if object wasn't changed on server meanwhile.
+func EditObject(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset, calendarName, uid string, raw, yes bool, r io.Reader) error {
+	found, err := mycal.FindObject(ctx, client, homeset, calendarName, uid)
+	if err != nil {
+		return err
+	}
+	obj, err := mycal.OpenObject(ctx, httpClient, URL, found.Path)
+	if err != nil {
+		return err
+	}
+	text := obj.Data
+	if !raw {
+		if text, err = mycal.PrettyObject(obj.Data); err != nil {
+			return fmt.Errorf("%s: %v", obj.Path, err)
+		}
+	}
+
+	file, err := os.CreateTemp("", "caldav-*.ics")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(text)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := runEditor(file.Name()); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(file.Name())
+		if err != nil {
+			return err
+		}
+		diff := mycal.Diff(string(text), string(edited), 2)
+		if len(diff) == 0 {
+			BlueLine("No changes\n")
+			return nil
+		}
+		cal, err := mycal.CheckObject(edited, uid)
+		if err != nil {
+			RedLine(err)
+			answer, err := input.String(r, "Edit again? [Y/n]: ")
+			if err != nil {
+				return err
+			}
+			if strings.EqualFold(answer, "n") {
+				return errAbandoned
+			}
+			continue
+		}
+		printDiff(diff)
+		if !yes {
+			answer, err := input.String(r, "Save changes? [y/N/e to edit again]: ")
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(answer) {
+			case "e":
+				continue
+			case "y":
+			default:
+				return errAbandoned
+			}
+		}
+		if err := mycal.SaveObject(ctx, httpClient, URL, obj, cal); err != nil {
+			return err
+		}
+		BlueLine(fmt.Sprintf("Saved %s\n", obj.Path))
+		return nil
+	}
+}
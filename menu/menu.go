@@ -2,13 +2,19 @@ package menu
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	webdav "github.com/trvita/caldav-client-yandex"
 	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
 
 	"github.com/trvita/caldav-client/input"
 	"github.com/trvita/caldav-client/mycal"
@@ -47,7 +53,85 @@ func GetUsernameBaikal(homeset string) string {
 	return username
 }
 
+var cache *mycal.Cache
+
+// Cache opens local cache on first use, one in temporary directory is used if it can't be opened
+func Cache() *mycal.Cache {
+	if cache != nil {
+		return cache
+	}
+	dir, err := mycal.DefaultCacheDir()
+	if err == nil {
+		cache, err = mycal.OpenCache(filepath.Join(dir, "cache"))
+	}
+	if err != nil {
+		RedLine(err)
+		dir = filepath.Join(os.TempDir(), "caldav-client-cache")
+		cache, err = mycal.OpenCache(dir)
+	}
+	if err != nil {
+		// temporary cache is unreadable too, empty one replaces it when saved
+		RedLine(err)
+		cache = &mycal.Cache{Dir: dir, Sync: &mycal.SyncStore{Path: filepath.Join(dir, "index.json"), Calendars: make(map[string]*mycal.SyncState)}}
+	}
+	return cache
+}
+
+// CreateEvent uploads event, when server is unreachable it is queued in cache
+func CreateEvent(ctx context.Context, client *caldav.Client, homeset, calendarName string, event *ical.Event) error {
+	err := mycal.CreateEvent(ctx, client, homeset, calendarName, event)
+	if !mycal.IsOffline(err) {
+		return err
+	}
+	err = Cache().QueuePut(homeset, calendarName, event)
+	if err != nil {
+		return err
+	}
+	BlueLine("Server is unreachable, upload queued\n")
+	return nil
+}
+
+// ReplayQueue sends writes made offline and reports conflicts
+func ReplayQueue(ctx context.Context, httpClient webdav.HTTPClient) {
+	if len(Cache().Queue) == 0 {
+		return
+	}
+	conflicts, err := Cache().Replay(ctx, httpClient, URL)
+	if err != nil && !mycal.IsOffline(err) {
+		RedLine(err)
+	}
+	for _, c := range conflicts {
+		RedLine(fmt.Errorf("conflict: %s %s: %s", c.Write.Method, c.Write.Path, c.Reason))
+	}
+}
+
+// Output is format of listings: text, json (flattened events) or jcal
+var Output = "text"
+
 func PrintEvents(resp []caldav.CalendarObject) {
+	switch Output {
+	case "json":
+		cals := make([]*ical.Calendar, 0, len(resp))
+		for _, obj := range resp {
+			cals = append(cals, obj.Data)
+		}
+		if err := mycal.EncodeJSON(os.Stdout, cals...); err != nil {
+			RedLine(err)
+		}
+		return
+	case "jcal":
+		jcal := make([]interface{}, 0, len(resp))
+		for _, obj := range resp {
+			jcal = append(jcal, mycal.JCalComponent(obj.Data.Component))
+		}
+		data, err := json.MarshalIndent(jcal, "", "  ")
+		if err != nil {
+			RedLine(err)
+			return
+		}
+		fmt.Println(string(data))
+		return
+	}
 	for _, calendarObject := range resp {
 		fmt.Printf("path: %s\n", calendarObject.Path)
 		for _, event := range calendarObject.Data.Children {
@@ -60,14 +144,38 @@ func PrintEvents(resp []caldav.CalendarObject) {
 		}
 	}
 }
+
+// Choice reads number of menu item from whole line, anything else is -1 so
+// menu is shown again, end of input is 0 that leaves every menu
+func Choice(r io.Reader) int {
+	str, err := input.String(r, "")
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Plain forces numbered menus even on terminal
+var Plain bool
+
+// StartMenu opens full-screen interface on terminal, numbered menus are
+// used when input is piped or Plain is set
 func StartMenu(url string, r io.Reader) {
+	if f, ok := r.(*os.File); ok && !Plain && isTerminal(f) && isTerminal(os.Stdout) {
+		if err := RunTUI(url); err != nil {
+			RedLine(err)
+		}
+		return
+	}
 	BlueLine("Main menu:\n")
 	for {
 		fmt.Println("1. Log in")
 		fmt.Println("0. Exit")
-		var answer int
-		fmt.Scan(&answer)
-		switch answer {
+		switch Choice(r) {
 		case 1:
 			var httpClient webdav.HTTPClient
 			var client *caldav.Client
@@ -80,8 +188,10 @@ func StartMenu(url string, r io.Reader) {
 					break
 				}
 				BlueLine("Wrong username or password, try again? ([y/n])")
-				var ans string
-				fmt.Scan(&ans)
+				ans, err := input.String(r, "")
+				if err != nil {
+					return
+				}
 				ans = strings.ToLower(ans)
 				if ans == "y" {
 					continue
@@ -114,15 +224,20 @@ func CalendarMenu(httpClient webdav.HTTPClient, client *caldav.Client, principal
 		fmt.Println("3. Create calendar")
 		fmt.Println("4. Check inbox")
 		fmt.Println("5. Delete calendar")
+		fmt.Println("6. Find meeting slot")
+		fmt.Println("7. Show agenda, day, week or month")
+		fmt.Println("8. Change calendar properties")
+		fmt.Println("9. Undo last deletion")
+		fmt.Println("10. List conflicts")
 		fmt.Println("0. Log out")
-		var answer int
-		fmt.Scan(&answer)
-		switch answer {
+		switch Choice(r) {
 		case 1:
-			err := mycal.ListCalendars(ctx, client, homeset)
+			calendars, err := mycal.ListCalendarProps(ctx, httpClient, URL, homeset)
 			if err != nil {
 				RedLine(err)
+				break
 			}
+			PrintCalendars(calendars)
 		case 2:
 			calendarName, err := input.String(r, "Enter calendar name to go to:")
 			if err != nil {
@@ -133,7 +248,7 @@ func CalendarMenu(httpClient webdav.HTTPClient, client *caldav.Client, principal
 				RedLine(err)
 				break
 			}
-			EventMenu(ctx, client, homeset, calendarName, r)
+			EventMenu(ctx, httpClient, client, homeset, calendarName, r)
 		case 3:
 			calendarName, err := input.String(r, "Enter new calendar name: ")
 			if err != nil {
@@ -143,13 +258,23 @@ func CalendarMenu(httpClient webdav.HTTPClient, client *caldav.Client, principal
 			if err != nil {
 				return err
 			}
-			err = mycal.CreateCalendar(ctx, httpClient, URL, homeset, calendarName, description)
+			components, err := input.String(r, "Components [event,todo,journal], empty for all: ")
+			if err != nil {
+				return err
+			}
+			comps, err := parseComponents(components)
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			err = mycal.MakeCalendar(ctx, httpClient, URL, homeset, calendarName,
+				&mycal.CalendarProps{DisplayName: calendarName, Description: description, Components: comps})
 			if err != nil {
 				return err
 			}
 			BlueLine("Calendar " + calendarName + " created\n")
 		case 4:
-			err := InboxMenu(ctx, client, homeset, "inbox", r)
+			err := InboxMenu(ctx, httpClient, client, homeset, "inbox", r)
 			if err != nil {
 				return err
 			}
@@ -158,12 +283,78 @@ func CalendarMenu(httpClient webdav.HTTPClient, client *caldav.Client, principal
 			if err != nil {
 				return err
 			}
-			err = mycal.Delete(ctx, client, homeset+calendarName)
+			again, err := input.String(r, "All events of "+calendarName+" are deleted too, type its name again to confirm: ")
+			if err != nil {
+				return err
+			}
+			if again != calendarName {
+				BlueLine("Nothing deleted\n")
+				break
+			}
+			items, err := mycal.DeleteCalendar(ctx, httpClient, client, URL, homeset, calendarName, Trash())
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			NotifyCancelled(trashCalendars(items), "")
+			BlueLine(fmt.Sprintf("Calendar %s deleted with %d object(s), undo brings it back\n", calendarName, len(items)-1))
+		case 6:
+			err := MeetingMenu(ctx, httpClient, client, homeset, r)
+			if err != nil {
+				RedLine(err)
+			}
+		case 7:
+			kind, err := input.String(r, "View [agenda/day/week/month]: ")
+			if err != nil {
+				return err
+			}
+			date, err := input.String(r, "Date (e.g. 2024-07-01, next mon), empty for today: ")
+			if err != nil {
+				return err
+			}
+			day := input.Now().In(input.Location)
+			if date != "" {
+				if day, err = input.ParseDate(date, input.Now(), input.Location); err != nil {
+					RedLine(err)
+					break
+				}
+			}
+			err = ShowView(ctx, httpClient, client, homeset, os.Stdout, kind, nil, day, 7)
+			if err != nil {
+				RedLine(err)
+			}
+		case 8:
+			calendarName, err := input.String(r, "Enter calendar name to change: ")
+			if err != nil {
+				return err
+			}
+			err = ChangeCalendar(ctx, httpClient, homeset, calendarName, r)
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			BlueLine("Calendar " + calendarName + " changed\n")
+		case 9:
+			if err := Undo(ctx, httpClient); err != nil {
+				RedLine(err)
+			}
+		case 10:
+			from, err := input.String(r, "From (e.g. 2024-07-01, mon), empty for today: ")
+			if err != nil {
+				return err
+			}
+			to, err := input.String(r, "To (e.g. +1w), empty for 30 days: ")
+			if err != nil {
+				return err
+			}
+			start, end, err := conflictRange(from, to)
 			if err != nil {
 				RedLine(err)
 				break
 			}
-			BlueLine("Calendar " + calendarName + " deleted\n")
+			if err := ListConflicts(ctx, httpClient, client, homeset, BusyCalendars, start, end); err != nil {
+				RedLine(err)
+			}
 		case 0:
 			BlueLine("Logging out...\n")
 			return nil
@@ -171,32 +362,40 @@ func CalendarMenu(httpClient webdav.HTTPClient, client *caldav.Client, principal
 	}
 }
 
-func EventMenu(ctx context.Context, client *caldav.Client, homeset string, calendarName string, r io.Reader) {
+func EventMenu(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset string, calendarName string, r io.Reader) {
 	BlueLine("Current calendar: " + calendarName + "\n")
+	ReplayQueue(ctx, httpClient)
 	for {
 		fmt.Println("1. List events")
 		fmt.Println("2. Create event")
 		fmt.Println("3. Create recurrent event")
 		fmt.Println("4. Find events by time range")
 		fmt.Println("5. Delete event")
+		fmt.Println("6. Check attendees of my events")
+		fmt.Println("7. Sync changes")
+		fmt.Println("8. Search events")
+		fmt.Println("9. Import events from .ics file")
+		fmt.Println("10. Edit event as iCalendar text")
+		fmt.Println("11. Copy or move event to another calendar")
+		fmt.Println("12. Undo last deletion")
+		fmt.Println("13. Change many events at once")
 		fmt.Println("0. Back to calendar menu")
-		var answer int
-		fmt.Scan(&answer)
-		switch answer {
+		switch Choice(r) {
 		// list events
 		case 1:
-			BlueLine(calendarName + " EVENTS:\n")
-			resp, err := mycal.GetEvents(ctx, client, homeset, calendarName)
+			ReplayQueue(ctx, httpClient)
+			resp, offline, err := mycal.CachedObjects(ctx, httpClient, client, URL, homeset, calendarName, Cache())
 			if err != nil {
 				RedLine(err)
+				break
 			}
-			PrintEvents(resp)
-			BlueLine(calendarName + " TODOS:\n")
-			resp, err = mycal.ListTodos(ctx, client, homeset, calendarName)
-			if err != nil {
-				RedLine(err)
+			if offline {
+				BlueLine("Server is unreachable, showing cached data\n")
 			}
-			PrintEvents(resp)
+			BlueLine(calendarName + " EVENTS:\n")
+			PrintEvents(mycal.FilterComponents(resp, ical.CompEvent))
+			BlueLine(calendarName + " TODOS:\n")
+			PrintEvents(mycal.FilterComponents(resp, ical.CompToDo))
 			// create event or todo
 		case 2:
 			newEvent, err := input.Event(r)
@@ -211,7 +410,7 @@ func EventMenu(ctx context.Context, client *caldav.Client, homeset string, calen
 					RedLine(err)
 					break
 				}
-				err = mycal.CreateEvent(ctx, client, homeset, calendarName, todo)
+				err = CreateEvent(ctx, client, homeset, calendarName, todo)
 				if err != nil {
 					RedLine(err)
 					break
@@ -223,12 +422,18 @@ func EventMenu(ctx context.Context, client *caldav.Client, homeset string, calen
 					RedLine(err)
 					break
 				}
-				err = mycal.CreateEvent(ctx, client, homeset, calendarName, event)
+				ok, err := ConfirmConflicts(ctx, httpClient, client, homeset, eventCalendar(event), "Create anyway?", r)
+				if err != nil || !ok {
+					BlueLine("Event not created\n")
+					break
+				}
+				err = CreateEvent(ctx, client, homeset, calendarName, event)
 				if err != nil {
 					RedLine(err)
 					break
 				}
 				BlueLine("Event created\n")
+				NotifyExternal(event.Component, newEvent.Organizer)
 			}
 		case 3:
 			newRecEvent, err := input.RecurrentEvent(r)
@@ -237,12 +442,18 @@ func EventMenu(ctx context.Context, client *caldav.Client, homeset string, calen
 				break
 			}
 			recEvent := mycal.GetRecurrentEvent(newRecEvent)
-			err = mycal.CreateEvent(ctx, client, homeset, calendarName, recEvent)
+			ok, err := ConfirmConflicts(ctx, httpClient, client, homeset, eventCalendar(recEvent), "Create anyway?", r)
+			if err != nil || !ok {
+				BlueLine("Event not created\n")
+				break
+			}
+			err = CreateEvent(ctx, client, homeset, calendarName, recEvent)
 			if err != nil {
 				RedLine(err)
 				break
 			}
 			BlueLine("Recurrent event created\n")
+			NotifyExternal(recEvent.Component, newRecEvent.Event.Organizer)
 		case 4:
 			// var startDateTime, endDateTime time.Time
 			// var err error
@@ -287,17 +498,139 @@ func EventMenu(ctx context.Context, client *caldav.Client, homeset string, calen
 			// 	RedLine(err)
 			// }
 		case 5:
-			eventUID, err := input.String(r, "Enter event path to delete (without .ics): ")
+			text, err := input.String(r, "Enter UID or text of event to delete: ")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			objects, err := FindToDelete(ctx, httpClient, client, homeset, calendarName, text, r)
+			if mycal.IsOffline(err) {
+				err = queueDelete(homeset+calendarName+"/", text, r)
+			} else if err == nil {
+				err = DeleteFound(ctx, httpClient, objects, false, r)
+			}
+			if err != nil {
+				RedLine(err)
+			}
+		case 6:
+			email, err := input.String(r, "Enter your email: ")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			err = AttendeesReport(ctx, client, homeset, calendarName, email)
+			if err != nil {
+				RedLine(err)
+			}
+		case 7:
+			err := SyncChanges(ctx, httpClient, client, homeset, calendarName)
+			if err != nil {
+				RedLine(err)
+			}
+		case 8:
+			text, err := input.String(r, "Enter text to search: ")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			props, err := mycal.GetCalendarProps(ctx, httpClient, URL, homeset, calendarName)
+			if err == nil {
+				var results []mycal.SearchResult
+				results, err = mycal.Search(ctx, httpClient, URL, []mycal.CalendarProps{*props}, &mycal.SearchQuery{Text: text})
+				if err == nil {
+					PrintSearchResults(results)
+					break
+				}
+			}
+			if !mycal.IsOffline(err) {
+				RedLine(err)
+				break
+			}
+			// cache is searched when offline
+			BlueLine("Server is unreachable, searching cached data\n")
+			resp, err := Cache().Search(homeset+calendarName, text)
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			PrintEvents(resp)
+		case 9:
+			filename, err := input.String(r, "Enter path to .ics file: ")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			modeName, err := input.String(r, "Existing UIDs [skip/overwrite/newuid]: ")
 			if err != nil {
 				RedLine(err)
 				break
 			}
-			err = mycal.Delete(ctx, client, homeset+calendarName+"/"+eventUID+".ics")
+			mode, err := mycal.ParseImportMode(modeName)
 			if err != nil {
 				RedLine(err)
 				break
 			}
-			BlueLine("Event deleted\n")
+			cals, err := ReadCalendarFile(filename, r)
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			err = ImportCalendars(ctx, httpClient, client, homeset, calendarName, cals, mode)
+			if err != nil {
+				RedLine(err)
+			}
+		// edit as iCalendar text
+		case 10:
+			uid, err := input.String(r, "Enter event UID: ")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			err = EditObject(ctx, httpClient, client, homeset, calendarName, uid, false, false, r)
+			if err != nil {
+				RedLine(err)
+			}
+		// copy or move to another calendar
+		case 11:
+			uid, err := input.String(r, "Enter event UID: ")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			target, err := input.String(r, "Enter destination calendar name: ")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			answer, err := input.String(r, "Move instead of copy? [y/N]: ")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			end := &mycal.Endpoint{HTTPClient: httpClient, Client: client, URL: URL, Homeset: homeset}
+			opts := mycal.CopyOptions{Move: strings.EqualFold(answer, "y")}
+			_, err = mycal.CopyObject(ctx, end, end, calendarName, uid, target, opts)
+			if errors.Is(err, mycal.ErrUIDExists) {
+				answer, err = input.String(r, "Calendar "+target+" already has this event, replace it? [y/N]: ")
+				if err != nil || !strings.EqualFold(answer, "y") {
+					break
+				}
+				opts.Overwrite = true
+				_, err = mycal.CopyObject(ctx, end, end, calendarName, uid, target, opts)
+			}
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			BlueLine("Event " + uid + " is in calendar " + target + "\n")
+		case 12:
+			if err := Undo(ctx, httpClient); err != nil {
+				RedLine(err)
+			}
+		case 13:
+			if err := BulkMenu(ctx, httpClient, client, homeset, calendarName, r); err != nil {
+				RedLine(err)
+			}
 		// go back
 		case 0:
 			BlueLine("Returning to calendar menu...\n")
@@ -306,39 +639,130 @@ func EventMenu(ctx context.Context, client *caldav.Client, homeset string, calen
 	}
 }
 
-func InboxMenu(ctx context.Context, client *caldav.Client, homeset string, calendarName string, r io.Reader) error {
+func PrintInvitations(invitations []mycal.Invitation) {
+	for i, inv := range invitations {
+		fmt.Printf("%d. %s\n", i+1, inv.Summary)
+		fmt.Printf("   organizer: %s\n", inv.Organizer)
+		fmt.Printf("   time: %s - %s\n", inv.Start.Format("2006.01.02 15:04"), inv.End.Format("2006.01.02 15:04"))
+		if inv.Location != "" {
+			fmt.Printf("   location: %s\n", inv.Location)
+		}
+		partstat := inv.PartStat
+		if partstat == "" {
+			partstat = "NEEDS-ACTION"
+		}
+		fmt.Printf("   your status: %s\n", partstat)
+		for _, c := range inv.Conflicts {
+			RedLine(fmt.Errorf("   conflicts with %s - %s", c.Start.In(inv.Start.Location()).Format("2006.01.02 15:04"), c.End.In(inv.Start.Location()).Format("15:04")))
+		}
+	}
+}
+
+func ProcessInbox(ctx context.Context, client *caldav.Client, homeset, email string) {
+	applied, err := mycal.ProcessInbox(ctx, client, homeset, email)
+	if err != nil {
+		RedLine(err)
+	}
+	for _, inv := range applied {
+		if inv.Outdated {
+			BlueLine(fmt.Sprintf("Removed outdated %s for %s\n", strings.ToLower(inv.Method), inv.Summary))
+			continue
+		}
+		BlueLine(fmt.Sprintf("Applied %s for %s\n", strings.ToLower(inv.Method), inv.Summary))
+	}
+}
+
+func InboxMenu(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset string, calendarName string, r io.Reader) error {
 	fmt.Println("Current calendar: ", calendarName)
+	email, err := input.String(r, "Enter your email: ")
+	if err != nil {
+		return err
+	}
+	ProcessInbox(ctx, client, homeset, email)
 	for {
-		fmt.Println("1. List events")
-		fmt.Println("2. Accept/decline event")
+		fmt.Println("1. List pending invitations")
+		fmt.Println("2. Answer invitation")
 		fmt.Println("3. Update event")
+		fmt.Println("4. List all inbox items")
+		fmt.Println("5. Import email replies (.eml/mbox)")
 		fmt.Println("0. Return to calendar menu")
 
-		var answer int
-		fmt.Scan(&answer)
-		switch answer {
+		switch Choice(r) {
 		case 1:
-			resp, err := mycal.GetEvents(ctx, client, homeset, "inbox")
+			ProcessInbox(ctx, client, homeset, email)
+			invitations, err := mycal.PendingInvitations(ctx, client, homeset, email)
 			if err != nil {
-				return err
+				RedLine(err)
+				break
 			}
-			PrintEvents(resp)
+			if len(invitations) == 0 {
+				BlueLine("No pending invitations\n")
+			}
+			PrintInvitations(invitations)
 		case 2:
-			eventUID, err := input.String(r, "Enter event UID:  ")
+			invitations, err := mycal.PendingInvitations(ctx, client, homeset, email)
 			if err != nil {
-				return err
+				RedLine(err)
+				break
 			}
-			eventPath, err := input.String(r, "Enter filename (without .ics) of event: ")
-			if err != nil {
-				return err
+			if len(invitations) == 0 {
+				BlueLine("No pending invitations\n")
+				break
 			}
-			mods, err := input.Modifications(r)
+			PrintInvitations(invitations)
+			n, err := input.Int(r, "Enter invitation number: ")
 			if err != nil {
 				return err
 			}
-			err = mycal.ModifyAttendance(ctx, client, homeset, calendarName, eventUID, eventPath, mods)
-			if err != nil {
-				return err
+			if n < 1 || n > len(invitations) {
+				RedLine(fmt.Errorf("no invitation %d", n))
+				break
+			}
+			inv := invitations[n-1]
+			// unknown answer is asked again
+			for {
+				action, err := input.String(r, "Accept, tentatively accept, decline, delegate, counter? [y, t, n, d, c]: ")
+				if err != nil {
+					return err
+				}
+				if action == "c" {
+					start, end, comment, err := input.Counter(r)
+					if err != nil {
+						return err
+					}
+					err = mycal.CounterInvitation(ctx, httpClient, URL, homeset, &inv, email, start, end, comment)
+					if err != nil {
+						RedLine(err)
+						break
+					}
+					BlueLine("Counter proposal sent\n")
+					break
+				}
+				if action == "y" || action == "t" {
+					ok, err := ConfirmConflicts(ctx, httpClient, client, homeset, inv.Data, "Accept anyway?", r)
+					if err != nil {
+						return err
+					}
+					if !ok {
+						BlueLine("Invitation not answered\n")
+						break
+					}
+				}
+				mods, err := input.Modifications(r, email, action)
+				if errors.Is(err, input.ErrUnknownAnswer) {
+					RedLine(err)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				err = mycal.ModifyAttendance(ctx, httpClient, client, URL, homeset, "inbox", inv.Uid, inv.FileName(), mods)
+				if err != nil {
+					RedLine(err)
+					break
+				}
+				BlueLine("Invitation answered: " + strings.ToLower(mods.PartStat) + "\n")
+				break
 			}
 		case 3:
 			eventUID, err := input.String(r, "Enter event UID:  ")
@@ -357,9 +781,242 @@ func InboxMenu(ctx context.Context, client *caldav.Client, homeset string, calen
 			if err != nil {
 				return err
 			}
+		case 4:
+			resp, err := mycal.GetEvents(ctx, client, homeset, "inbox")
+			if err != nil {
+				RedLine(err)
+				break
+			}
+			PrintEvents(resp)
+		case 5:
+			filename, err := input.String(r, "Enter path to .eml or mbox file: ")
+			if err != nil {
+				return err
+			}
+			importCalendarName, err := input.String(r, "Enter calendar name for new events: ")
+			if err != nil {
+				return err
+			}
+			err = ImportEmail(ctx, httpClient, client, homeset, importCalendarName, filename)
+			if err != nil {
+				RedLine(err)
+			}
 		case 0:
 			return nil
 		}
 
 	}
 }
+
+// NotifyExternal emails invitation to attendees outside of CalDAV server if SMTP is configured
+func NotifyExternal(event *ical.Component, organizer string) {
+	cfg := mycal.SMTPConfigFromEnv()
+	if cfg == nil || len(event.Props.Values(ical.PropAttendee)) == 0 {
+		return
+	}
+	if cfg.From == "" {
+		cfg.From = organizer
+	}
+	msg := mycal.ITIPRequest(event)
+	recipients := cfg.ExternalRecipients(msg, organizer)
+	err := mycal.SendIMIP(cfg, msg, recipients)
+	if err != nil {
+		RedLine(err)
+		return
+	}
+	if len(recipients) > 0 {
+		BlueLine("Invitation emailed to " + strings.Join(recipients, ", ") + "\n")
+	}
+}
+
+// ownAddress is user's address, the given one or CALDAV_SMTP_FROM
+func ownAddress(cfg *mycal.SMTPConfig, me string) string {
+	if me == "" {
+		me = cfg.From
+	}
+	if cfg.From == "" {
+		cfg.From = me
+	}
+	return me
+}
+
+// NotifyCancelled emails cancellation of deleted events organized by user to attendees
+// outside of CalDAV server if SMTP is configured, me is user's address
+func NotifyCancelled(cals []*ical.Calendar, me string) {
+	cfg := mycal.SMTPConfigFromEnv()
+	if cfg == nil {
+		return
+	}
+	if me = ownAddress(cfg, me); me == "" {
+		return
+	}
+	for _, cal := range cals {
+		for _, event := range mycal.OrganizedBy(cal, me) {
+			msg := mycal.ITIPCancel(event)
+			recipients := cfg.ExternalRecipients(msg, me)
+			if err := mycal.SendIMIP(cfg, msg, recipients); err != nil {
+				RedLine(err)
+				continue
+			}
+			if len(recipients) > 0 {
+				BlueLine("Cancellation emailed to " + strings.Join(recipients, ", ") + "\n")
+			}
+		}
+	}
+}
+
+// NotifyAdded emails invitation to attendee added to events organized by user when
+// attendee is outside of CalDAV server
+func NotifyAdded(cals []*ical.Calendar, attendee, me string) {
+	cfg := mycal.SMTPConfigFromEnv()
+	if cfg == nil || !cfg.IsExternal(attendee) {
+		return
+	}
+	if me = ownAddress(cfg, me); me == "" {
+		return
+	}
+	for _, cal := range cals {
+		for _, event := range mycal.OrganizedBy(cal, me) {
+			if err := mycal.SendIMIP(cfg, mycal.ITIPRequest(event), []string{attendee}); err != nil {
+				RedLine(err)
+				return
+			}
+			BlueLine("Invitation emailed to " + attendee + "\n")
+		}
+	}
+}
+
+// trashCalendars decodes objects of trash items, calendar-only items have none
+func trashCalendars(items []mycal.TrashItem) []*ical.Calendar {
+	var cals []*ical.Calendar
+	for _, item := range items {
+		if item.Data == "" {
+			continue
+		}
+		if cal, err := ical.NewDecoder(strings.NewReader(item.Data)).Decode(); err == nil {
+			cals = append(cals, cal)
+		}
+	}
+	return cals
+}
+
+func ImportEmail(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset, calendarName, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	messages, err := mycal.ReadIMIP(f)
+	if err != nil {
+		return err
+	}
+	// messages that failed are reported after the applied ones are counted
+	applied, err := mycal.IngestIMIP(ctx, httpClient, client, URL, homeset, calendarName, messages)
+	BlueLine(fmt.Sprintf("Applied %d of %d calendar messages\n", len(applied), len(messages)))
+	return err
+}
+
+func MeetingMenu(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset string, r io.Reader) error {
+	meeting, err := input.Meeting(r)
+	if err != nil {
+		return err
+	}
+	slots, err := mycal.FindMeetingSlots(ctx, httpClient, client, URL, homeset, meeting)
+	if err != nil {
+		return err
+	}
+	if len(slots) == 0 {
+		BlueLine("No common free slots found\n")
+		return nil
+	}
+	for i, slot := range slots {
+		start := slot.Start.In(meeting.Options.Location)
+		end := slot.End.In(meeting.Options.Location)
+		fmt.Printf("%d. %s - %s\n", i+1, start.Format("2006.01.02 15:04"), end.Format("15:04 MST"))
+	}
+	choice, err := input.Int(r, "Choose slot to book (0 to skip): ")
+	if err != nil {
+		return err
+	}
+	if choice < 1 || choice > len(slots) {
+		return nil
+	}
+	calendarName, err := input.String(r, "Enter calendar name to put event in: ")
+	if err != nil {
+		return err
+	}
+	event, err := mycal.GetEvent(mycal.MeetingEvent(meeting, slots[choice-1]))
+	if err != nil {
+		return err
+	}
+	err = CreateEvent(ctx, client, homeset, calendarName, event)
+	if err != nil {
+		return err
+	}
+	BlueLine("Event created\n")
+	NotifyExternal(event.Component, meeting.Organizer)
+	return nil
+}
+
+func AttendeesReport(ctx context.Context, client *caldav.Client, homeset, calendarName, email string) error {
+	events, err := mycal.OrganizedEvents(ctx, client, homeset, calendarName, email)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		BlueLine("No events organized by " + email + "\n")
+		return nil
+	}
+	for _, event := range events {
+		uid, err := event.Props.Text(ical.PropUID)
+		if err != nil {
+			return err
+		}
+		summary, err := event.Props.Text(ical.PropSummary)
+		if err != nil {
+			return err
+		}
+		statuses, err := mycal.LookUpAttendees(ctx, client, homeset, calendarName, uid)
+		if err != nil {
+			RedLine(err)
+			if statuses == nil {
+				continue
+			}
+		}
+		BlueLine(summary + " (" + uid + ")\n")
+		groups := mycal.SummarizeAttendees(statuses)
+		for _, group := range []string{"accepted", "tentative", "declined", "delegated", "no response"} {
+			fmt.Printf("  %s: %d %s\n", group, len(groups[group]), strings.Join(groups[group], ", "))
+		}
+		for _, status := range statuses {
+			if status.ScheduleStatus != "" && !strings.HasPrefix(status.ScheduleStatus, "1.") && !strings.HasPrefix(status.ScheduleStatus, "2.") {
+				RedLine(fmt.Errorf("  delivery to %s failed: %s", status.Email, status.ScheduleStatus))
+			}
+		}
+	}
+	return nil
+}
+
+func SyncChanges(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset, calendarName string) error {
+	dir, err := mycal.DefaultCacheDir()
+	if err != nil {
+		return err
+	}
+	store, err := mycal.LoadSyncStore(filepath.Join(dir, "sync.json"))
+	if err != nil {
+		return err
+	}
+	result, err := mycal.SyncCalendar(ctx, httpClient, client, URL, homeset, calendarName, store.State(homeset+calendarName))
+	if err != nil {
+		return err
+	}
+	if err := store.Save(); err != nil {
+		return err
+	}
+	BlueLine(fmt.Sprintf("%d changed, %d deleted\n", len(result.Changed), len(result.Deleted)))
+	PrintEvents(result.Changed)
+	for _, path := range result.Deleted {
+		fmt.Printf("deleted: %s\n", path)
+	}
+	return nil
+}
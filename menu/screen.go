@@ -0,0 +1,156 @@
+package menu
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// keys that are not printable start with NUL so typed text can't look like them,
+// printable input is the text itself, pasted text comes as one key
+const (
+	keyUp        = "\x00up"
+	keyDown      = "\x00down"
+	keyLeft      = "\x00left"
+	keyRight     = "\x00right"
+	keyHome      = "\x00home"
+	keyEnd       = "\x00end"
+	keyPageUp    = "\x00pgup"
+	keyPageDown  = "\x00pgdown"
+	keyEnter     = "\x00enter"
+	keyEsc       = "\x00esc"
+	keyTab       = "\x00tab"
+	keyShiftTab  = "\x00shift-tab"
+	keyBackspace = "\x00backspace"
+	keyDelete    = "\x00delete"
+	keyCtrlC     = "\x00ctrl-c"
+	keyCtrlS     = "\x00ctrl-s"
+)
+
+func isText(key string) bool {
+	return key != "" && key[0] != 0
+}
+
+var escapeKeys = map[string]string{
+	"[A": keyUp, "[B": keyDown, "[C": keyRight, "[D": keyLeft,
+	"OA": keyUp, "OB": keyDown, "OC": keyRight, "OD": keyLeft,
+	"[H": keyHome, "[F": keyEnd, "[1~": keyHome, "[4~": keyEnd,
+	"[5~": keyPageUp, "[6~": keyPageDown, "[3~": keyDelete, "[Z": keyShiftTab,
+}
+
+// screen is terminal in raw mode on alternate buffer
+type screen struct {
+	in    *os.File
+	out   *bufio.Writer
+	state *term.State
+}
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+func openScreen() (*screen, error) {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	s := &screen{in: os.Stdin, out: bufio.NewWriter(os.Stdout), state: state}
+	// alternate buffer, hidden cursor
+	s.out.WriteString("\u001b[?1049h\u001b[?25l")
+	return s, s.out.Flush()
+}
+
+func (s *screen) close() {
+	s.out.WriteString("\u001b[?25h\u001b[?1049l")
+	s.out.Flush()
+	term.Restore(int(s.in.Fd()), s.state)
+}
+
+func (s *screen) size() (int, int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// readKey reads one key press, escape sequences come in one read
+func (s *screen) readKey() (string, error) {
+	buf := make([]byte, 16)
+	n, err := s.in.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	seq := string(buf[:n])
+	switch seq {
+	case "\r", "\n":
+		return keyEnter, nil
+	case "\u001b":
+		return keyEsc, nil
+	case "\t":
+		return keyTab, nil
+	case "\u007f", "\b":
+		return keyBackspace, nil
+	case "\u0003":
+		return keyCtrlC, nil
+	case "\u0013":
+		return keyCtrlS, nil
+	}
+	if strings.HasPrefix(seq, "\u001b") {
+		if key, ok := escapeKeys[seq[1:]]; ok {
+			return key, nil
+		}
+		return keyEsc, nil
+	}
+	// other control characters are dropped, line breaks of pasted text too
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == '\u007f' {
+			return -1
+		}
+		return r
+	}, seq), nil
+}
+
+// draw replaces screen with lines, lines longer than width are cut
+func (s *screen) draw(lines []string) error {
+	width, height := s.size()
+	s.out.WriteString("\u001b[H")
+	for i := 0; i < height; i++ {
+		if i < len(lines) {
+			s.out.WriteString(cut(lines[i], width))
+		}
+		s.out.WriteString("\u001b[0m\u001b[K")
+		if i < height-1 {
+			s.out.WriteString("\r\n")
+		}
+	}
+	return s.out.Flush()
+}
+
+// cut shortens line to width visible runes, escape codes are kept
+func cut(line string, width int) string {
+	var b strings.Builder
+	visible := 0
+	for i := 0; i < len(line); {
+		if line[i] == '\u001b' {
+			end := strings.IndexByte(line[i:], 'm')
+			if end < 0 {
+				break
+			}
+			b.WriteString(line[i : i+end+1])
+			i += end + 1
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if visible == width {
+			break
+		}
+		b.WriteRune(r)
+		visible++
+		i += size
+	}
+	return b.String()
+}
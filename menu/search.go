@@ -0,0 +1,89 @@
+package menu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+
+	"github.com/trvita/caldav-client/input"
+	"github.com/trvita/caldav-client/mycal"
+)
+
+var componentNames = map[string]string{"event": ical.CompEvent, "todo": ical.CompToDo, "journal": ical.CompJournal}
+
+var collationNames = map[string]string{"ascii": mycal.CollationASCII, "octet": mycal.CollationOctet, "unicode": mycal.CollationUnicode}
+
+// searchQuery builds query from command line words, fields and types are
+// written in lower case without V, collation by short name
+func searchQuery(text string, fields, types []string, collation, from, to, status string) (*mycal.SearchQuery, error) {
+	q := &mycal.SearchQuery{Text: text, Status: strings.ToUpper(status)}
+	for _, field := range fields {
+		q.Fields = append(q.Fields, strings.ToUpper(field))
+	}
+	for _, typ := range types {
+		name, ok := componentNames[strings.ToLower(typ)]
+		if !ok {
+			name = strings.ToUpper(typ)
+		}
+		q.Components = append(q.Components, name)
+	}
+	q.Collation = collation
+	if full, ok := collationNames[collation]; ok {
+		q.Collation = full
+	}
+	var err error
+	now := input.Now()
+	if from != "" {
+		if q.Start, err = input.ParseDate(from, now, input.Location); err != nil {
+			return nil, fmt.Errorf("from: %v", err)
+		}
+	}
+	if to != "" {
+		if q.End, err = input.ParseDate(to, now, input.Location); err != nil {
+			return nil, fmt.Errorf("to: %v", err)
+		}
+	}
+	return q, q.Check()
+}
+
+// PrintSearchResults prints one line per matching component, json and jcal
+// output prints whole objects
+func PrintSearchResults(results []mycal.SearchResult) {
+	if Output != "text" {
+		objects := make([]caldav.CalendarObject, 0, len(results))
+		for _, res := range results {
+			objects = append(objects, res.Object)
+		}
+		PrintEvents(objects)
+		return
+	}
+	if len(results) == 0 {
+		BlueLine("Nothing found\n")
+		return
+	}
+	for _, res := range results {
+		for _, comp := range res.Object.Data.Children {
+			if !contains(mycal.ObjectComponents, comp.Name) {
+				continue
+			}
+			event, err := mycal.EventFromComponent(comp)
+			if err != nil {
+				RedLine(err)
+				continue
+			}
+			when := event.DateTimeStart
+			if when.IsZero() {
+				when = event.DateTimeEnd
+			}
+			date := strings.Repeat(" ", len("2006-01-02 15:04"))
+			if !when.IsZero() {
+				date = when.In(input.Location).Format("2006-01-02 15:04")
+			}
+			kind := strings.ToLower(strings.TrimPrefix(comp.Name, "V"))
+			fmt.Printf("%s  %-7s %-12s %s  %s\n", date, kind, fit(res.Calendar, 12), event.Summary, event.Uid)
+		}
+		fmt.Printf("  %s\n", res.Object.Path)
+	}
+}
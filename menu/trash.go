@@ -0,0 +1,180 @@
+package menu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+
+	"github.com/trvita/caldav-client/input"
+	"github.com/trvita/caldav-client/mycal"
+)
+
+var trash *mycal.Trash
+
+// Trash keeps deleted objects next to cache
+func Trash() *mycal.Trash {
+	if trash != nil {
+		return trash
+	}
+	dir, err := mycal.DefaultCacheDir()
+	if err != nil {
+		RedLine(err)
+		dir = filepath.Join(os.TempDir(), "caldav-client")
+	}
+	trash = &mycal.Trash{Dir: filepath.Join(dir, "trash")}
+	return trash
+}
+
+// describeObject is summary and start of first event, todo or journal of object
+func describeObject(obj caldav.CalendarObject) string {
+	for _, comp := range obj.Data.Children {
+		if !contains(mycal.ObjectComponents, comp.Name) {
+			continue
+		}
+		event, err := mycal.EventFromComponent(comp)
+		if err != nil {
+			break
+		}
+		if event.DateTimeStart.IsZero() {
+			return event.Summary
+		}
+		return event.Summary + " " + event.DateTimeStart.In(input.Location).Format("2006-01-02 15:04")
+	}
+	return obj.Path
+}
+
+// FindToDelete resolves UID of object in calendar, or in every calendar when name is
+// empty, to its real href. Text that isn't UID is searched for and found objects
+// are offered to choose from.
+func FindToDelete(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset, calendarName, text string, r io.Reader) ([]caldav.CalendarObject, error) {
+	obj, err := mycal.FindObject(ctx, client, homeset, calendarName, text)
+	if err == nil {
+		return []caldav.CalendarObject{*obj}, nil
+	}
+	if !errors.Is(err, mycal.ErrNotFound) {
+		return nil, err
+	}
+	var names []string
+	if calendarName != "" {
+		names = append(names, calendarName)
+	}
+	calendars, err := selectCalendars(ctx, httpClient, homeset, names)
+	if err != nil {
+		return nil, err
+	}
+	results, err := mycal.Search(ctx, httpClient, URL, calendars, &mycal.SearchQuery{Text: text})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("nothing found by UID or text %s", text)
+	}
+	for i, res := range results {
+		fmt.Printf("%d. %s (%s)\n", i+1, describeObject(res.Object), res.Calendar)
+	}
+	numbers, err := input.Ints(r, "Numbers of objects to delete, e.g. 1,3: ")
+	if err != nil {
+		return nil, err
+	}
+	var objects []caldav.CalendarObject
+	for _, n := range numbers {
+		if n < 1 || n > len(results) {
+			return nil, fmt.Errorf("no object with number %d", n)
+		}
+		objects = append(objects, results[n-1].Object)
+	}
+	return objects, nil
+}
+
+// DeleteFound asks before deleting objects, they are saved to trash first
+func DeleteFound(ctx context.Context, httpClient webdav.HTTPClient, objects []caldav.CalendarObject, yes bool, r io.Reader) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	paths := make([]string, len(objects))
+	for i, obj := range objects {
+		paths[i] = obj.Path
+		fmt.Printf("  %s  %s\n", describeObject(obj), obj.Path)
+	}
+	if !yes {
+		answer, err := input.String(r, fmt.Sprintf("Delete %d object(s)? [y/N]: ", len(objects)))
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(answer, "y") {
+			BlueLine("Nothing deleted\n")
+			return nil
+		}
+	}
+	deleted, err := mycal.DeleteObjects(ctx, httpClient, URL, paths, Trash())
+	if len(deleted) > 0 {
+		BlueLine(fmt.Sprintf("Deleted %d object(s), undo brings them back\n", len(deleted)))
+		NotifyCancelled(trashCalendars(deleted), "")
+	}
+	return err
+}
+
+// queueDelete finds object of calendar by UID in cache and queues its deletion
+// until server is reachable again
+func queueDelete(calendarPath, uid string, r io.Reader) error {
+	objects, err := Cache().Objects(calendarPath)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if !mycal.HasUID(obj.Data, uid) {
+			continue
+		}
+		answer, err := input.String(r, fmt.Sprintf("Server is unreachable, queue deletion of %s? [y/N]: ", describeObject(obj)))
+		if err != nil || !strings.EqualFold(answer, "y") {
+			return err
+		}
+		if err := Cache().QueueDelete(obj.Path); err != nil {
+			return err
+		}
+		BlueLine("Deletion queued\n")
+		return nil
+	}
+	return fmt.Errorf("server is unreachable and no cached object has UID %s", uid)
+}
+
+// undoLast restores objects deleted last, calendar deletion is undone as a whole
+func undoLast(ctx context.Context, httpClient webdav.HTTPClient) (int, error) {
+	items, err := Trash().LastBatch()
+	if err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, fmt.Errorf("trash is empty, nothing to undo")
+	}
+	return mycal.RestoreItems(ctx, httpClient, URL, items, Trash())
+}
+
+func Undo(ctx context.Context, httpClient webdav.HTTPClient) error {
+	n, err := undoLast(ctx, httpClient)
+	if n > 0 {
+		BlueLine(fmt.Sprintf("Restored %d item(s)\n", n))
+	}
+	return err
+}
+
+func PrintTrash(items []mycal.TrashItem) {
+	if len(items) == 0 {
+		BlueLine("Trash is empty\n")
+		return
+	}
+	for _, item := range items {
+		what := item.Summary
+		if item.Calendar != nil {
+			what += dim + " (calendar " + item.Calendar.Name + ")" + reset
+		}
+		fmt.Printf("%s  %s  %s  %s\n", item.ID, item.Deleted.In(input.Location).Format("2006-01-02 15:04"), fit(item.UID, 20), what)
+	}
+}
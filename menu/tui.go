@@ -0,0 +1,1015 @@
+package menu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+
+	"github.com/trvita/caldav-client/input"
+	"github.com/trvita/caldav-client/mycal"
+)
+
+// view is one screen of full-screen interface, views are kept in stack and
+// Esc returns to previous one
+type view interface {
+	title() string
+	lines(t *TUI, width, height int) []string
+	help() string
+	key(t *TUI, key string) error
+}
+
+// TUI is full-screen interface over the same mycal calls as numbered menus
+type TUI struct {
+	url        string
+	ctx        context.Context
+	httpClient webdav.HTTPClient
+	client     *caldav.Client
+	homeset    string
+	username   string
+	email      string
+
+	screen    *screen
+	stack     []view
+	status    string
+	statusErr bool
+	quit      bool
+}
+
+const formTimeLayout = "2006-01-02 15:04"
+
+// RunTUI logs in and shows calendars, credentials are taken from
+// CALDAV_USERNAME and CALDAV_PASSWORD or asked for in form
+func RunTUI(url string) error {
+	scr, err := openScreen()
+	if err != nil {
+		return err
+	}
+	defer scr.close()
+	t := &TUI{url: url, screen: scr}
+	if username := os.Getenv("CALDAV_USERNAME"); username != "" {
+		if err := t.login(username, os.Getenv("CALDAV_PASSWORD")); err != nil {
+			t.fail(err)
+		}
+	}
+	if len(t.stack) == 0 {
+		t.push(loginForm(t))
+	}
+	for !t.quit && len(t.stack) > 0 {
+		if err := t.render(); err != nil {
+			return err
+		}
+		key, err := scr.readKey()
+		if err != nil {
+			return err
+		}
+		if key == keyCtrlC {
+			return nil
+		}
+		if key == "" {
+			continue
+		}
+		t.status = ""
+		if err := t.top().key(t, key); err != nil {
+			t.fail(err)
+		}
+	}
+	return nil
+}
+
+func (t *TUI) login(username, password string) error {
+	httpClient, client, principal, ctx, err := mycal.CreateClient(t.url, strings.NewReader(username+"\n"+password+"\n"))
+	if err != nil {
+		return err
+	}
+	homeset, err := client.FindCalendarHomeSet(ctx, principal)
+	if err != nil {
+		return err
+	}
+	t.httpClient, t.client, t.homeset, t.ctx, t.username = httpClient, client, homeset, ctx, username
+	if strings.Contains(username, "@") {
+		t.email = username
+	}
+	calendars := &calendarsView{}
+	if err := calendars.load(t); err != nil {
+		return err
+	}
+	t.stack = []view{calendars}
+	t.replay()
+	return nil
+}
+
+// replay sends writes queued while server was unreachable
+func (t *TUI) replay() {
+	if len(Cache().Queue) == 0 {
+		return
+	}
+	conflicts, err := Cache().Replay(t.ctx, t.httpClient, URL)
+	switch {
+	case err != nil:
+		t.fail(err)
+	case len(conflicts) > 0:
+		t.fail(fmt.Errorf("%d queued changes conflict with server", len(conflicts)))
+	default:
+		t.info("Queued changes sent")
+	}
+}
+
+func (t *TUI) top() view {
+	return t.stack[len(t.stack)-1]
+}
+
+func (t *TUI) push(v view) {
+	t.stack = append(t.stack, v)
+}
+
+func (t *TUI) pop() {
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// remove takes v out of stack wherever it is, views above it stay
+func (t *TUI) remove(v view) {
+	for i := range t.stack {
+		if t.stack[i] == v {
+			t.stack = append(t.stack[:i], t.stack[i+1:]...)
+			return
+		}
+	}
+}
+
+func (t *TUI) info(msg string) {
+	t.status, t.statusErr = msg, false
+}
+
+func (t *TUI) fail(err error) {
+	t.status, t.statusErr = err.Error(), true
+}
+
+func (t *TUI) render() error {
+	width, height := t.screen.size()
+	var titles []string
+	for _, v := range t.stack {
+		if title := v.title(); title != "" {
+			titles = append(titles, title)
+		}
+	}
+	lines := []string{"\u001b[7m" + fit(" "+strings.Join(titles, " › "), width) + reset}
+	body := t.top().lines(t, width, height-3)
+	for i := 0; i < height-3; i++ {
+		if i < len(body) {
+			lines = append(lines, body[i])
+		} else {
+			lines = append(lines, "")
+		}
+	}
+	status := t.status
+	if t.statusErr {
+		status = "\u001b[31m" + status + reset
+	} else if status != "" {
+		status = "\u001b[34m" + status + reset
+	}
+	lines = append(lines, status, dim+t.top().help()+reset)
+	return t.screen.draw(lines)
+}
+
+// selection keeps cursor of list views and scrolls it into sight
+type selection struct {
+	sel, offset int
+}
+
+func (l *selection) move(key string, n int) bool {
+	switch key {
+	case keyUp, "k":
+		l.sel--
+	case keyDown, "j":
+		l.sel++
+	case keyPageUp:
+		l.sel -= 10
+	case keyPageDown:
+		l.sel += 10
+	case keyHome:
+		l.sel = 0
+	case keyEnd:
+		l.sel = n - 1
+	default:
+		return false
+	}
+	l.clamp(n)
+	return true
+}
+
+func (l *selection) clamp(n int) {
+	if l.sel >= n {
+		l.sel = n - 1
+	}
+	if l.sel < 0 {
+		l.sel = 0
+	}
+}
+
+func (l *selection) render(items []string, width, height int) []string {
+	if len(items) == 0 {
+		return []string{dim + "  (empty)" + reset}
+	}
+	if l.sel < l.offset {
+		l.offset = l.sel
+	}
+	if l.sel >= l.offset+height {
+		l.offset = l.sel - height + 1
+	}
+	var lines []string
+	for i := l.offset; i < len(items) && i < l.offset+height; i++ {
+		if i == l.sel {
+			lines = append(lines, "\u001b[7m"+fit(stripEscapes(items[i]), width)+reset)
+		} else {
+			lines = append(lines, items[i])
+		}
+	}
+	return lines
+}
+
+func stripEscapes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\u001b' {
+			if end := strings.IndexByte(s[i:], 'm'); end >= 0 {
+				i += end
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+type calendarsView struct {
+	selection
+	calendars []mycal.CalendarProps
+}
+
+func (v *calendarsView) load(t *TUI) error {
+	calendars, err := mycal.ListCalendarProps(t.ctx, t.httpClient, URL, t.homeset)
+	if err != nil {
+		return err
+	}
+	sortCalendars(calendars)
+	v.calendars = calendars
+	v.clamp(len(calendars))
+	return nil
+}
+
+func (v *calendarsView) title() string { return "Calendars" }
+
+func (v *calendarsView) help() string {
+	return "enter open  n new  p properties  d delete  u undo  i inbox  a agenda  w week  m month  r reload  q quit"
+}
+
+func (v *calendarsView) lines(t *TUI, width, height int) []string {
+	items := make([]string, len(v.calendars))
+	for i := range v.calendars {
+		props := &v.calendars[i]
+		color := colorOf(&mycal.Occurrence{Calendar: props.Name, Color: props.Color})
+		name := props.DisplayName
+		if name == "" {
+			name = props.Name
+		}
+		items[i] = fmt.Sprintf(" %s●%s %s %s%s %s%s", color, reset, fit(name, 24), dim, props.Name, props.Description, reset)
+	}
+	return v.render(items, width, height)
+}
+
+func (v *calendarsView) key(t *TUI, key string) error {
+	if v.move(key, len(v.calendars)) {
+		return nil
+	}
+	selected := func() *mycal.CalendarProps {
+		if len(v.calendars) == 0 {
+			return nil
+		}
+		return &v.calendars[v.sel]
+	}
+	switch key {
+	case "q", keyEsc:
+		t.quit = true
+	case "r":
+		return v.load(t)
+	case keyEnter, keyRight:
+		if props := selected(); props != nil {
+			events := &eventsView{calendar: props.Name}
+			if err := events.load(t); err != nil {
+				return err
+			}
+			t.push(events)
+		}
+	case "n":
+		t.push(&formView{
+			heading: "New calendar",
+			fields: []formField{{label: "Name"}, {label: "Description"},
+				{label: "Components", hint: "event,todo,journal, empty for all"}},
+			submit: func(values []string) error {
+				if values[0] == "" {
+					return fmt.Errorf("name is required")
+				}
+				comps, err := parseComponents(values[2])
+				if err != nil {
+					return err
+				}
+				err = mycal.MakeCalendar(t.ctx, t.httpClient, URL, t.homeset, values[0],
+					&mycal.CalendarProps{DisplayName: values[0], Description: values[1], Components: comps})
+				if err != nil {
+					return err
+				}
+				t.info("Calendar " + values[0] + " created")
+				return v.load(t)
+			},
+		})
+	case "p":
+		if props := selected(); props != nil {
+			current := calendarFields(props)
+			fields := make([]formField, len(current))
+			for i, field := range current {
+				fields[i] = formField{label: field[0], value: field[1], hint: "empty removes"}
+			}
+			fields[len(fields)-1].hint = "event,todo,journal"
+			t.push(&formView{
+				heading: "Properties of " + props.Name,
+				fields:  fields,
+				submit: func(values []string) error {
+					changes := &mycal.CalendarChanges{}
+					for i, field := range current {
+						if values[i] == field[1] {
+							continue
+						}
+						if err := setCalendarChange(changes, field[0], values[i]); err != nil {
+							return fmt.Errorf("%s: %v", field[0], err)
+						}
+					}
+					if err := mycal.UpdateCalendar(t.ctx, t.httpClient, URL, t.homeset, props.Name, changes); err != nil {
+						return err
+					}
+					t.info("Calendar " + props.Name + " changed")
+					return v.load(t)
+				},
+			})
+		}
+	case "d":
+		if props := selected(); props != nil {
+			t.push(&confirmView{under: v, message: "Delete calendar " + props.Name + " with all its events?", yes: func() error {
+				items, err := mycal.DeleteCalendar(t.ctx, t.httpClient, t.client, URL, t.homeset, props.Name, Trash())
+				if err != nil {
+					return err
+				}
+				NotifyCancelled(trashCalendars(items), t.email)
+				t.info("Calendar " + props.Name + " deleted, u brings it back")
+				return v.load(t)
+			}})
+		}
+	case "u":
+		return undoTUI(t, v)
+	case "i":
+		return openInbox(t)
+	case "a", "w", "m":
+		kind := map[string]string{"a": "agenda", "w": "week", "m": "month"}[key]
+		var buf bytes.Buffer
+		if err := ShowView(t.ctx, t.httpClient, t.client, t.homeset, &buf, kind, nil, input.Now().In(input.Location), 14); err != nil {
+			return err
+		}
+		t.push(&textView{heading: strings.ToUpper(kind[:1]) + kind[1:], text: strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")})
+	}
+	return nil
+}
+
+// eventItem is event or todo of calendar object, overridden instances are shown with their master
+type eventItem struct {
+	obj   caldav.CalendarObject
+	comp  *ical.Component
+	event *mycal.Event
+}
+
+type eventsView struct {
+	selection
+	calendar string
+	items    []eventItem
+}
+
+func (v *eventsView) load(t *TUI) error {
+	objects, offline, err := mycal.CachedObjects(t.ctx, t.httpClient, t.client, URL, t.homeset, v.calendar, Cache())
+	if err != nil {
+		return err
+	}
+	if offline {
+		t.info("Server is unreachable, showing cached data")
+	}
+	v.items = nil
+	for _, obj := range objects {
+		for _, comp := range obj.Data.Children {
+			if comp.Name != ical.CompEvent && comp.Name != ical.CompToDo || comp.Props.Get(ical.PropRecurrenceID) != nil {
+				continue
+			}
+			event, err := mycal.EventFromComponent(comp)
+			if err != nil {
+				return fmt.Errorf("%s: %v", obj.Path, err)
+			}
+			v.items = append(v.items, eventItem{obj: obj, comp: comp, event: event})
+		}
+	}
+	sort.SliceStable(v.items, func(i, j int) bool {
+		return v.items[i].event.DateTimeStart.Before(v.items[j].event.DateTimeStart)
+	})
+	v.clamp(len(v.items))
+	return nil
+}
+
+func (v *eventsView) title() string { return v.calendar }
+
+func (v *eventsView) help() string {
+	return "enter details  n new  e edit  c copy  m move  d delete  u undo  r reload  esc back"
+}
+
+func (v *eventsView) lines(t *TUI, width, height int) []string {
+	items := make([]string, len(v.items))
+	for i, item := range v.items {
+		when := item.event.DateTimeStart
+		if item.comp.Name == ical.CompToDo {
+			when = item.event.DateTimeEnd
+		}
+		date := "                "
+		if !when.IsZero() {
+			date = formatFormTime(when)
+		}
+		kind := "     "
+		if item.comp.Name == ical.CompToDo {
+			kind = "todo "
+		}
+		if item.comp.Props.Get(ical.PropRecurrenceRule) != nil {
+			kind = "rec  "
+		}
+		line := fmt.Sprintf(" %s  %s%s%s %s", date, dim, kind, reset, item.event.Summary)
+		if item.event.Location != "" {
+			line += dim + " @ " + item.event.Location + reset
+		}
+		items[i] = line
+	}
+	return v.render(items, width, height)
+}
+
+func (v *eventsView) key(t *TUI, key string) error {
+	if v.move(key, len(v.items)) {
+		return nil
+	}
+	var item *eventItem
+	if len(v.items) > 0 {
+		item = &v.items[v.sel]
+	}
+	switch key {
+	case keyEsc, keyLeft, "q":
+		t.pop()
+	case "r":
+		return v.load(t)
+	case keyEnter, keyRight:
+		if item != nil {
+			t.push(&textView{heading: item.event.Summary, text: componentText(item.obj.Data)})
+		}
+	case "n":
+		t.push(eventForm(t, v, nil))
+	case "e":
+		if item != nil {
+			t.push(eventForm(t, v, item))
+		}
+	case "u":
+		return undoTUI(t, v)
+	case "c", "m":
+		if item != nil {
+			opts := mycal.CopyOptions{Move: key == "m"}
+			verb, done := "Copy", "Copied"
+			if opts.Move {
+				verb, done = "Move", "Moved"
+			}
+			t.push(&formView{
+				heading: verb + " " + item.event.Summary,
+				fields:  []formField{{label: "To calendar"}, {label: "Overwrite", value: "no", hint: "yes replaces event with the same UID"}},
+				submit: func(values []string) error {
+					opts.Overwrite = strings.EqualFold(values[1], "yes")
+					end := &mycal.Endpoint{HTTPClient: t.httpClient, Client: t.client, URL: URL, Homeset: t.homeset}
+					res, err := mycal.CopyObject(t.ctx, end, end, v.calendar, item.event.Uid, values[0], opts)
+					if err != nil {
+						return err
+					}
+					t.info(done + " to " + res.Destination)
+					return v.load(t)
+				},
+			})
+		}
+	case "d":
+		if item != nil {
+			t.push(&confirmView{under: v, message: "Delete " + item.event.Summary + "?", yes: func() error {
+				deleted, err := mycal.DeleteObjects(t.ctx, t.httpClient, URL, []string{item.obj.Path}, Trash())
+				NotifyCancelled(trashCalendars(deleted), t.email)
+				if mycal.IsOffline(err) {
+					err = Cache().QueueDelete(item.obj.Path)
+					if err == nil {
+						t.info("Server is unreachable, deletion queued")
+					}
+				} else if err == nil {
+					t.info("Deleted " + item.event.Summary + ", u brings it back")
+				}
+				if err != nil {
+					return err
+				}
+				return v.load(t)
+			}})
+		}
+	}
+	return nil
+}
+
+// undoTUI restores objects deleted last and reloads view
+func undoTUI(t *TUI, v interface{ load(t *TUI) error }) error {
+	n, err := undoLast(t.ctx, t.httpClient)
+	if n > 0 {
+		t.info(fmt.Sprintf("Restored %d item(s)", n))
+		if err == nil {
+			err = v.load(t)
+		}
+	}
+	return err
+}
+
+// componentText lists properties of every component like PrintEvents does
+func componentText(cal *ical.Calendar) []string {
+	var text []string
+	var walk func(comp *ical.Component, indent string)
+	walk = func(comp *ical.Component, indent string) {
+		text = append(text, indent+bold+comp.Name+reset)
+		names := make([]string, 0, len(comp.Props))
+		for name := range comp.Props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, prop := range comp.Props[name] {
+				text = append(text, fmt.Sprintf("%s  %s%s:%s %s", indent, dim, name, reset, prop.Value))
+			}
+		}
+		for _, child := range comp.Children {
+			walk(child, indent+"  ")
+		}
+	}
+	for _, comp := range cal.Children {
+		walk(comp, "")
+	}
+	return text
+}
+
+func parseFormTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return input.ParseDate(value, input.Now(), input.Location)
+}
+
+// parseFormEnd also takes duration after start such as "for 45m"
+func parseFormEnd(value string, start time.Time) (time.Time, error) {
+	if value == "" || start.IsZero() {
+		return parseFormTime(value)
+	}
+	return input.ParseEnd(value, start, input.Now(), input.Location)
+}
+
+func formatFormTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(input.Location).Format(formTimeLayout)
+}
+
+// eventForm creates new event or todo, or edits item when it is given
+func eventForm(t *TUI, events *eventsView, item *eventItem) *formView {
+	fields := []formField{{label: "Type", value: "event", hint: "event or todo"}, {label: "Summary"},
+		{label: "Start", hint: "2024-07-01 10:00, tomorrow 10am"}, {label: "End/due", hint: "11:00, for 45m"}, {label: "Location"},
+		{label: "Attendees", hint: "emails separated by commas"}}
+	heading := "New event"
+	if item != nil {
+		heading = "Edit " + item.event.Summary
+		kind := "event"
+		if item.comp.Name == ical.CompToDo {
+			kind = "todo"
+		}
+		fields = []formField{{label: "Type", value: kind, readonly: true}, {label: "Summary", value: item.event.Summary},
+			{label: "Start", value: formatFormTime(item.event.DateTimeStart), hint: "2024-07-01 10:00, tomorrow 10am"},
+			{label: "End/due", value: formatFormTime(item.event.DateTimeEnd), hint: "11:00, for 45m"},
+			{label: "Location", value: item.event.Location}}
+	}
+	// conflicts are shown once for given times, submitting them again creates event
+	warned := ""
+	return &formView{heading: heading, fields: fields, submit: func(values []string) error {
+		start, err := parseFormTime(values[2])
+		if err != nil {
+			return fmt.Errorf("start: %v", err)
+		}
+		end, err := parseFormEnd(values[3], start)
+		if err != nil {
+			return fmt.Errorf("end: %v", err)
+		}
+		if values[1] == "" {
+			return fmt.Errorf("summary is required")
+		}
+		todo := strings.EqualFold(values[0], "todo")
+		if !todo && !strings.EqualFold(values[0], "event") {
+			return fmt.Errorf("type must be event or todo")
+		}
+		if !todo && (start.IsZero() || end.IsZero() || end.Before(start)) {
+			return fmt.Errorf("event needs start and end after it")
+		}
+		if todo && end.IsZero() {
+			return fmt.Errorf("todo needs due")
+		}
+		if item != nil {
+			err = updateItem(t, item, values[1], start, end, values[4])
+		} else {
+			times := values[2] + "|" + values[3]
+			err = createItem(t, events.calendar, todo, values[1], start, end, values[4], values[5], warned == times)
+			if errors.Is(err, errOverlaps) {
+				warned = times
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return events.load(t)
+	}}
+}
+
+// createItem uploads new event or todo, events that overlap busy ones are refused
+// unless force is set
+func createItem(t *TUI, calendarName string, todo bool, summary string, start, end time.Time, location, attendees string, force bool) error {
+	newEvent := &mycal.Event{
+		Name:          ical.CompEvent,
+		Uid:           uuid.New().String(),
+		Summary:       summary,
+		DateTimeStart: start.UTC(),
+		DateTimeEnd:   end.UTC(),
+		Location:      location,
+		Organizer:     t.email,
+	}
+	for _, attendee := range strings.Split(attendees, ",") {
+		if attendee = strings.TrimSpace(attendee); attendee != "" {
+			newEvent.Attendees = append(newEvent.Attendees, attendee)
+		}
+	}
+	var event *ical.Event
+	var err error
+	if todo {
+		newEvent.Name = ical.CompToDo
+		event, err = mycal.GetTodo(newEvent)
+	} else {
+		event, err = mycal.GetEvent(newEvent)
+	}
+	if err != nil {
+		return err
+	}
+	if !todo && !force {
+		if overlaps, err := findOverlaps(t.ctx, t.httpClient, t.client, t.homeset, eventCalendar(event)); err == nil && len(overlaps) > 0 {
+			return overlapsError(overlaps)
+		}
+	}
+	if err := CreateEvent(t.ctx, t.client, t.homeset, calendarName, event); err != nil {
+		return err
+	}
+	t.info("Created " + summary)
+	if !todo {
+		NotifyExternal(event.Component, newEvent.Organizer)
+	}
+	return nil
+}
+
+func updateItem(t *TUI, item *eventItem, summary string, start, end time.Time, location string) error {
+	comp := item.comp
+	comp.Props.SetText(ical.PropSummary, summary)
+	if start.IsZero() {
+		comp.Props.Del(ical.PropDateTimeStart)
+	} else {
+		comp.Props.SetDateTime(ical.PropDateTimeStart, start.UTC())
+	}
+	if comp.Name == ical.CompToDo {
+		comp.Props.SetDateTime(ical.PropDue, end.UTC())
+	} else {
+		comp.Props.Del(ical.PropDuration)
+		comp.Props.SetDateTime(ical.PropDateTimeEnd, end.UTC())
+	}
+	if location == "" {
+		comp.Props.Del(ical.PropLocation)
+	} else {
+		comp.Props.SetText(ical.PropLocation, location)
+	}
+	mycal.IncrementSequence(comp)
+	comp.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	comp.Props.SetDateTime(ical.PropLastModified, time.Now().UTC())
+	if err := mycal.UpdateObject(t.ctx, t.httpClient, URL, &item.obj); err != nil {
+		return fmt.Errorf("%s: %w", summary, err)
+	}
+	t.info("Saved " + summary)
+	return nil
+}
+
+// openInbox asks for email once, invitations are matched by it
+func openInbox(t *TUI) error {
+	if t.email != "" {
+		inbox := &inboxView{}
+		if err := inbox.load(t); err != nil {
+			return err
+		}
+		t.push(inbox)
+		return nil
+	}
+	t.push(&formView{heading: "Inbox", fields: []formField{{label: "Your email"}}, submit: func(values []string) error {
+		if !strings.Contains(values[0], "@") {
+			return fmt.Errorf("email is required")
+		}
+		t.email = values[0]
+		return openInbox(t)
+	}})
+	return nil
+}
+
+type inboxView struct {
+	selection
+	invitations []mycal.Invitation
+}
+
+func (v *inboxView) load(t *TUI) error {
+	// items that can't be applied stay in inbox, they don't keep it from loading
+	if _, err := mycal.ProcessInbox(t.ctx, t.client, t.homeset, t.email); err != nil {
+		t.fail(err)
+	}
+	invitations, err := mycal.PendingInvitations(t.ctx, t.client, t.homeset, t.email)
+	if err != nil {
+		return err
+	}
+	v.invitations = invitations
+	v.clamp(len(invitations))
+	return nil
+}
+
+func (v *inboxView) title() string { return "Inbox" }
+
+func (v *inboxView) help() string {
+	return "enter details  a accept  t tentative  x decline  r reload  esc back"
+}
+
+func (v *inboxView) lines(t *TUI, width, height int) []string {
+	items := make([]string, len(v.invitations))
+	for i, inv := range v.invitations {
+		line := fmt.Sprintf(" %s  %s  %s %sfrom %s%s", fit(inv.Method, 7), formatFormTime(inv.Start), inv.Summary,
+			dim, strings.TrimPrefix(inv.Organizer, "mailto:"), reset)
+		if len(inv.Conflicts) > 0 {
+			line += " \u001b[31mconflict" + reset
+		}
+		items[i] = line
+	}
+	return v.render(items, width, height)
+}
+
+func (v *inboxView) key(t *TUI, key string) error {
+	if v.move(key, len(v.invitations)) {
+		return nil
+	}
+	if len(v.invitations) == 0 {
+		switch key {
+		case keyEsc, keyLeft, "q":
+			t.pop()
+		case "r":
+			return v.load(t)
+		}
+		return nil
+	}
+	inv := v.invitations[v.sel]
+	partstat := map[string]string{"a": "ACCEPTED", "t": "TENTATIVE", "x": "DECLINED"}[key]
+	switch {
+	case key == keyEsc || key == keyLeft || key == "q":
+		t.pop()
+	case key == "r":
+		return v.load(t)
+	case key == keyEnter || key == keyRight:
+		t.push(&textView{heading: inv.Summary, text: componentText(inv.Data)})
+	case partstat != "":
+		warned := partstat == "DECLINED"
+		t.push(&formView{
+			heading: strings.ToLower(partstat) + " " + inv.Summary,
+			fields:  []formField{{label: "Calendar", value: "default", hint: "calendar event goes to"}},
+			submit: func(values []string) error {
+				if !warned {
+					warned = true
+					if overlaps, err := findOverlaps(t.ctx, t.httpClient, t.client, t.homeset, inv.Data); err == nil && len(overlaps) > 0 {
+						return overlapsError(overlaps)
+					}
+				}
+				mods := &mycal.Modifications{Email: t.email, PartStat: partstat, CalendarName: values[0], LastModified: time.Now()}
+				if err := mycal.ModifyAttendance(t.ctx, t.httpClient, t.client, URL, t.homeset, "inbox", inv.Uid, inv.FileName(), mods); err != nil {
+					return err
+				}
+				t.info("Invitation answered: " + strings.ToLower(partstat))
+				return v.load(t)
+			},
+		})
+	}
+	return nil
+}
+
+type formField struct {
+	label, value, hint string
+	secret, readonly   bool
+}
+
+// formView edits fields in place, enter on last field or ctrl-s submits
+type formView struct {
+	heading string
+	fields  []formField
+	sel     int
+	submit  func(values []string) error
+}
+
+// loginForm replaces whole stack with calendars once server accepts credentials
+func loginForm(t *TUI) *formView {
+	return &formView{
+		heading: "Log in",
+		fields:  []formField{{label: "Username"}, {label: "Password", secret: true}},
+		submit: func(values []string) error {
+			return t.login(values[0], values[1])
+		},
+	}
+}
+
+func (f *formView) title() string { return f.heading }
+
+func (f *formView) help() string {
+	return "tab/↓ next field  ↑ previous  enter next or save  ctrl-s save  esc cancel"
+}
+
+func (f *formView) lines(t *TUI, width, height int) []string {
+	lines := []string{""}
+	for i, field := range f.fields {
+		value := field.value
+		if field.secret {
+			value = strings.Repeat("*", len([]rune(value)))
+		}
+		label := fit(field.label, 12)
+		switch {
+		case i == f.sel:
+			lines = append(lines, fmt.Sprintf("  %s%s%s \u001b[4m%s\u001b[0m█ %s%s%s", bold, label, reset, value, dim, field.hint, reset))
+		case field.readonly:
+			lines = append(lines, fmt.Sprintf("  %s %s%s%s", label, dim, value, reset))
+		default:
+			lines = append(lines, fmt.Sprintf("  %s %s", label, value))
+		}
+	}
+	return lines
+}
+
+func (f *formView) next(step int) {
+	for i := 0; i < len(f.fields); i++ {
+		f.sel = (f.sel + step + len(f.fields)) % len(f.fields)
+		if !f.fields[f.sel].readonly {
+			return
+		}
+	}
+}
+
+func (f *formView) key(t *TUI, key string) error {
+	if f.fields[f.sel].readonly {
+		f.next(1)
+	}
+	field := &f.fields[f.sel]
+	switch key {
+	case keyEsc:
+		t.remove(f)
+	case keyTab, keyDown:
+		f.next(1)
+	case keyShiftTab, keyUp:
+		f.next(-1)
+	case keyBackspace:
+		if runes := []rune(field.value); len(runes) > 0 {
+			field.value = string(runes[:len(runes)-1])
+		}
+	case keyEnter, keyCtrlS:
+		last := true
+		for i := f.sel + 1; i < len(f.fields); i++ {
+			if !f.fields[i].readonly {
+				last = false
+			}
+		}
+		if key == keyEnter && !last {
+			f.next(1)
+			return nil
+		}
+		values := make([]string, len(f.fields))
+		for i := range f.fields {
+			values[i] = f.fields[i].value
+			if !f.fields[i].secret {
+				values[i] = strings.TrimSpace(values[i])
+			}
+		}
+		if err := f.submit(values); err != nil {
+			return err
+		}
+		t.remove(f)
+	default:
+		if isText(key) {
+			field.value += key
+		}
+	}
+	return nil
+}
+
+// confirmView asks before view under it does something that can't be undone
+type confirmView struct {
+	under   view
+	message string
+	yes     func() error
+}
+
+func (c *confirmView) title() string { return "" }
+
+func (c *confirmView) help() string { return "y yes  any other key no" }
+
+func (c *confirmView) lines(t *TUI, width, height int) []string {
+	lines := c.under.lines(t, width, height)
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	text := " " + c.message + " [y/N] "
+	inner := len([]rune(text))
+	if inner > width-4 {
+		inner = width - 4
+	}
+	pad := strings.Repeat(" ", (width-inner-2)/2)
+	box := []string{
+		pad + "┌" + strings.Repeat("─", inner) + "┐",
+		pad + "│" + bold + fit(text, inner) + reset + "│",
+		pad + "└" + strings.Repeat("─", inner) + "┘",
+	}
+	top := (height - len(box)) / 2
+	for i, line := range box {
+		lines[top+i] = line
+	}
+	return lines
+}
+
+func (c *confirmView) key(t *TUI, key string) error {
+	t.remove(c)
+	if key == "y" || key == "Y" {
+		return c.yes()
+	}
+	t.info("Cancelled")
+	return nil
+}
+
+// textView shows scrollable text such as details or agenda
+type textView struct {
+	heading string
+	text    []string
+	offset  int
+}
+
+func (v *textView) title() string { return v.heading }
+
+func (v *textView) help() string { return "↑/↓ scroll  esc back" }
+
+func (v *textView) lines(t *TUI, width, height int) []string {
+	if v.offset > len(v.text)-height {
+		v.offset = len(v.text) - height
+	}
+	if v.offset < 0 {
+		v.offset = 0
+	}
+	end := v.offset + height
+	if end > len(v.text) {
+		end = len(v.text)
+	}
+	return v.text[v.offset:end]
+}
+
+func (v *textView) key(t *TUI, key string) error {
+	switch key {
+	case keyUp, "k":
+		v.offset--
+	case keyDown, "j":
+		v.offset++
+	case keyPageUp:
+		v.offset -= 10
+	case keyPageDown, " ":
+		v.offset += 10
+	case keyEsc, keyLeft, "q", keyEnter:
+		t.pop()
+	}
+	return nil
+}
@@ -0,0 +1,361 @@
+package menu
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"golang.org/x/term"
+
+	"github.com/trvita/caldav-client/mycal"
+)
+
+const (
+	reset = "\u001b[0m"
+	bold  = "\u001b[1m"
+	dim   = "\u001b[2m"
+)
+
+// calendars without color get one of these by their name
+var palette = []string{"\u001b[34m", "\u001b[32m", "\u001b[35m", "\u001b[36m", "\u001b[33m", "\u001b[31m"}
+
+// colorOf converts calendar color #RRGGBB[AA] to terminal escape code
+func colorOf(occ *mycal.Occurrence) string {
+	hex := strings.TrimPrefix(occ.Color, "#")
+	if len(hex) >= 6 {
+		if rgb, err := strconv.ParseUint(hex[:6], 16, 32); err == nil {
+			return fmt.Sprintf("\u001b[38;2;%d;%d;%dm", rgb>>16, rgb>>8&0xff, rgb&0xff)
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(occ.Calendar))
+	return palette[h.Sum32()%uint32(len(palette))]
+}
+
+// fit pads or cuts s to width runes, escape codes must be added after
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		return string([]rune(s)[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+func terminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns monday of week with t
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// timeLabel shows part of occurrence that falls on day
+func timeLabel(occ *mycal.Occurrence, day time.Time) string {
+	next := day.AddDate(0, 0, 1)
+	if occ.AllDay || !occ.Start.After(day) && !occ.End.Before(next) {
+		return "all day"
+	}
+	from, to := "", ""
+	if !occ.Start.Before(day) {
+		from = occ.Start.Format("15:04")
+	}
+	if occ.End.Before(next) {
+		to = occ.End.Format("15:04")
+	}
+	return from + "-" + to
+}
+
+// RenderAgenda lists occurrences day by day, days without events are skipped
+func RenderAgenda(w io.Writer, occs []mycal.Occurrence, start, end time.Time) {
+	empty := true
+	for day := startOfDay(start); day.Before(end); day = day.AddDate(0, 0, 1) {
+		found := mycal.OccurrencesBetween(occs, day, day.AddDate(0, 0, 1))
+		if len(found) == 0 {
+			continue
+		}
+		empty = false
+		fmt.Fprintf(w, "%s%s%s\n", bold, day.Format("Monday, 02 January 2006"), reset)
+		for i := range found {
+			occ := &found[i]
+			line := fmt.Sprintf("  %s  %s●%s %s", fit(timeLabel(occ, day), 11), colorOf(occ), reset, occ.Summary)
+			if occ.Location != "" {
+				line += " @ " + occ.Location
+			}
+			fmt.Fprintf(w, "%s %s[%s]%s\n", line, dim, occ.Calendar, reset)
+		}
+		fmt.Fprintln(w)
+	}
+	if empty {
+		fmt.Fprintln(w, "No events")
+	}
+}
+
+// visibleHours widens working hours to hours of timed events of days
+func visibleHours(occs []mycal.Occurrence, from, to time.Time) (int, int) {
+	first, last := 8, 18
+	for _, occ := range occs {
+		if occ.AllDay || occ.Start.Before(from) || !occ.Start.Before(to) {
+			continue
+		}
+		if occ.Start.Hour() < first {
+			first = occ.Start.Hour()
+		}
+		end := occ.End
+		if end.After(startOfDay(occ.Start).AddDate(0, 0, 1)) {
+			end = startOfDay(occ.Start).AddDate(0, 0, 1).Add(-time.Minute)
+		}
+		if end.Hour() >= last {
+			last = end.Hour() + 1
+		}
+	}
+	return first, last
+}
+
+// slotCell shows first occurrence of slot, events started earlier are shown as bar
+func slotCell(occs []mycal.Occurrence, slot time.Time, width int) string {
+	var timed []mycal.Occurrence
+	for _, occ := range mycal.OccurrencesBetween(occs, slot, slot.Add(time.Hour)) {
+		if !occ.AllDay {
+			timed = append(timed, occ)
+		}
+	}
+	if len(timed) == 0 {
+		return strings.Repeat(" ", width)
+	}
+	occ := &timed[0]
+	text := "┃"
+	if !occ.Start.Before(slot) || slot.Hour() == 0 {
+		text = occ.Start.Format("15:04") + " " + occ.Summary
+	}
+	if len(timed) > 1 {
+		more := fmt.Sprintf(" +%d", len(timed)-1)
+		return colorOf(occ) + fit(text, width-len(more)) + reset + more
+	}
+	return colorOf(occ) + fit(text, width) + reset
+}
+
+func allDayCell(occs []mycal.Occurrence, day time.Time, width int) string {
+	var all []mycal.Occurrence
+	for _, occ := range mycal.OccurrencesBetween(occs, day, day.AddDate(0, 0, 1)) {
+		if timeLabel(&occ, day) == "all day" {
+			all = append(all, occ)
+		}
+	}
+	if len(all) == 0 {
+		return strings.Repeat(" ", width)
+	}
+	text := all[0].Summary
+	if len(all) > 1 {
+		text = fmt.Sprintf("%s +%d", text, len(all)-1)
+	}
+	return colorOf(&all[0]) + fit(text, width) + reset
+}
+
+// RenderDay draws hours of day with events in them
+func RenderDay(w io.Writer, occs []mycal.Occurrence, day time.Time) {
+	day = startOfDay(day)
+	next := day.AddDate(0, 0, 1)
+	occs = mycal.OccurrencesBetween(occs, day, next)
+	width := terminalWidth() - 8
+	fmt.Fprintf(w, "%s%s%s\n", bold, day.Format("Monday, 02 January 2006"), reset)
+	for _, occ := range occs {
+		if timeLabel(&occ, day) == "all day" {
+			fmt.Fprintf(w, "all day %s%s%s\n", colorOf(&occ), fit(occ.Summary, width), reset)
+		}
+	}
+	first, last := visibleHours(occs, day, next)
+	for hour := first; hour < last; hour++ {
+		slot := day.Add(time.Duration(hour) * time.Hour)
+		var cells []string
+		for _, occ := range mycal.OccurrencesBetween(occs, slot, slot.Add(time.Hour)) {
+			if occ.AllDay {
+				continue
+			}
+			text := "┃ " + occ.Summary
+			if !occ.Start.Before(slot) || hour == first {
+				text = "● " + timeLabel(&occ, day) + " " + occ.Summary
+			}
+			cells = append(cells, colorOf(&occ)+text+reset)
+		}
+		fmt.Fprintf(w, "%s%02d:00%s │ %s\n", dim, hour, reset, strings.Join(cells, "  "))
+	}
+}
+
+// RenderWeek draws seven columns from monday of week with day
+func RenderWeek(w io.Writer, occs []mycal.Occurrence, day time.Time) {
+	monday := startOfWeek(day)
+	sunday := monday.AddDate(0, 0, 7)
+	occs = mycal.OccurrencesBetween(occs, monday, sunday)
+	width := (terminalWidth() - 6) / 7
+	if width < 8 {
+		width = 8
+	}
+	cell := width - 1
+
+	header := "      "
+	allDay := "      "
+	for i := 0; i < 7; i++ {
+		d := monday.AddDate(0, 0, i)
+		header += bold + fit(d.Format("Mon 02"), cell) + reset + "│"
+		allDay += allDayCell(occs, d, cell) + "│"
+	}
+	fmt.Fprintf(w, "%sWeek of %s%s\n%s\n%s\n", bold, monday.Format("02 January 2006"), reset, header, allDay)
+	first, last := visibleHours(occs, monday, sunday)
+	for hour := first; hour < last; hour++ {
+		line := fmt.Sprintf("%s%02d:00%s ", dim, hour, reset)
+		for i := 0; i < 7; i++ {
+			slot := monday.AddDate(0, 0, i).Add(time.Duration(hour) * time.Hour)
+			line += slotCell(occs, slot, cell) + "│"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// RenderMonth draws weeks of month of day, every cell lists first events of its day
+func RenderMonth(w io.Writer, occs []mycal.Occurrence, day time.Time) {
+	first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	width := terminalWidth() / 7
+	if width < 8 {
+		width = 8
+	}
+	cell := width - 1
+	const lines = 3
+
+	fmt.Fprintf(w, "%s%s%s\n", bold, first.Format("January 2006"), reset)
+	header := ""
+	for i := 0; i < 7; i++ {
+		header += fit(startOfWeek(first).AddDate(0, 0, i).Format("Mon"), cell) + "│"
+	}
+	fmt.Fprintln(w, header)
+	rule := strings.Repeat(strings.Repeat("─", cell)+"┼", 7)
+	for week := startOfWeek(first); week.Before(first.AddDate(0, 1, 0)); week = week.AddDate(0, 0, 7) {
+		fmt.Fprintln(w, rule)
+		rows := make([]string, lines+1)
+		for i := 0; i < 7; i++ {
+			d := week.AddDate(0, 0, i)
+			found := mycal.OccurrencesBetween(occs, d, d.AddDate(0, 0, 1))
+			number := fit(strconv.Itoa(d.Day()), cell)
+			if d.Month() != first.Month() {
+				rows[0] += dim + number + reset + "│"
+			} else {
+				rows[0] += bold + number + reset + "│"
+			}
+			for line := 1; line <= lines; line++ {
+				n := line - 1
+				switch {
+				case n < len(found) && (line < lines || len(found) == lines):
+					occ := &found[n]
+					text := occ.Summary
+					if !occ.AllDay && !occ.Start.Before(d) {
+						text = occ.Start.Format("15:04") + " " + text
+					}
+					rows[line] += colorOf(occ) + fit(text, cell) + reset + "│"
+				case n < len(found):
+					rows[line] += fit(fmt.Sprintf("+%d more", len(found)-n), cell) + "│"
+				default:
+					rows[line] += strings.Repeat(" ", cell) + "│"
+				}
+			}
+		}
+		for _, row := range rows {
+			fmt.Fprintln(w, row)
+		}
+	}
+}
+
+// selectCalendars returns calendars with given names or display names, all when names are empty
+func selectCalendars(ctx context.Context, httpClient webdav.HTTPClient, homeset string, names []string) ([]mycal.CalendarProps, error) {
+	calendars, err := mycal.ListCalendarProps(ctx, httpClient, URL, homeset)
+	if err != nil {
+		return nil, err
+	}
+	var selected []mycal.CalendarProps
+	for _, props := range calendars {
+		if len(names) == 0 || contains(names, props.Name) || contains(names, props.DisplayName) {
+			selected = append(selected, props)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("calendars %s not found", strings.Join(names, ", "))
+	}
+	return selected, nil
+}
+
+// ShowView collects occurrences of calendars, all when names are empty, and
+// renders view of kind: agenda, day, week or month. Agenda covers days from day.
+func ShowView(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, homeset string, w io.Writer, kind string, names []string, day time.Time, days int) error {
+	day = startOfDay(day)
+	var start, end time.Time
+	switch kind {
+	case "agenda":
+		start, end = day, day.AddDate(0, 0, days)
+	case "day":
+		start, end = day, day.AddDate(0, 0, 1)
+	case "week":
+		start = startOfWeek(day)
+		end = start.AddDate(0, 0, 7)
+	case "month":
+		start = startOfWeek(time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location()))
+		end = startOfWeek(time.Date(day.Year(), day.Month()+1, 1, 0, 0, 0, 0, day.Location())).AddDate(0, 0, 7)
+	default:
+		return fmt.Errorf("unknown view %s, expected agenda, day, week or month", kind)
+	}
+
+	selected, err := selectCalendars(ctx, httpClient, homeset, names)
+	if err != nil {
+		return err
+	}
+	if Output != "text" {
+		// json and jcal output prints whole objects shown in view
+		objects, err := mycal.CollectObjects(ctx, client, selected, start, end)
+		if err != nil {
+			return err
+		}
+		PrintEvents(objects)
+		return nil
+	}
+	occs, err := mycal.CollectOccurrences(ctx, client, selected, start, end, day.Location())
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "agenda":
+		RenderAgenda(w, occs, start, end)
+	case "day":
+		RenderDay(w, occs, day)
+	case "week":
+		RenderWeek(w, occs, day)
+	case "month":
+		RenderMonth(w, occs, day)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
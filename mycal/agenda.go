@@ -0,0 +1,172 @@
+package mycal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// Occurrence is one instance of event in views, recurring events have one per repetition
+type Occurrence struct {
+	Period
+	Calendar string
+	Color    string
+	UID      string
+	Summary  string
+	Location string
+	AllDay   bool
+	// Busy is false for transparent events, they don't block time
+	Busy bool
+}
+
+func isCancelled(comp *ical.Component) bool {
+	status, _ := comp.Props.Text(ical.PropStatus)
+	return strings.EqualFold(status, string(ical.EventCancelled))
+}
+
+func newOccurrence(comp *ical.Component, p Period) Occurrence {
+	occ := Occurrence{Period: p, Busy: IsBusy(comp)}
+	occ.UID, _ = comp.Props.Text(ical.PropUID)
+	occ.Summary, _ = comp.Props.Text(ical.PropSummary)
+	occ.Location, _ = comp.Props.Text(ical.PropLocation)
+	if prop := comp.Props.Get(ical.PropDateTimeStart); prop != nil {
+		occ.AllDay = prop.ValueType() == ical.ValueDate
+	}
+	return occ
+}
+
+// ObjectOccurrences expands events of object that intersect [start, end),
+// overridden instances replace instances they override and cancelled ones are dropped
+func ObjectOccurrences(cal *ical.Calendar, start, end time.Time, loc *time.Location) ([]Occurrence, error) {
+	overridden := make(map[string]map[int64]bool)
+	var masters, overrides []*ical.Component
+	for _, comp := range cal.Children {
+		if comp.Name != ical.CompEvent {
+			continue
+		}
+		prop := comp.Props.Get(ical.PropRecurrenceID)
+		if prop == nil {
+			masters = append(masters, comp)
+			continue
+		}
+		id, err := prop.DateTime(loc)
+		if err != nil {
+			return nil, err
+		}
+		uid, _ := comp.Props.Text(ical.PropUID)
+		if overridden[uid] == nil {
+			overridden[uid] = make(map[int64]bool)
+		}
+		overridden[uid][id.Unix()] = true
+		overrides = append(overrides, comp)
+	}
+
+	var occs []Occurrence
+	add := func(comp *ical.Component, skip map[int64]bool) error {
+		if isCancelled(comp) {
+			return nil
+		}
+		periods, err := EventPeriods(comp, start, end, loc)
+		if err != nil {
+			return err
+		}
+		for _, p := range periods {
+			if !skip[p.Start.Unix()] {
+				// UTC and floating times are shown in time zone of view
+				occs = append(occs, newOccurrence(comp, Period{Start: p.Start.In(loc), End: p.End.In(loc)}))
+			}
+		}
+		return nil
+	}
+	for _, comp := range masters {
+		uid, _ := comp.Props.Text(ical.PropUID)
+		if err := add(comp, overridden[uid]); err != nil {
+			return nil, fmt.Errorf("%s: %v", uid, err)
+		}
+	}
+	for _, comp := range overrides {
+		// override is single instance, its own RRULE must not be expanded
+		single := &ical.Component{Name: comp.Name, Props: make(ical.Props), Children: comp.Children}
+		for name, props := range comp.Props {
+			if name != ical.PropRecurrenceRule {
+				single.Props[name] = props
+			}
+		}
+		if err := add(single, nil); err != nil {
+			return nil, err
+		}
+	}
+	return occs, nil
+}
+
+// CollectOccurrences merges occurrences of calendars in [start, end) sorted by
+// time, each one carries name and color of its calendar
+func CollectOccurrences(ctx context.Context, client *caldav.Client, calendars []CalendarProps, start, end time.Time, loc *time.Location) ([]Occurrence, error) {
+	var occs []Occurrence
+	for _, props := range calendars {
+		resp, err := client.QueryCalendar(ctx, props.Path, timeRangeQuery(start, end))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", props.Name, err)
+		}
+		name := props.DisplayName
+		if name == "" {
+			name = props.Name
+		}
+		for _, obj := range resp {
+			found, err := ObjectOccurrences(obj.Data, start, end, loc)
+			if err != nil {
+				return nil, err
+			}
+			for i := range found {
+				found[i].Calendar = name
+				found[i].Color = props.Color
+			}
+			occs = append(occs, found...)
+		}
+	}
+	SortOccurrences(occs)
+	return occs, nil
+}
+
+// CollectObjects returns objects of calendars that have occurrences between start and end
+func CollectObjects(ctx context.Context, client *caldav.Client, calendars []CalendarProps, start, end time.Time) ([]caldav.CalendarObject, error) {
+	var objects []caldav.CalendarObject
+	for _, props := range calendars {
+		resp, err := client.QueryCalendar(ctx, props.Path, timeRangeQuery(start, end))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", props.Name, err)
+		}
+		objects = append(objects, resp...)
+	}
+	return objects, nil
+}
+
+// SortOccurrences orders by start, all-day events first on the same day
+func SortOccurrences(occs []Occurrence) {
+	sort.SliceStable(occs, func(i, j int) bool {
+		a, b := occs[i], occs[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.AllDay != b.AllDay {
+			return a.AllDay
+		}
+		return a.Summary < b.Summary
+	})
+}
+
+// OccurrencesBetween returns occurrences that intersect [start, end)
+func OccurrencesBetween(occs []Occurrence, start, end time.Time) []Occurrence {
+	var found []Occurrence
+	for _, occ := range occs {
+		if occ.Start.Before(end) && occ.End.After(start) || occ.Start.Equal(start) {
+			found = append(found, occ)
+		}
+	}
+	return found
+}
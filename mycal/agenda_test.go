@@ -0,0 +1,65 @@
+package mycal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+const agendaData = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:standup\r\nDTSTAMP:20240701T000000Z\r\nSUMMARY:Standup\r\n" +
+	"DTSTART:20240701T060000Z\r\nDTEND:20240701T061500Z\r\nRRULE:FREQ=DAILY;COUNT=5\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:standup\r\nDTSTAMP:20240701T000000Z\r\nSUMMARY:Standup moved\r\n" +
+	"RECURRENCE-ID:20240702T060000Z\r\nDTSTART:20240702T100000Z\r\nDTEND:20240702T101500Z\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:standup\r\nDTSTAMP:20240701T000000Z\r\nSUMMARY:Standup\r\nSTATUS:CANCELLED\r\n" +
+	"RECURRENCE-ID:20240703T060000Z\r\nDTSTART:20240703T060000Z\r\nDTEND:20240703T061500Z\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestObjectOccurrences(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(agendaData)).Decode()
+	assert.NoError(t, err)
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	start := time.Date(2024, 7, 1, 0, 0, 0, 0, moscow)
+
+	occs, err := ObjectOccurrences(cal, start, start.AddDate(0, 0, 4), moscow)
+	assert.NoError(t, err)
+	SortOccurrences(occs)
+	var got []string
+	for _, occ := range occs {
+		assert.Equal(t, moscow, occ.Start.Location())
+		got = append(got, occ.Start.Format("02 15:04 ")+occ.Summary)
+	}
+	assert.Equal(t, []string{"01 09:00 Standup", "02 13:00 Standup moved", "04 09:00 Standup"}, got)
+
+	day := time.Date(2024, 7, 2, 0, 0, 0, 0, moscow)
+	found := OccurrencesBetween(occs, day, day.AddDate(0, 0, 1))
+	assert.Equal(t, 1, len(found))
+	assert.Equal(t, "Standup moved", found[0].Summary)
+}
+
+func TestCollectOccurrences(t *testing.T) {
+	dav := newFakeDAV("work", "home")
+	dav.put(syncHomeset+"work/standup.ics", agendaData)
+	dav.put(syncHomeset+"home/holiday.ics", "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n"+
+		"BEGIN:VEVENT\r\nUID:holiday\r\nDTSTAMP:20240701T000000Z\r\nSUMMARY:Holiday\r\n"+
+		"DTSTART;VALUE=DATE:20240701\r\nDTEND;VALUE=DATE:20240702\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	_, client := startFakeDAV(t, dav)
+
+	calendars := []CalendarProps{
+		{Path: syncHomeset + "work/", Name: "work", DisplayName: "Work", Color: "#FF0000FF"},
+		{Path: syncHomeset + "home/", Name: "home"},
+	}
+	start := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	occs, err := CollectOccurrences(context.Background(), client, calendars, start, start.AddDate(0, 0, 1), time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(occs))
+	assert.Equal(t, "Holiday", occs[0].Summary)
+	assert.True(t, occs[0].AllDay)
+	assert.Equal(t, "home", occs[0].Calendar)
+	assert.Equal(t, "Work", occs[1].Calendar)
+	assert.Equal(t, "#FF0000FF", occs[1].Color)
+}
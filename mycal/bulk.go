@@ -0,0 +1,355 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trvita/go-ical"
+)
+
+// operations of Bulk
+const (
+	BulkShift          = "shift"
+	BulkSet            = "set"
+	BulkAddAttendee    = "add-attendee"
+	BulkRemoveAttendee = "remove-attendee"
+	BulkMove           = "move"
+	BulkDelete         = "delete"
+)
+
+// BulkOp is one change applied to every object found by query
+type BulkOp struct {
+	Kind string
+	// Shift moves start, end, due, recurrence ids and exceptions, all-day dates
+	// only by whole days
+	Shift time.Duration
+	// Prop is set to Value by BulkSet, empty value removes it
+	Prop, Value string
+	// Attendee is email address
+	Attendee string
+	// Calendar is destination of BulkMove
+	Calendar string
+}
+
+type BulkOptions struct {
+	DryRun bool
+	// Jobs limits how many objects are changed at once, 4 when not set
+	Jobs int
+	// Trash keeps objects removed by BulkDelete, all in one batch
+	Trash *Trash
+}
+
+// BulkResult is outcome for one object, Change tells what was done or would be
+// done by dry run, it is empty when there was nothing to change
+type BulkResult struct {
+	Calendar string
+	Path     string
+	UID      string
+	Summary  string
+	Change   string
+	Err      error
+	// Data is object as written, nil for dry run, delete and move
+	Data *ical.Calendar
+}
+
+// shiftedProps hold dates that move with event
+var shiftedProps = []string{ical.PropDateTimeStart, ical.PropDateTimeEnd, ical.PropDue,
+	ical.PropRecurrenceID, ical.PropExceptionDates, ical.PropRecurrenceDates}
+
+// fixedProps can't be changed by BulkSet, they have their own operations or identify object
+var fixedProps = []string{ical.PropUID, ical.PropRecurrenceID, ical.PropDateTimeStart, ical.PropDateTimeEnd,
+	ical.PropDue, ical.PropAttendee}
+
+// Check validates operation
+func (op *BulkOp) Check() error {
+	switch op.Kind {
+	case BulkShift:
+		if op.Shift == 0 {
+			return fmt.Errorf("shift needs non-zero duration")
+		}
+	case BulkSet:
+		if op.Prop == "" {
+			return fmt.Errorf("set needs property name")
+		}
+		if contains(fixedProps, strings.ToUpper(op.Prop)) {
+			return fmt.Errorf("%s can't be set, use shift for dates and add-attendee or remove-attendee for attendees", strings.ToUpper(op.Prop))
+		}
+	case BulkAddAttendee, BulkRemoveAttendee:
+		if !strings.Contains(op.Attendee, "@") {
+			return fmt.Errorf("%s needs email address", op.Kind)
+		}
+	case BulkMove:
+		if op.Calendar == "" {
+			return fmt.Errorf("move needs destination calendar")
+		}
+	case BulkDelete:
+	default:
+		return fmt.Errorf("unknown operation %s", op.Kind)
+	}
+	return nil
+}
+
+// shiftValue moves every date of comma separated value, periods move by their start and end
+func shiftValue(value string, d time.Duration) (string, error) {
+	parts := strings.Split(value, ",")
+	for i, part := range parts {
+		period := strings.SplitN(part, "/", 2)
+		for j, v := range period {
+			if v == "" || j == 1 && strings.ContainsRune("P+-", rune(v[0])) {
+				continue // duration of period stays
+			}
+			layout := "20060102T150405"
+			switch {
+			case len(v) == len("20060102"):
+				if d%(24*time.Hour) != 0 {
+					return "", fmt.Errorf("all-day date %s can be shifted only by whole days", v)
+				}
+				layout = "20060102"
+			case strings.HasSuffix(v, "Z"):
+				layout = "20060102T150405Z"
+			}
+			// wall clock of local times is shifted, so DST mistakes are fixed as they look
+			t, err := time.Parse(layout, v)
+			if err != nil {
+				return "", err
+			}
+			period[j] = t.Add(d).Format(layout)
+		}
+		parts[i] = strings.Join(period, "/")
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// shiftUntil moves UNTIL of recurrence rule, so rule keeps the same number of occurrences
+func shiftUntil(rule string, d time.Duration) (string, error) {
+	parts := strings.Split(rule, ";")
+	for i, part := range parts {
+		if name, value, ok := strings.Cut(part, "="); ok && strings.EqualFold(name, "UNTIL") {
+			shifted, err := shiftValue(value, d)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = name + "=" + shifted
+		}
+	}
+	return strings.Join(parts, ";"), nil
+}
+
+func attendeeIs(prop ical.Prop, email string) bool {
+	return strings.EqualFold(strings.TrimPrefix(strings.ToLower(prop.Value), "mailto:"), email)
+}
+
+// apply changes components of cal and describes change, nothing changed gives ""
+func (op *BulkOp) apply(cal *ical.Calendar) (string, error) {
+	var change string
+	for _, comp := range cal.Children {
+		if !contains(ObjectComponents, comp.Name) {
+			continue
+		}
+		changed := false
+		switch op.Kind {
+		case BulkShift:
+			for _, name := range shiftedProps {
+				for i := range comp.Props[name] {
+					prop := &comp.Props[name][i]
+					value, err := shiftValue(prop.Value, op.Shift)
+					if err != nil {
+						return "", fmt.Errorf("%s: %v", name, err)
+					}
+					if change == "" && (name == ical.PropDateTimeStart || name == ical.PropDue) {
+						change = fmt.Sprintf("%s %s -> %s", name, prop.Value, value)
+					}
+					prop.Value = value
+					changed = true
+				}
+			}
+			for i := range comp.Props[ical.PropRecurrenceRule] {
+				prop := &comp.Props[ical.PropRecurrenceRule][i]
+				value, err := shiftUntil(prop.Value, op.Shift)
+				if err != nil {
+					return "", fmt.Errorf("%s: %v", ical.PropRecurrenceRule, err)
+				}
+				prop.Value = value
+			}
+			if changed {
+				seq := 0
+				if prop := comp.Props.Get(ical.PropSequence); prop != nil {
+					seq, _ = prop.Int()
+				}
+				seqProp := ical.NewProp(ical.PropSequence)
+				seqProp.Value = strconv.Itoa(seq + 1)
+				comp.Props.Set(seqProp)
+			}
+		case BulkSet:
+			name := strings.ToUpper(op.Prop)
+			value := op.Value
+			if name == ical.PropStatus || name == ical.PropTransparency || name == ical.PropClass {
+				value = strings.ToUpper(value)
+			}
+			old, _ := comp.Props.Text(name)
+			if prop := comp.Props.Get(name); prop != nil && name == ical.PropCategories {
+				list, _ := prop.TextList()
+				old = strings.Join(list, ",")
+			}
+			if old == value && (value != "" || comp.Props.Get(name) == nil) {
+				continue
+			}
+			if change == "" {
+				change = fmt.Sprintf("%s %q -> %q", name, old, value)
+			}
+			switch {
+			case value == "":
+				comp.Props.Del(name)
+			case name == ical.PropCategories:
+				prop := ical.NewProp(name)
+				prop.SetTextList(strings.Split(value, ","))
+				comp.Props.Set(prop)
+			default:
+				comp.Props.SetText(name, value)
+			}
+			changed = true
+		case BulkAddAttendee:
+			found := false
+			for _, prop := range comp.Props.Values(ical.PropAttendee) {
+				found = found || attendeeIs(prop, op.Attendee)
+			}
+			if found {
+				continue
+			}
+			prop := ical.NewProp(ical.PropAttendee)
+			prop.Params.Add(ical.ParamParticipationStatus, "NEEDS-ACTION")
+			prop.Params.Add(ical.ParamRole, "REQ-PARTICIPANT")
+			prop.Value = "mailto:" + op.Attendee
+			comp.Props.Add(prop)
+			change, changed = "add attendee "+op.Attendee, true
+		case BulkRemoveAttendee:
+			var kept []ical.Prop
+			for _, prop := range comp.Props.Values(ical.PropAttendee) {
+				if !attendeeIs(prop, op.Attendee) {
+					kept = append(kept, prop)
+				}
+			}
+			if len(kept) == len(comp.Props.Values(ical.PropAttendee)) {
+				continue
+			}
+			comp.Props.Del(ical.PropAttendee)
+			if len(kept) > 0 {
+				comp.Props[ical.PropAttendee] = kept
+			}
+			change, changed = "remove attendee "+op.Attendee, true
+		}
+		if changed {
+			now := time.Now().UTC()
+			comp.Props.SetDateTime(ical.PropDateTimeStamp, now)
+			comp.Props.SetDateTime(ical.PropLastModified, now)
+		}
+	}
+	return change, nil
+}
+
+// bulkOne applies operation to object of result, batch groups objects deleted in trash
+func bulkOne(ctx context.Context, end *Endpoint, res SearchResult, op *BulkOp, opts BulkOptions, batch string, now time.Time) BulkResult {
+	obj := res.Object
+	result := BulkResult{Calendar: res.Calendar, Path: obj.Path}
+	for _, comp := range obj.Data.Children {
+		if contains(ObjectComponents, comp.Name) {
+			result.UID, _ = comp.Props.Text(ical.PropUID)
+			result.Summary, _ = comp.Props.Text(ical.PropSummary)
+			break
+		}
+	}
+	etag := unquoteETag(obj.ETag)
+
+	switch op.Kind {
+	case BulkDelete:
+		result.Change = "delete"
+		if !opts.DryRun {
+			_, result.Err = deleteObject(ctx, end.HTTPClient, end.URL, obj.Path, opts.Trash, batch, now, etag)
+		}
+		return result
+	case BulkMove:
+		calendarPath := calendarOf(obj.Path)
+		name := strings.TrimSuffix(strings.TrimPrefix(calendarPath, end.Homeset), "/")
+		if name == op.Calendar {
+			return result
+		}
+		result.Change = "move to " + op.Calendar
+		if !opts.DryRun {
+			_, result.Err = CopyObject(ctx, end, end, name, result.UID, op.Calendar, CopyOptions{Move: true})
+		}
+		return result
+	}
+
+	// results stay as they are, dry run is followed by real run on them
+	var buf bytes.Buffer
+	if result.Err = ical.NewEncoder(&buf).Encode(obj.Data); result.Err != nil {
+		return result
+	}
+	cal, err := ical.NewDecoder(&buf).Decode()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if result.Change, result.Err = op.apply(cal); result.Err != nil || result.Change == "" || opts.DryRun {
+		return result
+	}
+	buf.Reset()
+	if result.Err = ical.NewEncoder(&buf).Encode(cal); result.Err != nil {
+		return result
+	}
+	if etag == "" {
+		// object found without ETag would be written as new one, current ETag guards it instead
+		current, err := OpenObject(ctx, end.HTTPClient, end.URL, obj.Path)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		etag = current.ETag
+	}
+	_, result.Err = writeObject(ctx, end.HTTPClient, http.MethodPut, collectionURL(end.URL, obj.Path, ""), etag, buf.Bytes())
+	if isPrecondition(result.Err) {
+		result.Err = ErrChanged
+	}
+	if result.Err == nil {
+		result.Data = cal
+	}
+	return result
+}
+
+// Bulk applies operation to every found object, at most opts.Jobs at once.
+// Objects changed on server since they were found are left alone, deleted
+// objects go to trash in one batch, so undo restores all of them.
+func Bulk(ctx context.Context, end *Endpoint, results []SearchResult, op *BulkOp, opts BulkOptions) ([]BulkResult, error) {
+	if err := op.Check(); err != nil {
+		return nil, err
+	}
+	if op.Kind == BulkDelete && opts.Trash == nil && !opts.DryRun {
+		return nil, fmt.Errorf("delete needs trash")
+	}
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = 4
+	}
+	now := time.Now()
+	batch := newBatch(now)
+	report := make([]BulkResult, len(results))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, res := range results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, res SearchResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			report[i] = bulkOne(ctx, end, res, op, opts, batch, now)
+		}(i, res)
+	}
+	wg.Wait()
+	return report, nil
+}
@@ -0,0 +1,150 @@
+package mycal
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+const bulkWorkshop = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VEVENT\r\nUID:workshop\r\n" +
+	"DTSTAMP:20240701T090000Z\r\nDTSTART;TZID=Europe/Berlin:20240701T100000\r\nDTEND;TZID=Europe/Berlin:20240701T110000\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=4\r\nEXDATE;TZID=Europe/Berlin:20240708T100000\r\nSUMMARY:Workshop\r\nCATEGORIES:training\r\n" +
+	"ATTENDEE:mailto:jane@example.com\r\nEND:VEVENT\r\nBEGIN:VEVENT\r\nUID:workshop\r\nDTSTAMP:20240701T090000Z\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Berlin:20240715T100000\r\nDTSTART;TZID=Europe/Berlin:20240715T120000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20240715T130000\r\nSUMMARY:Workshop\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+const bulkHoliday = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VEVENT\r\nUID:holiday\r\n" +
+	"DTSTAMP:20240701T090000Z\r\nDTSTART;VALUE=DATE:20240704\r\nSUMMARY:Holiday\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestShiftValue(t *testing.T) {
+	for _, tt := range []struct {
+		value, want string
+		d           time.Duration
+	}{
+		{"20240701T100000", "20240701T110000", time.Hour},
+		{"20240701T100000Z", "20240701T093000Z", -30 * time.Minute},
+		{"20240701", "20240703", 48 * time.Hour},
+		{"20240701T100000,20240708T100000", "20240701T110000,20240708T110000", time.Hour},
+		{"20240701T100000Z/PT1H", "20240701T110000Z/PT1H", time.Hour},
+		{"20240701T100000Z/20240701T120000Z", "20240701T110000Z/20240701T130000Z", time.Hour},
+	} {
+		got, err := shiftValue(tt.value, tt.d)
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.want, got)
+	}
+	_, err := shiftValue("20240701", time.Hour)
+	assert.Error(t, err)
+
+	rule, err := shiftUntil("FREQ=DAILY;UNTIL=20240705T100000Z;INTERVAL=2", 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "FREQ=DAILY;UNTIL=20240706T100000Z;INTERVAL=2", rule)
+	rule, err = shiftUntil("FREQ=WEEKLY;COUNT=4", time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", rule)
+}
+
+func bulkSetup(t *testing.T) (*fakeDAV, *Endpoint, []SearchResult) {
+	dav := newFakeDAV("work", "archive")
+	dav.put(syncHomeset+"work/workshop.ics", bulkWorkshop)
+	dav.put(syncHomeset+"work/holiday.ics", bulkHoliday)
+	end := fakeEndpoint(t, dav)
+	var results []SearchResult
+	for _, path := range dav.paths(syncHomeset + "work/") {
+		cal, err := ical.NewDecoder(strings.NewReader(dav.objects[path])).Decode()
+		assert.NoError(t, err)
+		results = append(results, SearchResult{Calendar: "work", Object: caldav.CalendarObject{Path: path, ETag: `"` + dav.etags[path] + `"`, Data: cal}})
+	}
+	return dav, end, results
+}
+
+func TestBulk(t *testing.T) {
+	ctx := context.Background()
+	dav, end, results := bulkSetup(t)
+	workshop := syncHomeset + "work/workshop.ics"
+
+	// dry run changes nothing and reports all-day event that can't move by an hour
+	op := &BulkOp{Kind: BulkShift, Shift: time.Hour}
+	report, err := Bulk(ctx, end, results, op, BulkOptions{DryRun: true})
+	assert.NoError(t, err)
+	if assert.Len(t, report, 2) {
+		assert.Error(t, report[0].Err)
+		assert.Equal(t, "DTSTART 20240701T100000 -> 20240701T110000", report[1].Change)
+		assert.NoError(t, report[1].Err)
+	}
+	assert.Equal(t, bulkWorkshop, dav.objects[workshop])
+
+	report, err = Bulk(ctx, end, results[1:], op, BulkOptions{Jobs: 2})
+	assert.NoError(t, err)
+	assert.NoError(t, report[0].Err)
+	data := dav.objects[workshop]
+	for _, want := range []string{"DTSTART;TZID=Europe/Berlin:20240701T110000", "EXDATE;TZID=Europe/Berlin:20240708T110000",
+		"RECURRENCE-ID;TZID=Europe/Berlin:20240715T110000", "DTSTART;TZID=Europe/Berlin:20240715T130000", "SEQUENCE:1"} {
+		assert.Contains(t, data, want)
+	}
+
+	// rule ending at UNTIL keeps its last occurrence, result without ETag gets current one
+	until := strings.Replace(bulkWorkshop, "COUNT=4", "UNTIL=20240722T080000Z", 1)
+	dav.put(workshop, until)
+	cal, err := ical.NewDecoder(strings.NewReader(until)).Decode()
+	assert.NoError(t, err)
+	noETag := SearchResult{Calendar: "work", Object: caldav.CalendarObject{Path: workshop, Data: cal}}
+	report, _ = Bulk(ctx, end, []SearchResult{noETag}, op, BulkOptions{})
+	assert.NoError(t, report[0].Err)
+	assert.Contains(t, dav.objects[workshop], "RRULE:FREQ=WEEKLY;UNTIL=20240722T090000Z")
+	dav.put(workshop, data)
+
+	// results are stale now, changed object is left alone
+	report, _ = Bulk(ctx, end, results[1:], &BulkOp{Kind: BulkSet, Prop: "summary", Value: "Changed"}, BulkOptions{})
+	assert.True(t, errors.Is(report[0].Err, ErrChanged))
+	assert.Equal(t, data, dav.objects[workshop])
+}
+
+func TestBulkOperations(t *testing.T) {
+	ctx := context.Background()
+	dav, end, results := bulkSetup(t)
+	workshop := syncHomeset + "work/workshop.ics"
+
+	report, err := Bulk(ctx, end, results, &BulkOp{Kind: BulkAddAttendee, Attendee: "john@example.com"}, BulkOptions{})
+	assert.NoError(t, err)
+	for _, res := range report {
+		assert.NoError(t, res.Err)
+		assert.Equal(t, "add attendee john@example.com", res.Change)
+	}
+	assert.Equal(t, 2, strings.Count(dav.objects[workshop], "ATTENDEE;PARTSTAT=NEEDS-ACTION;ROLE=REQ-PARTICIPANT:mailto:john@example.com"))
+
+	dav, end, results = bulkSetup(t)
+	report, _ = Bulk(ctx, end, results, &BulkOp{Kind: BulkRemoveAttendee, Attendee: "JANE@example.com"}, BulkOptions{})
+	assert.Equal(t, "", report[0].Change)
+	assert.Equal(t, "remove attendee JANE@example.com", report[1].Change)
+	assert.NotContains(t, dav.objects[workshop], "jane@")
+
+	dav, end, results = bulkSetup(t)
+	report, _ = Bulk(ctx, end, results, &BulkOp{Kind: BulkSet, Prop: "status", Value: "cancelled"}, BulkOptions{})
+	assert.NoError(t, report[1].Err)
+	assert.Equal(t, 2, strings.Count(dav.objects[workshop], "STATUS:CANCELLED"))
+	_, err = Bulk(ctx, end, results, &BulkOp{Kind: BulkSet, Prop: "dtstart", Value: "x"}, BulkOptions{})
+	assert.Error(t, err)
+
+	dav, end, results = bulkSetup(t)
+	report, _ = Bulk(ctx, end, results, &BulkOp{Kind: BulkMove, Calendar: "archive"}, BulkOptions{})
+	for _, res := range report {
+		assert.NoError(t, res.Err)
+	}
+	assert.Equal(t, []string{syncHomeset + "archive/holiday.ics", syncHomeset + "archive/workshop.ics"}, dav.paths(syncHomeset))
+
+	dav, end, results = bulkSetup(t)
+	trash := &Trash{Dir: t.TempDir()}
+	report, _ = Bulk(ctx, end, results, &BulkOp{Kind: BulkDelete}, BulkOptions{Trash: trash})
+	for _, res := range report {
+		assert.NoError(t, res.Err)
+	}
+	assert.Empty(t, dav.objects)
+	batch, _ := trash.LastBatch()
+	assert.Len(t, batch, 2)
+}
@@ -0,0 +1,305 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// Cache is on-disk copy of calendars: sync state with ETags in index.json,
+// object bodies in objects/ and writes made offline in queue.json
+type Cache struct {
+	Dir   string
+	Sync  *SyncStore
+	Queue []PendingWrite
+}
+
+type PendingWrite struct {
+	Method string // PUT or DELETE
+	Path   string
+	// ETag object had when it was changed offline, empty for new objects
+	ETag string
+	Data string
+}
+
+type Conflict struct {
+	Write  PendingWrite
+	Reason string
+}
+
+// IsOffline reports whether err means server can't be reached: connection isn't made,
+// name isn't resolved or request timed out. TLS and certificate errors aren't such.
+func IsOffline(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return true
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	}
+	return false
+}
+
+func OpenCache(dir string) (*Cache, error) {
+	store, err := LoadSyncStore(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	cache := &Cache{Dir: dir, Sync: store}
+	data, err := os.ReadFile(filepath.Join(dir, "queue.json"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &cache.Queue); err != nil {
+			return nil, err
+		}
+	}
+	return cache, nil
+}
+
+func (c *Cache) Save() error {
+	if err := c.Sync.Save(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c.Queue, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.Dir, "queue.json"), data, 0o600)
+}
+
+func (c *Cache) objectFile(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return filepath.Join(c.Dir, "objects", hex.EncodeToString(sum[:])+".ics")
+}
+
+func calendarOf(path string) string {
+	return path[:strings.LastIndex(strings.TrimSuffix(path, "/"), "/")+1]
+}
+
+// Store saves object body in cache and remembers its ETag
+func (c *Cache) Store(obj caldav.CalendarObject) error {
+	if err := os.MkdirAll(filepath.Join(c.Dir, "objects"), 0o700); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(obj.Data); err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.objectFile(obj.Path), buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	c.Sync.State(calendarOf(obj.Path)).ETags[obj.Path] = unquoteETag(obj.ETag)
+	return nil
+}
+
+func (c *Cache) Remove(path string) error {
+	delete(c.Sync.State(calendarOf(path)).ETags, path)
+	err := os.Remove(c.objectFile(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Objects reads cached objects of calendar
+func (c *Cache) Objects(calendarPath string) ([]caldav.CalendarObject, error) {
+	if !strings.HasSuffix(calendarPath, "/") {
+		calendarPath += "/"
+	}
+	state := c.Sync.State(calendarPath)
+	paths := make([]string, 0, len(state.ETags))
+	for path := range state.ETags {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	objects := make([]caldav.CalendarObject, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(c.objectFile(path))
+		if err != nil {
+			return nil, err
+		}
+		cal, err := ical.NewDecoder(f).Decode()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		objects = append(objects, caldav.CalendarObject{Path: path, ETag: state.ETags[path], Data: cal})
+	}
+	return objects, nil
+}
+
+// Refresh brings cached calendar up to date with server
+func (c *Cache) Refresh(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset, calendarName string) error {
+	result, err := SyncCalendar(ctx, httpClient, client, url, homeset, calendarName, c.Sync.State(homeset+calendarName+"/"))
+	if err != nil {
+		return err
+	}
+	for _, obj := range result.Changed {
+		if err := c.Store(obj); err != nil {
+			return err
+		}
+	}
+	for _, path := range result.Deleted {
+		if err := c.Remove(path); err != nil {
+			return err
+		}
+	}
+	return c.Save()
+}
+
+// CachedObjects returns objects of calendar from server when it is reachable,
+// otherwise from cache. Second value is true when cache was used.
+func CachedObjects(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset, calendarName string, cache *Cache) ([]caldav.CalendarObject, bool, error) {
+	err := cache.Refresh(ctx, httpClient, client, url, homeset, calendarName)
+	if err != nil && !IsOffline(err) {
+		return nil, false, err
+	}
+	objects, cacheErr := cache.Objects(homeset + calendarName)
+	if cacheErr != nil {
+		return nil, false, cacheErr
+	}
+	return objects, err != nil, nil
+}
+
+// QueuePut stores event in cache and remembers to upload it when online
+func (c *Cache) QueuePut(homeset, calendarName string, event *ical.Event) error {
+	uid, err := event.Props.Text(ical.PropUID)
+	if err != nil {
+		return err
+	}
+	path := homeset + calendarName + "/" + uid + ".ics"
+	calendar := newCalendar(event.Component)
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(calendar); err != nil {
+		return err
+	}
+	etag := c.Sync.State(homeset + calendarName + "/").ETags[path]
+	c.Queue = append(c.Queue, PendingWrite{Method: http.MethodPut, Path: path, ETag: etag, Data: buf.String()})
+	if err := c.Store(caldav.CalendarObject{Path: path, ETag: etag, Data: calendar}); err != nil {
+		return err
+	}
+	return c.Save()
+}
+
+// QueueDelete removes object from cache and remembers to delete it when online
+func (c *Cache) QueueDelete(path string) error {
+	etag := c.Sync.State(calendarOf(path)).ETags[path]
+	c.Queue = append(c.Queue, PendingWrite{Method: http.MethodDelete, Path: path, ETag: etag})
+	if err := c.Remove(path); err != nil {
+		return err
+	}
+	return c.Save()
+}
+
+// Replay sends writes made offline. Objects changed on server in the meantime
+// are not overwritten, they are reported as conflicts and dropped from queue.
+func (c *Cache) Replay(ctx context.Context, httpClient webdav.HTTPClient, url string) ([]Conflict, error) {
+	var conflicts []Conflict
+	for len(c.Queue) > 0 {
+		w := c.Queue[0]
+		etag, err := writeObject(ctx, httpClient, w.Method, collectionURL(url, w.Path, ""), w.ETag, []byte(w.Data))
+		var de *davError
+		switch {
+		case err == nil:
+			if w.Method == http.MethodPut && etag == "" && c.queued(w.Path) {
+				// server didn't tell new ETag, next write of object needs it
+				if obj, err := OpenObject(ctx, httpClient, url, w.Path); err == nil {
+					etag = obj.ETag
+				}
+			}
+			c.written(w, etag)
+		case errors.As(err, &de) && de.StatusCode == http.StatusPreconditionFailed:
+			conflicts = append(conflicts, Conflict{Write: w, Reason: "changed on server"})
+		case errors.As(err, &de) && de.StatusCode == http.StatusNotFound && w.Method == http.MethodDelete:
+			// already deleted on server
+		case errors.As(err, &de):
+			conflicts = append(conflicts, Conflict{Write: w, Reason: de.Error()})
+		case err != nil:
+			c.Save()
+			return conflicts, err
+		}
+		c.Queue = c.Queue[1:]
+	}
+	return conflicts, c.Save()
+}
+
+// queued reports whether writes after first one in queue change object at path
+func (c *Cache) queued(path string) bool {
+	for _, w := range c.Queue[1:] {
+		if w.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// written remembers ETag object got from replayed write, in cache and in later
+// writes of same object, so they aren't taken for conflicts
+func (c *Cache) written(w PendingWrite, etag string) {
+	if w.Method == http.MethodDelete {
+		etag = ""
+	}
+	state := c.Sync.State(calendarOf(w.Path))
+	if _, cached := state.ETags[w.Path]; cached {
+		state.ETags[w.Path] = etag
+	}
+	for i := 1; i < len(c.Queue); i++ {
+		if c.Queue[i].Path == w.Path {
+			c.Queue[i].ETag = etag
+		}
+	}
+}
+
+// Search matches text the way server search does, in SearchFields of cached objects
+func (c *Cache) Search(calendarPath, text string) ([]caldav.CalendarObject, error) {
+	objects, err := c.Objects(calendarPath)
+	if err != nil {
+		return nil, err
+	}
+	q := &SearchQuery{Text: text}
+	var found []caldav.CalendarObject
+	for _, obj := range objects {
+		for _, comp := range obj.Data.Children {
+			if q.Matches(comp) {
+				found = append(found, obj)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+// FilterComponents keeps objects that contain component with given name
+func FilterComponents(objects []caldav.CalendarObject, name string) []caldav.CalendarObject {
+	var filtered []caldav.CalendarObject
+	for _, obj := range objects {
+		for _, comp := range obj.Data.Children {
+			if comp.Name == name {
+				filtered = append(filtered, obj)
+				break
+			}
+		}
+	}
+	return filtered
+}
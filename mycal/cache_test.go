@@ -0,0 +1,120 @@
+package mycal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+func TestCacheObjects(t *testing.T) {
+	cache, err := OpenCache(t.TempDir())
+	assert.NoError(t, err)
+
+	event := invitation(t)
+	err = cache.Store(caldav.CalendarObject{Path: syncHomeset + "default/itip-uid.ics", ETag: `"1"`, Data: newCalendar(event)})
+	assert.NoError(t, err)
+	assert.NoError(t, cache.Save())
+
+	cache, err = OpenCache(cache.Dir)
+	assert.NoError(t, err)
+	objects, err := cache.Objects(syncHomeset + "default")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, "1", objects[0].ETag)
+
+	found, err := cache.Search(syncHomeset+"default", "MEET")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(found))
+	found, err = cache.Search(syncHomeset+"default", "lunch")
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	assert.Equal(t, 1, len(FilterComponents(objects, ical.CompEvent)))
+	assert.Empty(t, FilterComponents(objects, ical.CompToDo))
+
+	assert.NoError(t, cache.Remove(syncHomeset+"default/itip-uid.ics"))
+	objects, err = cache.Objects(syncHomeset + "default")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
+
+func TestCacheReplay(t *testing.T) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.Header.Get("If-Match") == `"old"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	cache, err := OpenCache(t.TempDir())
+	assert.NoError(t, err)
+	event := invitation(t)
+	assert.NoError(t, cache.QueuePut(syncHomeset, "default", &ical.Event{Component: event}))
+	cache.Sync.State(syncHomeset + "default/").ETags[syncHomeset+"default/other.ics"] = "old"
+	assert.NoError(t, cache.QueueDelete(syncHomeset+"default/other.ics"))
+
+	conflicts, err := cache.Replay(context.Background(), server.Client(), server.URL+"/dav.php")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(requests))
+	assert.Equal(t, http.MethodPut, requests[0].Method)
+	assert.Equal(t, "*", requests[0].Header.Get("If-None-Match"))
+	assert.Equal(t, syncHomeset+"default/itip-uid.ics", requests[0].URL.Path)
+	assert.Equal(t, 1, len(conflicts))
+	assert.Equal(t, http.MethodDelete, conflicts[0].Write.Method)
+	assert.Empty(t, cache.Queue)
+}
+
+func TestCacheReplaySameObject(t *testing.T) {
+	dav := newFakeDAV("default")
+	end := fakeEndpoint(t, dav)
+	cache, err := OpenCache(t.TempDir())
+	assert.NoError(t, err)
+
+	// second write of new object goes with ETag the first one got
+	event := invitation(t)
+	assert.NoError(t, cache.QueuePut(syncHomeset, "default", &ical.Event{Component: event}))
+	event.Props.SetText(ical.PropSummary, "changed meeting")
+	assert.NoError(t, cache.QueuePut(syncHomeset, "default", &ical.Event{Component: event}))
+
+	conflicts, err := cache.Replay(context.Background(), end.HTTPClient, end.URL)
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+	assert.Empty(t, cache.Queue)
+	path := syncHomeset + "default/itip-uid.ics"
+	assert.Contains(t, dav.objects[path], "SUMMARY:changed meeting")
+	assert.Equal(t, dav.etags[path], cache.Sync.State(syncHomeset + "default/").ETags[path])
+}
+
+func TestIsOffline(t *testing.T) {
+	client := &http.Client{}
+	_, err := client.Get("http://127.0.0.1:1/")
+	assert.True(t, IsOffline(err))
+	_, err = client.Get("http://caldav.invalid/")
+	assert.True(t, IsOffline(err))
+	assert.False(t, IsOffline(errors.New("no events found")))
+	assert.False(t, IsOffline(nil))
+
+	// server is reached, but its certificate isn't trusted
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+	assert.False(t, IsOffline(err))
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	_, err = (&http.Client{Timeout: 10 * time.Millisecond}).Get(slow.URL)
+	assert.True(t, IsOffline(err))
+}
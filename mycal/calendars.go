@@ -0,0 +1,275 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/go-ical"
+)
+
+// CalendarProps are properties of calendar collection that are worth keeping in backups
+type CalendarProps struct {
+	Path        string
+	Name        string // last segment of path
+	DisplayName string
+	Description string
+	Color       string
+	Order       string // Apple calendar-order, position in client lists
+	Timezone    string // VTIMEZONE in iCalendar format
+	Components  []string
+}
+
+const calendarPropfind = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:A="http://apple.com/ns/ical/">
+	<D:prop>
+		<D:resourcetype/>
+		<D:displayname/>
+		<C:calendar-description/>
+		<C:calendar-timezone/>
+		<C:supported-calendar-component-set/>
+		<A:calendar-color/>
+		<A:calendar-order/>
+	</D:prop>
+</D:propfind>`
+
+func calendarProps(resp *davResponse) CalendarProps {
+	prop := resp.prop()
+	props := CalendarProps{
+		Path:        resp.path(),
+		Name:        path.Base(strings.TrimSuffix(resp.path(), "/")),
+		DisplayName: prop.DisplayName,
+		Description: prop.Description,
+		Color:       prop.Color,
+		Order:       strings.TrimSpace(prop.Order),
+		Timezone:    prop.Timezone,
+	}
+	for _, comp := range prop.Components {
+		props.Components = append(props.Components, comp.Name)
+	}
+	return props
+}
+
+// ListCalendarProps returns properties of every calendar in homeset
+func ListCalendarProps(ctx context.Context, httpClient webdav.HTTPClient, url, homeset string) ([]CalendarProps, error) {
+	ms, err := davRequest(ctx, httpClient, "PROPFIND", collectionURL(url, homeset, ""), "1", calendarPropfind)
+	if err != nil {
+		return nil, err
+	}
+	var calendars []CalendarProps
+	for _, resp := range ms.Responses {
+		if resp.prop().ResourceType.Calendar == nil {
+			continue
+		}
+		calendars = append(calendars, calendarProps(&resp))
+	}
+	return calendars, nil
+}
+
+// GetCalendarProps returns properties of calendar with name in homeset
+func GetCalendarProps(ctx context.Context, httpClient webdav.HTTPClient, url, homeset, calendarName string) (*CalendarProps, error) {
+	ms, err := davRequest(ctx, httpClient, "PROPFIND", collectionURL(url, homeset, calendarName+"/"), "0", calendarPropfind)
+	if err != nil {
+		return nil, err
+	}
+	if len(ms.Responses) == 0 || ms.Responses[0].prop().ResourceType.Calendar == nil {
+		return nil, fmt.Errorf("calendar with name %s not found", calendarName)
+	}
+	props := calendarProps(&ms.Responses[0])
+	return &props, nil
+}
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// MakeCalendar creates calendar with given properties, empty ones are left to server
+func MakeCalendar(ctx context.Context, httpClient webdav.HTTPClient, url, homeset, calendarName string, props *CalendarProps) error {
+	var set strings.Builder
+	if props.DisplayName != "" {
+		fmt.Fprintf(&set, "<D:displayname>%s</D:displayname>", escapeXML(props.DisplayName))
+	}
+	if props.Description != "" {
+		fmt.Fprintf(&set, "<C:calendar-description>%s</C:calendar-description>", escapeXML(props.Description))
+	}
+	if props.Timezone != "" {
+		fmt.Fprintf(&set, "<C:calendar-timezone>%s</C:calendar-timezone>", escapeXML(props.Timezone))
+	}
+	if props.Color != "" {
+		fmt.Fprintf(&set, "<A:calendar-color>%s</A:calendar-color>", escapeXML(props.Color))
+	}
+	if props.Order != "" {
+		fmt.Fprintf(&set, "<A:calendar-order>%s</A:calendar-order>", escapeXML(props.Order))
+	}
+	if len(props.Components) > 0 {
+		set.WriteString("<C:supported-calendar-component-set>")
+		for _, comp := range props.Components {
+			fmt.Fprintf(&set, `<C:comp name="%s"/>`, escapeXML(comp))
+		}
+		set.WriteString("</C:supported-calendar-component-set>")
+	}
+	reqBody := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?>
+	<C:mkcalendar xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:A="http://apple.com/ns/ical/">
+		<D:set>
+			<D:prop>%s</D:prop>
+		</D:set>
+	</C:mkcalendar>`, set.String())
+
+	req, err := http.NewRequestWithContext(ctx, "MKCALENDAR", collectionURL(url, homeset, calendarName+"/"), strings.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=\"utf-8\"")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return &davError{StatusCode: resp.StatusCode, Body: buf.String()}
+	}
+	return nil
+}
+
+// TimezoneCalendar returns VCALENDAR with VTIMEZONE of tzid as calendar-timezone expects it
+func TimezoneCalendar(tzid string) (string, error) {
+	tz, err := LocationTimezone(tzid, time.Now().Year())
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(newCalendar(tz)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// TimezoneID returns TZID of calendar-timezone, empty when calendar has none
+func (props *CalendarProps) TimezoneID() string {
+	tz := timezoneOf(props)
+	if tz == nil {
+		return ""
+	}
+	tzid, _ := tz.Props.Text(ical.PropTimezoneID)
+	return tzid
+}
+
+// CalendarChanges are properties changed by UpdateCalendar, nil fields are kept
+// and empty strings remove property
+type CalendarChanges struct {
+	DisplayName *string
+	Description *string
+	Color       *string
+	Order       *string
+	// Timezone is VCALENDAR with VTIMEZONE, see TimezoneCalendar
+	Timezone *string
+	// Components replace supported-calendar-component-set when not nil,
+	// most servers allow it only when calendar is created
+	Components []string
+}
+
+// proppatchStatus is multistatus answer to PROPPATCH, statuses are per property
+type proppatchStatus struct {
+	Responses []struct {
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				Names []struct {
+					XMLName xml.Name
+				} `xml:",any"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// UpdateCalendar changes properties of calendar with PROPPATCH, server applies
+// all of them or none, error names properties it refused
+func UpdateCalendar(ctx context.Context, httpClient webdav.HTTPClient, url, homeset, calendarName string, changes *CalendarChanges) error {
+	var set, remove strings.Builder
+	for _, prop := range []struct {
+		element string
+		value   *string
+	}{
+		{"D:displayname", changes.DisplayName},
+		{"C:calendar-description", changes.Description},
+		{"A:calendar-color", changes.Color},
+		{"A:calendar-order", changes.Order},
+		{"C:calendar-timezone", changes.Timezone},
+	} {
+		switch {
+		case prop.value == nil:
+		case *prop.value == "":
+			fmt.Fprintf(&remove, "<%s/>", prop.element)
+		default:
+			fmt.Fprintf(&set, "<%s>%s</%s>", prop.element, escapeXML(*prop.value), prop.element)
+		}
+	}
+	if changes.Components != nil {
+		set.WriteString("<C:supported-calendar-component-set>")
+		for _, comp := range changes.Components {
+			fmt.Fprintf(&set, `<C:comp name="%s"/>`, escapeXML(comp))
+		}
+		set.WriteString("</C:supported-calendar-component-set>")
+	}
+	if set.Len() == 0 && remove.Len() == 0 {
+		return fmt.Errorf("nothing to change")
+	}
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0" encoding="utf-8" ?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:A="http://apple.com/ns/ical/">`)
+	if set.Len() > 0 {
+		fmt.Fprintf(&body, "<D:set><D:prop>%s</D:prop></D:set>", set.String())
+	}
+	if remove.Len() > 0 {
+		fmt.Fprintf(&body, "<D:remove><D:prop>%s</D:prop></D:remove>", remove.String())
+	}
+	body.WriteString("</D:propertyupdate>")
+
+	req, err := http.NewRequestWithContext(ctx, "PROPPATCH", collectionURL(url, homeset, calendarName+"/"), strings.NewReader(body.String()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=\"utf-8\"")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	if resp.StatusCode != http.StatusMultiStatus {
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		return &davError{StatusCode: resp.StatusCode, Body: buf.String()}
+	}
+	var ms proppatchStatus
+	if err := xml.Unmarshal(buf.Bytes(), &ms); err != nil {
+		return err
+	}
+	var failed []string
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			// 424 Failed Dependency marks properties not applied because of others
+			if code := statusCode(ps.Status); code >= 300 && code != http.StatusFailedDependency {
+				for _, name := range ps.Prop.Names {
+					failed = append(failed, fmt.Sprintf("%s (%s)", name.XMLName.Local, strings.Join(strings.Fields(ps.Status)[1:], " ")))
+				}
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("server refused to change %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package mycal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateCalendar(t *testing.T) {
+	var body string
+	answer := `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:"><d:response><d:href>/cal/work/</d:href>` +
+		`<d:propstat><d:prop><d:displayname/></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response></d:multistatus>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		assert.Equal(t, "PROPPATCH", r.Method)
+		assert.Equal(t, "/cal/work/", r.URL.Path)
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, answer)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	name, color, empty := "Work & life", "#FF0000FF", ""
+	err := UpdateCalendar(ctx, server.Client(), server.URL, "/cal/", "work", &CalendarChanges{
+		DisplayName: &name, Color: &color, Description: &empty, Components: []string{"VTODO"}})
+	assert.NoError(t, err)
+	assert.Contains(t, body, "<D:set><D:prop><D:displayname>Work &amp; life</D:displayname><A:calendar-color>#FF0000FF</A:calendar-color>"+
+		`<C:supported-calendar-component-set><C:comp name="VTODO"/></C:supported-calendar-component-set></D:prop></D:set>`)
+	assert.Contains(t, body, "<D:remove><D:prop><C:calendar-description/></D:prop></D:remove>")
+	assert.NotContains(t, body, "calendar-order")
+
+	assert.Error(t, UpdateCalendar(ctx, server.Client(), server.URL, "/cal/", "work", &CalendarChanges{}))
+
+	answer = `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:response><d:href>/cal/work/</d:href>` +
+		`<d:propstat><d:prop><c:supported-calendar-component-set/></d:prop><d:status>HTTP/1.1 403 Forbidden</d:status></d:propstat>` +
+		`<d:propstat><d:prop><d:displayname/></d:prop><d:status>HTTP/1.1 424 Failed Dependency</d:status></d:propstat></d:response></d:multistatus>`
+	err = UpdateCalendar(ctx, server.Client(), server.URL, "/cal/", "work", &CalendarChanges{DisplayName: &name, Components: []string{"VTODO"}})
+	if assert.Error(t, err) {
+		assert.Equal(t, "server refused to change supported-calendar-component-set (403 Forbidden)", err.Error())
+	}
+}
+
+func TestTimezoneCalendar(t *testing.T) {
+	data, err := TimezoneCalendar("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	assert.True(t, strings.HasPrefix(data, "BEGIN:VCALENDAR"))
+	props := &CalendarProps{Timezone: data}
+	assert.Equal(t, "Europe/Berlin", props.TimezoneID())
+	assert.Contains(t, data, "BEGIN:DAYLIGHT")
+
+	_, err = TimezoneCalendar("Nowhere/City")
+	assert.Error(t, err)
+	assert.Empty(t, (&CalendarProps{}).TimezoneID())
+}
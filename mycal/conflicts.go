@@ -0,0 +1,121 @@
+package mycal
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// ConflictHorizon is how far recurring events are checked when no end is given
+var ConflictHorizon = 365 * 24 * time.Hour
+
+// Overlap is busy occurrence that overlaps busy occurrence With of another event
+type Overlap struct {
+	Occurrence
+	With Occurrence
+}
+
+func overlaps(a, b Period) bool {
+	return a.Start.Before(b.End) && b.Start.Before(a.End)
+}
+
+// EventConflicts checks every occurrence of events in cal until given time against busy
+// occurrences of calendars, the event itself is skipped by UID. Recurring events are
+// expanded with their overrides, transparent and cancelled ones never conflict.
+func EventConflicts(ctx context.Context, client *caldav.Client, calendars []CalendarProps, cal *ical.Calendar, until time.Time, loc *time.Location) ([]Overlap, error) {
+	var start time.Time
+	uids := make(map[string]bool)
+	for _, comp := range cal.Children {
+		if comp.Name != ical.CompEvent {
+			continue
+		}
+		uid, _ := comp.Props.Text(ical.PropUID)
+		uids[uid] = true
+		dtStart, err := (&ical.Event{Component: comp}).DateTimeStart(loc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", uid, err)
+		}
+		if start.IsZero() || dtStart.Before(start) {
+			start = dtStart
+		}
+	}
+	if start.IsZero() {
+		return nil, nil
+	}
+	if until.IsZero() {
+		until = start.Add(ConflictHorizon)
+	}
+	occs, err := ObjectOccurrences(cal, start, until, loc)
+	if err != nil {
+		return nil, err
+	}
+	var busy []Occurrence
+	end := start
+	for _, occ := range occs {
+		if occ.Busy {
+			busy = append(busy, occ)
+			if occ.End.After(end) {
+				end = occ.End
+			}
+		}
+	}
+	if len(busy) == 0 {
+		return nil, nil
+	}
+	SortOccurrences(busy)
+
+	others, err := CollectOccurrences(ctx, client, calendars, busy[0].Start, end, loc)
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []Overlap
+	for _, occ := range busy {
+		for _, other := range others {
+			if other.Busy && !uids[other.UID] && overlaps(occ.Period, other.Period) {
+				conflicts = append(conflicts, Overlap{Occurrence: occ, With: other})
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// ListConflicts finds every pair of busy occurrences of calendars that overlap in [start, end)
+func ListConflicts(ctx context.Context, client *caldav.Client, calendars []CalendarProps, start, end time.Time, loc *time.Location) ([]Overlap, error) {
+	occs, err := CollectOccurrences(ctx, client, calendars, start, end, loc)
+	if err != nil {
+		return nil, err
+	}
+	var busy []Occurrence
+	for _, occ := range occs {
+		if occ.Busy {
+			busy = append(busy, occ)
+		}
+	}
+	var conflicts []Overlap
+	// occurrences are sorted by start, so later ones can't overlap once one starts after end
+	for i, occ := range busy {
+		for _, other := range busy[i+1:] {
+			if !other.Start.Before(occ.End) {
+				break
+			}
+			if other.UID != occ.UID && overlaps(occ.Period, other.Period) {
+				conflicts = append(conflicts, Overlap{Occurrence: occ, With: other})
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// calendarsOf turns calendars found by client into properties CollectOccurrences takes
+func calendarsOf(calendars []caldav.Calendar) []CalendarProps {
+	props := make([]CalendarProps, 0, len(calendars))
+	for _, calendar := range calendars {
+		props = append(props, CalendarProps{Path: calendar.Path, Name: path.Base(strings.TrimSuffix(calendar.Path, "/")), DisplayName: calendar.Name})
+	}
+	return props
+}
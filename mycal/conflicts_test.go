@@ -0,0 +1,72 @@
+package mycal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+const conflictFocus = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VEVENT\r\nUID:focus\r\n" +
+	"DTSTAMP:20240701T000000Z\r\nSUMMARY:Focus\r\nDTSTART:20240701T050000Z\r\nDTEND:20240705T080000Z\r\n" +
+	"TRANSP:TRANSPARENT\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+const conflictReview = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VEVENT\r\nUID:review\r\n" +
+	"DTSTAMP:20240701T000000Z\r\nSUMMARY:Review\r\nDTSTART:20240701T060500Z\r\nDTEND:20240701T063500Z\r\n" +
+	"RRULE:FREQ=DAILY;COUNT=4\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func conflictSetup(t *testing.T) (*fakeDAV, []CalendarProps) {
+	dav := newFakeDAV("work", "home")
+	dav.put(syncHomeset+"work/standup.ics", agendaData)
+	dav.put(syncHomeset+"home/focus.ics", conflictFocus)
+	return dav, []CalendarProps{{Path: syncHomeset + "work/", Name: "work"}, {Path: syncHomeset + "home/", Name: "home"}}
+}
+
+func TestEventConflicts(t *testing.T) {
+	dav, calendars := conflictSetup(t)
+	_, client := startFakeDAV(t, dav)
+	cal, err := ical.NewDecoder(strings.NewReader(conflictReview)).Decode()
+	assert.NoError(t, err)
+
+	// moved and cancelled standups don't conflict, transparent focus never does
+	overlaps, err := EventConflicts(context.Background(), client, calendars, cal, time.Time{}, time.UTC)
+	assert.NoError(t, err)
+	var got []string
+	for _, overlap := range overlaps {
+		got = append(got, overlap.Start.Format("02 15:04 ")+overlap.With.Summary+" "+overlap.With.Calendar)
+	}
+	assert.Equal(t, []string{"01 06:05 Standup work", "04 06:05 Standup work"}, got)
+
+	overlaps, err = EventConflicts(context.Background(), client, calendars, cal, time.Date(2024, 7, 2, 0, 0, 0, 0, time.UTC), time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, overlaps, 1)
+
+	cal.Children[0].Props.SetText(ical.PropTransparency, "TRANSPARENT")
+	overlaps, err = EventConflicts(context.Background(), client, calendars, cal, time.Time{}, time.UTC)
+	assert.NoError(t, err)
+	assert.Empty(t, overlaps)
+
+	// event that is already on server doesn't conflict with itself
+	cal, _ = ical.NewDecoder(strings.NewReader(agendaData)).Decode()
+	overlaps, err = EventConflicts(context.Background(), client, calendars, cal, time.Time{}, time.UTC)
+	assert.NoError(t, err)
+	assert.Empty(t, overlaps)
+}
+
+func TestListConflicts(t *testing.T) {
+	dav, calendars := conflictSetup(t)
+	dav.put(syncHomeset+"home/review.ics", conflictReview)
+	_, client := startFakeDAV(t, dav)
+
+	start := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	overlaps, err := ListConflicts(context.Background(), client, calendars, start, start.AddDate(0, 0, 3), time.UTC)
+	assert.NoError(t, err)
+	if assert.Len(t, overlaps, 1) {
+		assert.Equal(t, "Standup", overlaps[0].Summary)
+		assert.Equal(t, "Review", overlaps[0].With.Summary)
+		assert.Equal(t, start.Add(6*time.Hour), overlaps[0].Start)
+	}
+}
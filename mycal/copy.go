@@ -0,0 +1,147 @@
+package mycal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+)
+
+// ErrUIDExists is returned when destination calendar has object with the same UID
+// and overwriting it wasn't asked for
+var ErrUIDExists = errors.New("destination calendar already has object with this UID")
+
+type CopyOptions struct {
+	// Move deletes source object once it is copied
+	Move bool
+	// Overwrite replaces object with the same UID in destination calendar
+	Overwrite bool
+}
+
+// CopyResult tells where object was put and how
+type CopyResult struct {
+	Source      string
+	Destination string
+	// ETag is empty when server didn't send one
+	ETag string
+	// Method is COPY or MOVE when server did it, PUT when client copied object
+	Method string
+}
+
+// copyFallback are statuses of COPY and MOVE from servers that don't support
+// them or can't copy to destination, e.g. 502 for another server
+func copyFallback(code int) bool {
+	switch code {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusMethodNotAllowed,
+		http.StatusNotImplemented, http.StatusBadGateway:
+		return true
+	}
+	return false
+}
+
+// davCopy sends COPY or MOVE of object with etag, existing destination is never overwritten
+func davCopy(ctx context.Context, httpClient webdav.HTTPClient, method, srcURL, dstURL, etag string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, srcURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Destination", dstURL)
+	req.Header.Set("Overwrite", "F")
+	req.Header.Set("If-Match", `"`+etag+`"`)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", &davError{StatusCode: resp.StatusCode}
+	}
+	return unquoteETag(resp.Header.Get("ETag")), nil
+}
+
+func isPrecondition(err error) bool {
+	var de *davError
+	return errors.As(err, &de) && de.StatusCode == http.StatusPreconditionFailed
+}
+
+// CopyObject copies or moves event, todo or journal with uid from calendar of src
+// to calendar of dst, source calendar is searched in all calendars when empty.
+// Server copies object itself when both calendars are on it, otherwise object is
+// fetched, put and deleted by client. Writes are guarded by ETags, so objects
+// changed by someone else meanwhile are neither overwritten nor deleted.
+func CopyObject(ctx context.Context, src, dst *Endpoint, srcCalendar, uid, dstCalendar string, opts CopyOptions) (*CopyResult, error) {
+	found, err := FindObject(ctx, src.Client, src.Homeset, srcCalendar, uid)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := OpenObject(ctx, src.HTTPClient, src.URL, found.Path)
+	if err != nil {
+		return nil, err
+	}
+	sameServer := src.URL == dst.URL
+	res := &CopyResult{Source: obj.Path, Destination: dst.Homeset + dstCalendar + "/" + path.Base(obj.Path)}
+
+	var dstETag string
+	existing, err := FindObject(ctx, dst.Client, dst.Homeset, dstCalendar, uid)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return nil, err
+	case sameServer && existing.Path == obj.Path:
+		return nil, fmt.Errorf("object %s is already in calendar %s", uid, dstCalendar)
+	case !opts.Overwrite:
+		return nil, fmt.Errorf("%w: %s", ErrUIDExists, existing.Path)
+	default:
+		res.Destination = existing.Path
+		dstETag = unquoteETag(existing.ETag)
+	}
+	srcURL := collectionURL(src.URL, obj.Path, "")
+	dstURL := collectionURL(dst.URL, res.Destination, "")
+
+	// objects that are overwritten go through PUT, it can check their ETag
+	if sameServer && dstETag == "" {
+		method := "COPY"
+		if opts.Move {
+			method = "MOVE"
+		}
+		res.ETag, err = davCopy(ctx, src.HTTPClient, method, srcURL, dstURL, obj.ETag)
+		var de *davError
+		switch {
+		case err == nil:
+			res.Method = method
+			return res, nil
+		case isPrecondition(err):
+			// either source changed or destination name is taken, ETag tells which
+			if current, err := OpenObject(ctx, src.HTTPClient, src.URL, obj.Path); err == nil && current.ETag != obj.ETag {
+				return nil, fmt.Errorf("%s: %w", obj.Path, ErrChanged)
+			}
+			return nil, fmt.Errorf("%s already exists in calendar %s", path.Base(res.Destination), dstCalendar)
+		case !errors.As(err, &de) || !copyFallback(de.StatusCode):
+			return nil, fmt.Errorf("%s %s: %v", method, obj.Path, err)
+		}
+	}
+
+	res.Method = http.MethodPut
+	res.ETag, err = writeObject(ctx, dst.HTTPClient, http.MethodPut, dstURL, dstETag, obj.Data)
+	switch {
+	case isPrecondition(err) && dstETag != "":
+		return nil, fmt.Errorf("%s was changed on server meanwhile, it is not overwritten", res.Destination)
+	case isPrecondition(err):
+		return nil, fmt.Errorf("%s already exists in calendar %s", path.Base(res.Destination), dstCalendar)
+	case err != nil:
+		return nil, err
+	}
+	if opts.Move {
+		_, err = writeObject(ctx, src.HTTPClient, http.MethodDelete, srcURL, obj.ETag, nil)
+		if isPrecondition(err) {
+			return res, fmt.Errorf("copied to %s, source is kept: %w", res.Destination, ErrChanged)
+		}
+		if err != nil {
+			return res, fmt.Errorf("copied to %s, source is kept: %v", res.Destination, err)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package mycal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeEndpoint(t *testing.T, dav *fakeDAV) *Endpoint {
+	server, client := startFakeDAV(t, dav)
+	return &Endpoint{HTTPClient: server.Client(), Client: client, URL: server.URL, Homeset: syncHomeset}
+}
+
+func TestCopyObject(t *testing.T) {
+	ctx := context.Background()
+	for _, copies := range []bool{true, false} {
+		dav := newFakeDAV("work", "home")
+		dav.copies = copies
+		dav.put(syncHomeset+"work/a.ics", calendarData("a"))
+		dav.put(syncHomeset+"work/b.ics", calendarData("b"))
+		end := fakeEndpoint(t, dav)
+		method := map[bool]string{true: "MOVE", false: "PUT"}[copies]
+
+		res, err := CopyObject(ctx, end, end, "", "a", "home", CopyOptions{Move: true})
+		assert.NoError(t, err)
+		if assert.NotNil(t, res) {
+			assert.Equal(t, method, res.Method)
+			assert.Equal(t, syncHomeset+"home/a.ics", res.Destination)
+		}
+		assert.Equal(t, []string{syncHomeset + "home/a.ics", syncHomeset + "work/b.ics"}, dav.paths(syncHomeset))
+
+		res, err = CopyObject(ctx, end, end, "work", "b", "home", CopyOptions{})
+		assert.NoError(t, err)
+		assert.Len(t, dav.paths(syncHomeset), 3)
+
+		// same UID in destination
+		_, err = CopyObject(ctx, end, end, "work", "b", "home", CopyOptions{})
+		assert.True(t, errors.Is(err, ErrUIDExists))
+		_, err = CopyObject(ctx, end, end, "home", "b", "home", CopyOptions{Overwrite: true})
+		assert.Error(t, err)
+		dav.put(syncHomeset+"work/b.ics", calendarData("b")+"\r\n")
+		res, err = CopyObject(ctx, end, end, "work", "b", "home", CopyOptions{Overwrite: true})
+		assert.NoError(t, err)
+		if assert.NotNil(t, res) {
+			assert.Equal(t, "PUT", res.Method)
+			assert.Equal(t, calendarData("b")+"\r\n", dav.objects[syncHomeset+"home/b.ics"])
+		}
+
+		// file name taken by other object
+		dav.put(syncHomeset+"work/c.ics", calendarData("c"))
+		dav.put(syncHomeset+"home/c.ics", calendarData("other"))
+		_, err = CopyObject(ctx, end, end, "work", "c", "home", CopyOptions{Move: true})
+		assert.ErrorContains(t, err, "c.ics already exists")
+		assert.Equal(t, calendarData("other"), dav.objects[syncHomeset+"home/c.ics"])
+		assert.Contains(t, dav.objects, syncHomeset+"work/c.ics")
+
+		_, err = CopyObject(ctx, end, end, "work", "missing", "home", CopyOptions{})
+		assert.True(t, errors.Is(err, ErrNotFound))
+	}
+}
+
+func TestCopyObjectBetweenAccounts(t *testing.T) {
+	ctx := context.Background()
+	srcDAV, dstDAV := newFakeDAV("work"), newFakeDAV("archive")
+	srcDAV.put(syncHomeset+"work/a.ics", calendarData("a"))
+	src, dst := fakeEndpoint(t, srcDAV), fakeEndpoint(t, dstDAV)
+
+	res, err := CopyObject(ctx, src, dst, "work", "a", "archive", CopyOptions{Move: true})
+	assert.NoError(t, err)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "PUT", res.Method)
+		assert.NotEmpty(t, res.ETag)
+	}
+	assert.Empty(t, srcDAV.objects)
+	assert.Equal(t, calendarData("a"), dstDAV.objects[syncHomeset+"archive/a.ics"])
+}
@@ -0,0 +1,378 @@
+package mycal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/teambition/rrule-go"
+	"github.com/trvita/go-ical"
+)
+
+// fields of events and todos that can be CSV columns
+const (
+	CSVType       = "type"
+	CSVUID        = "uid"
+	CSVSummary    = "summary"
+	CSVStart      = "start"
+	CSVEnd        = "end"
+	CSVDue        = "due"
+	CSVLocation   = "location"
+	CSVAttendees  = "attendees"
+	CSVOrganizer  = "organizer"
+	CSVStatus     = "status"
+	CSVFrequency  = "frequency"
+	CSVInterval   = "interval"
+	CSVCount      = "count"
+	CSVUntil      = "until"
+	csvDateLayout = "2006-01-02 15:04"
+)
+
+var CSVFields = []string{CSVType, CSVUID, CSVSummary, CSVStart, CSVEnd, CSVDue, CSVLocation, CSVAttendees,
+	CSVOrganizer, CSVStatus, CSVFrequency, CSVInterval, CSVCount, CSVUntil}
+
+var DefaultCSVColumns = []string{CSVSummary, CSVStart, CSVEnd, CSVLocation, CSVAttendees, CSVStatus, CSVDue}
+
+// layouts tried when mapping has no date format
+var csvDateLayouts = []string{csvDateLayout, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02T15:04", time.RFC3339, "2006-01-02"}
+
+// CSVMapping says which column of file holds which field and how dates are written,
+// it is read from json file:
+//
+//	{"columns": {"summary": "Shift", "start": "From"}, "date_format": "02.01.2006 15:04", "timezone": "Europe/Moscow"}
+type CSVMapping struct {
+	// Columns maps field to header of column, fields without entry use their own name
+	Columns map[string]string `json:"columns"`
+	// DateFormat is Go time layout, several common layouts are tried when empty
+	DateFormat string `json:"date_format"`
+	// Timezone is assumed for dates without offset, local time when empty
+	Timezone string `json:"timezone"`
+	// Type is VEVENT or VTODO for rows without type column, VEVENT when empty
+	Type string `json:"type"`
+}
+
+func LoadCSVMapping(path string) (*CSVMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mapping := &CSVMapping{}
+	if err := json.Unmarshal(data, mapping); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for field := range mapping.Columns {
+		if !contains(CSVFields, field) {
+			return nil, fmt.Errorf("%s: unknown field %s", path, field)
+		}
+	}
+	return mapping, nil
+}
+
+func (m *CSVMapping) header(field string) string {
+	if m != nil && m.Columns[field] != "" {
+		return m.Columns[field]
+	}
+	return field
+}
+
+func (m *CSVMapping) location() (*time.Location, error) {
+	if m == nil || m.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(m.Timezone)
+}
+
+func (m *CSVMapping) parseTime(value string, loc *time.Location) (time.Time, error) {
+	if m != nil && m.DateFormat != "" {
+		return time.ParseInLocation(m.DateFormat, value, loc)
+	}
+	for _, layout := range csvDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format of %q", value)
+}
+
+func (m *CSVMapping) formatTime(t time.Time, loc *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	layout := csvDateLayout
+	if m != nil && m.DateFormat != "" {
+		layout = m.DateFormat
+	}
+	return t.In(loc).Format(layout)
+}
+
+// ExportCSV writes one row per event and todo of objects, columns are fields
+// from CSVFields, DefaultCSVColumns when empty
+func ExportCSV(w io.Writer, comps []*ical.Component, columns []string, mapping *CSVMapping) error {
+	if len(columns) == 0 {
+		columns = DefaultCSVColumns
+	}
+	header := make([]string, len(columns))
+	for i, field := range columns {
+		if !contains(CSVFields, field) {
+			return fmt.Errorf("unknown CSV column %s", field)
+		}
+		header[i] = mapping.header(field)
+	}
+	loc, err := mapping.location()
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, comp := range comps {
+		if comp.Name != ical.CompEvent && comp.Name != ical.CompToDo {
+			continue
+		}
+		row, err := csvRow(comp, columns, mapping, loc)
+		if err != nil {
+			uid, _ := comp.Props.Text(ical.PropUID)
+			return fmt.Errorf("%s: %v", uid, err)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvRow(comp *ical.Component, columns []string, mapping *CSVMapping, loc *time.Location) ([]string, error) {
+	event, err := EventFromComponent(comp)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := comp.Props.RecurrenceRule()
+	if err != nil {
+		return nil, err
+	}
+	row := make([]string, len(columns))
+	for i, field := range columns {
+		switch field {
+		case CSVType:
+			row[i] = event.Name
+		case CSVUID:
+			row[i] = event.Uid
+		case CSVSummary:
+			row[i] = event.Summary
+		case CSVStart:
+			row[i] = mapping.formatTime(event.DateTimeStart, loc)
+		case CSVEnd:
+			if event.Name == ical.CompEvent {
+				row[i] = mapping.formatTime(event.DateTimeEnd, loc)
+			}
+		case CSVDue:
+			if event.Name == ical.CompToDo {
+				row[i] = mapping.formatTime(event.DateTimeEnd, loc)
+			}
+		case CSVLocation:
+			row[i] = event.Location
+		case CSVAttendees:
+			row[i] = strings.Join(event.Attendees, ";")
+		case CSVOrganizer:
+			row[i] = event.Organizer
+		case CSVStatus:
+			row[i] = event.Status
+		}
+		if rule == nil {
+			continue
+		}
+		switch field {
+		case CSVFrequency:
+			row[i] = rule.Freq.String()
+		case CSVInterval:
+			if rule.Interval > 1 {
+				row[i] = strconv.Itoa(rule.Interval)
+			}
+		case CSVCount:
+			if rule.Count > 0 {
+				row[i] = strconv.Itoa(rule.Count)
+			}
+		case CSVUntil:
+			row[i] = mapping.formatTime(rule.Until, loc)
+		}
+	}
+	return row, nil
+}
+
+// CSVRecord is event or todo of one row, Recurrence is set for rows with frequency
+type CSVRecord struct {
+	Line       int
+	Event      *Event
+	Recurrence *ReccurentEvent
+}
+
+// Component builds object of record the same way menu does
+func (rec *CSVRecord) Component() (*ical.Event, error) {
+	// dates are read in time zone of mapping, but stored as UTC since no VTIMEZONE goes with them
+	utc := func(event *Event) *Event {
+		copied := *event
+		copied.DateTimeStart, copied.DateTimeEnd = event.DateTimeStart.UTC(), event.DateTimeEnd.UTC()
+		return &copied
+	}
+	switch {
+	case rec.Recurrence != nil:
+		recurrence := *rec.Recurrence
+		recurrence.Event = utc(rec.Recurrence.Event)
+		event := GetRecurrentEvent(&recurrence)
+		if !rec.Event.DateTimeEnd.IsZero() {
+			event.Props.SetDateTime(ical.PropDateTimeEnd, rec.Event.DateTimeEnd.UTC())
+		}
+		return event, nil
+	case rec.Event.Name == ical.CompToDo:
+		return GetTodo(utc(rec.Event))
+	}
+	return GetEvent(utc(rec.Event))
+}
+
+// ReadCSV reads events and todos from CSV with header row, columns are found
+// by headers of mapping, mapping can be nil
+func ReadCSV(r io.Reader, mapping *CSVMapping) ([]CSVRecord, error) {
+	loc, err := mapping.location()
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv header: %v", err)
+	}
+	index := make(map[string]int)
+	for _, field := range CSVFields {
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), mapping.header(field)) {
+				index[field] = i
+			}
+		}
+	}
+	if _, ok := index[CSVSummary]; !ok {
+		return nil, fmt.Errorf("csv header has no %s column", mapping.header(CSVSummary))
+	}
+
+	var records []CSVRecord
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(field string) string {
+			if i, ok := index[field]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		rec, err := csvRecord(value, mapping, loc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rec.Line = line
+		records = append(records, *rec)
+	}
+	return records, nil
+}
+
+func csvRecord(value func(string) string, mapping *CSVMapping, loc *time.Location) (*CSVRecord, error) {
+	event := &Event{
+		Name:      strings.ToUpper(value(CSVType)),
+		Uid:       value(CSVUID),
+		Summary:   value(CSVSummary),
+		Location:  value(CSVLocation),
+		Status:    value(CSVStatus),
+		Organizer: strings.TrimPrefix(value(CSVOrganizer), "mailto:"),
+	}
+	if event.Name == "" && mapping != nil {
+		event.Name = strings.ToUpper(mapping.Type)
+	}
+	if event.Name == "" {
+		event.Name = ical.CompEvent
+	}
+	if event.Name != ical.CompEvent && event.Name != ical.CompToDo {
+		return nil, fmt.Errorf("type must be VEVENT or VTODO, got %s", event.Name)
+	}
+	if event.Summary == "" {
+		return nil, fmt.Errorf("empty summary")
+	}
+	if event.Uid == "" {
+		event.Uid = uuid.New().String()
+	}
+	for _, attendee := range strings.FieldsFunc(value(CSVAttendees), func(r rune) bool { return r == ';' || r == ',' }) {
+		event.Attendees = append(event.Attendees, strings.TrimPrefix(strings.TrimSpace(attendee), "mailto:"))
+	}
+
+	parse := func(field string) (time.Time, error) {
+		if value(field) == "" {
+			return time.Time{}, nil
+		}
+		t, err := mapping.parseTime(value(field), loc)
+		if err != nil {
+			return t, fmt.Errorf("%s: %v", field, err)
+		}
+		return t, nil
+	}
+	var err error
+	if event.DateTimeStart, err = parse(CSVStart); err != nil {
+		return nil, err
+	}
+	endField := CSVEnd
+	if event.Name == ical.CompToDo {
+		endField = CSVDue
+	}
+	if event.DateTimeEnd, err = parse(endField); err != nil {
+		return nil, err
+	}
+	switch {
+	case event.Name == ical.CompEvent && event.DateTimeStart.IsZero():
+		return nil, fmt.Errorf("event needs start")
+	case event.Name == ical.CompEvent && event.DateTimeEnd.IsZero():
+		event.DateTimeEnd = event.DateTimeStart.Add(time.Hour)
+	case event.Name == ical.CompEvent && event.DateTimeEnd.Before(event.DateTimeStart):
+		return nil, fmt.Errorf("end is before start")
+	case event.Name == ical.CompToDo && event.DateTimeEnd.IsZero():
+		return nil, fmt.Errorf("todo needs due")
+	}
+
+	rec := &CSVRecord{Event: event}
+	if value(CSVFrequency) == "" {
+		return rec, nil
+	}
+	if event.Name != ical.CompEvent {
+		return nil, fmt.Errorf("only events can recur")
+	}
+	freq, err := rrule.StrToFreq(strings.ToUpper(value(CSVFrequency)))
+	if err != nil {
+		return nil, err
+	}
+	// ReccurentEvent keeps end of recurrence in DateTimeEnd
+	recurring := *event
+	recurring.DateTimeEnd = time.Time{}
+	rec.Recurrence = &ReccurentEvent{Event: &recurring, Frequency: int(freq)}
+	for field, target := range map[string]*int{CSVInterval: &rec.Recurrence.Interval, CSVCount: &rec.Recurrence.Count} {
+		if value(field) == "" {
+			continue
+		}
+		if *target, err = strconv.Atoi(value(field)); err != nil {
+			return nil, fmt.Errorf("%s: %v", field, err)
+		}
+	}
+	if recurring.DateTimeEnd, err = parse(CSVUntil); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,97 @@
+package mycal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+const shiftsCSV = `Shift,From,To,Where,People,Kind,Repeat,Times
+Morning shift,01.07.2024 08:00,01.07.2024 16:00,Depot,"ann@example.com; bob@example.com",,,
+Night shift,01.07.2024 22:00,02.07.2024 06:00,Depot,,,weekly,4
+Inventory,,05.07.2024 18:00,,,vtodo,,
+`
+
+func TestReadCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"columns": {"summary": "Shift", "start": "From", "end": "To", "due": "To", "location": "Where",
+			"attendees": "People", "type": "Kind", "frequency": "Repeat", "count": "Times"},
+		"date_format": "02.01.2006 15:04",
+		"timezone": "Europe/Moscow"
+	}`), 0o600))
+	mapping, err := LoadCSVMapping(path)
+	assert.NoError(t, err)
+
+	records, err := ReadCSV(strings.NewReader(shiftsCSV), mapping)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(records))
+
+	moscow, _ := time.LoadLocation("Europe/Moscow")
+	morning := records[0]
+	assert.Equal(t, 2, morning.Line)
+	assert.Equal(t, ical.CompEvent, morning.Event.Name)
+	assert.Equal(t, time.Date(2024, 7, 1, 8, 0, 0, 0, moscow), morning.Event.DateTimeStart)
+	assert.Equal(t, []string{"ann@example.com", "bob@example.com"}, morning.Event.Attendees)
+	assert.Nil(t, morning.Recurrence)
+	event, err := morning.Component()
+	assert.NoError(t, err)
+	location, _ := event.Props.Text(ical.PropLocation)
+	assert.Equal(t, "Depot", location)
+	assert.Equal(t, "20240701T050000Z", event.Props.Get(ical.PropDateTimeStart).Value)
+	assert.Equal(t, 2, len(event.Props.Values(ical.PropAttendee)))
+
+	night, err := records[1].Component()
+	assert.NoError(t, err)
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", night.Props.Get(ical.PropRecurrenceRule).Value)
+	end, err := night.Props.DateTime(ical.PropDateTimeEnd, nil)
+	assert.NoError(t, err)
+	assert.True(t, end.Equal(time.Date(2024, 7, 2, 6, 0, 0, 0, moscow)))
+	summary, _ := night.Props.Text(ical.PropSummary)
+	assert.Equal(t, "Night shift", summary)
+
+	todo, err := records[2].Component()
+	assert.NoError(t, err)
+	assert.Equal(t, ical.CompToDo, todo.Name)
+	assert.Nil(t, todo.Props.Get(ical.PropDateTimeStart))
+	due, err := todo.Props.DateTime(ical.PropDue, nil)
+	assert.NoError(t, err)
+	assert.True(t, due.Equal(time.Date(2024, 7, 5, 18, 0, 0, 0, moscow)))
+
+	_, err = ReadCSV(strings.NewReader("summary,start\nbroken,tomorrow\n"), nil)
+	assert.ErrorContains(t, err, "line 2")
+	_, err = ReadCSV(strings.NewReader("title,start\n"), nil)
+	assert.Error(t, err)
+	_, err = LoadCSVMapping(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestExportCSV(t *testing.T) {
+	records, err := ReadCSV(strings.NewReader(`summary,start,end,due,location,attendees,type,frequency,count
+Standup,2024-07-01 09:00,2024-07-01 09:15,,"Room 1, east",a@example.com;b@example.com,,daily,5
+Report,,,2024-07-05 12:00,,,VTODO,,
+`), &CSVMapping{Timezone: "UTC"})
+	assert.NoError(t, err)
+	var comps []*ical.Component
+	for _, rec := range records {
+		event, err := rec.Component()
+		assert.NoError(t, err)
+		comps = append(comps, event.Component)
+	}
+
+	var buf bytes.Buffer
+	columns := []string{CSVSummary, CSVStart, CSVEnd, CSVDue, CSVLocation, CSVAttendees, CSVStatus, CSVFrequency, CSVCount}
+	assert.NoError(t, ExportCSV(&buf, comps, columns, &CSVMapping{Timezone: "UTC"}))
+	assert.Equal(t, `summary,start,end,due,location,attendees,status,frequency,count
+Standup,2024-07-01 09:00,2024-07-01 09:15,,"Room 1, east",a@example.com;b@example.com,,DAILY,5
+Report,,,2024-07-05 12:00,,,NEEDS-ACTION,,
+`, buf.String())
+
+	assert.Error(t, ExportCSV(&buf, comps, []string{"color"}, nil))
+}
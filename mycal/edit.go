@@ -0,0 +1,279 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// ErrChanged is returned by SaveObject when object on server is not the one that was opened
+var ErrChanged = errors.New("object was changed on server since it was opened, open it again")
+
+// ErrNotFound is returned by FindObject when no calendar has object with uid
+var ErrNotFound = errors.New("no object found")
+
+// ObjectComponents are components an object can be found by
+var ObjectComponents = []string{ical.CompEvent, ical.CompToDo, ical.CompJournal}
+
+// EditedObject is calendar object text opened for editing, ETag guards writing it back
+type EditedObject struct {
+	Path string
+	ETag string
+	Data []byte
+}
+
+func uidQuery(compName, uid string) *caldav.CalendarQuery {
+	return &caldav.CalendarQuery{
+		CompRequest: caldav.CalendarCompRequest{
+			Name: "VCALENDAR",
+			Comps: []caldav.CalendarCompRequest{{
+				Name:     compName,
+				AllProps: true,
+			}},
+		},
+		CompFilter: caldav.CompFilter{
+			Name: "VCALENDAR",
+			Comps: []caldav.CompFilter{{
+				Name: compName,
+				Props: []caldav.PropFilter{{
+					Name:      ical.PropUID,
+					TextMatch: &caldav.TextMatch{Text: uid},
+				}},
+			}},
+		},
+	}
+}
+
+// HasUID checks if any component of calendar has uid
+func HasUID(cal *ical.Calendar, uid string) bool {
+	if cal == nil {
+		return false
+	}
+	for _, comp := range cal.Children {
+		if value, _ := comp.Props.Text(ical.PropUID); value == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// FindObject finds event, todo or journal with uid in calendar, in every calendar
+// of homeset when calendarName is empty
+func FindObject(ctx context.Context, client *caldav.Client, homeset, calendarName, uid string) (*caldav.CalendarObject, error) {
+	paths := []string{homeset + calendarName}
+	if calendarName == "" {
+		calendars, err := client.FindCalendars(ctx, homeset)
+		if err != nil {
+			return nil, err
+		}
+		paths = paths[:0]
+		for _, calendar := range calendars {
+			paths = append(paths, calendar.Path)
+		}
+	}
+	for _, path := range paths {
+		for _, compName := range ObjectComponents {
+			resp, err := client.QueryCalendar(ctx, path, uidQuery(compName, uid))
+			if err != nil {
+				return nil, fmt.Errorf("error getting calendar query: %v", err)
+			}
+			// text-match is substring match, so uid is checked exactly
+			for i := range resp {
+				if HasUID(resp[i].Data, uid) {
+					return &resp[i], nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w with UID %s", ErrNotFound, uid)
+}
+
+// OpenObject fetches object text as server stores it together with its ETag
+func OpenObject(ctx context.Context, httpClient webdav.HTTPClient, url, path string) (*EditedObject, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, collectionURL(url, path, ""), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &davError{StatusCode: resp.StatusCode, Body: buf.String()}
+	}
+	etag := unquoteETag(resp.Header.Get("ETag"))
+	if etag == "" {
+		return nil, fmt.Errorf("%s: server sent no ETag, object can't be saved safely", path)
+	}
+	return &EditedObject{Path: path, ETag: etag, Data: buf.Bytes()}, nil
+}
+
+// PrettyObject re-encodes object, so long lines are folded the same way and
+// line endings are uniform
+func PrettyObject(data []byte) ([]byte, error) {
+	cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CheckObject decodes edited text, it must be one calendar whose events, todos
+// and journals keep uid of object
+func CheckObject(data []byte, uid string) (*ical.Calendar, error) {
+	dec := ical.NewDecoder(bytes.NewReader(data))
+	cal, err := dec.Decode()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Decode(); err == nil {
+		return nil, fmt.Errorf("text has more than one calendar")
+	}
+	found := false
+	for _, comp := range cal.Children {
+		if !contains(ObjectComponents, comp.Name) {
+			continue
+		}
+		value, err := comp.Props.Text(ical.PropUID)
+		if err != nil {
+			return nil, fmt.Errorf("%s has no UID", comp.Name)
+		}
+		if value != uid {
+			return nil, fmt.Errorf("UID can't be changed from %s to %s", uid, value)
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("calendar has no event, todo or journal")
+	}
+	// encoder checks required properties
+	if err := ical.NewEncoder(&bytes.Buffer{}).Encode(cal); err != nil {
+		return nil, err
+	}
+	return cal, nil
+}
+
+// SaveObject puts calendar back if object on server still has ETag it was opened with,
+// ETag of object is updated on success
+func SaveObject(ctx context.Context, httpClient webdav.HTTPClient, url string, obj *EditedObject, cal *ical.Calendar) error {
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return err
+	}
+	etag, err := writeObject(ctx, httpClient, http.MethodPut, collectionURL(url, obj.Path, ""), obj.ETag, buf.Bytes())
+	var de *davError
+	if errors.As(err, &de) && de.StatusCode == http.StatusPreconditionFailed {
+		return ErrChanged
+	}
+	if err != nil {
+		return err
+	}
+	obj.ETag = etag
+	obj.Data = buf.Bytes()
+	return nil
+}
+
+// UpdateObject puts changed calendar of object found on server if object still has ETag
+// it was found with, objects found without ETag get it from server first. ETag of obj is
+// updated on success.
+func UpdateObject(ctx context.Context, httpClient webdav.HTTPClient, url string, obj *caldav.CalendarObject) error {
+	edited := &EditedObject{Path: obj.Path, ETag: unquoteETag(obj.ETag)}
+	if edited.ETag == "" {
+		current, err := OpenObject(ctx, httpClient, url, obj.Path)
+		if err != nil {
+			return err
+		}
+		edited.ETag = current.ETag
+	}
+	if err := SaveObject(ctx, httpClient, url, edited, obj.Data); err != nil {
+		return err
+	}
+	obj.ETag = edited.ETag
+	return nil
+}
+
+// Diff compares texts line by line, changed lines are prefixed with "-" or "+"
+// and shown with context lines prefixed with " ", skipped lines become "..."
+func Diff(a, b string, context int) []string {
+	x := splitLines(a)
+	y := splitLines(b)
+	// lcs[i][j] is length of common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var all []string
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			all = append(all, " "+x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			all = append(all, "-"+x[i])
+			i++
+		default:
+			all = append(all, "+"+y[j])
+			j++
+		}
+	}
+
+	var out []string
+	last := -1
+	for k, line := range all {
+		if line[0] == ' ' {
+			continue
+		}
+		from := max(k-context, last+1)
+		if from > last+1 {
+			out = append(out, "...")
+		}
+		for n := from; n < k; n++ {
+			out = append(out, all[n])
+		}
+		out = append(out, line)
+		last = k
+		// trailing context of this change, next change may continue it
+		for n := k + 1; n < len(all) && n <= k+context && all[n][0] == ' '; n++ {
+			out = append(out, all[n])
+			last = n
+		}
+	}
+	if last >= 0 && last < len(all)-1 {
+		out = append(out, "...")
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
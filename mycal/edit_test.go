@@ -0,0 +1,98 @@
+package mycal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:a\r\nSUMMARY:Old\r\nDTSTART:20240701T090000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	b := "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:a\nSUMMARY:New\nDTSTART:20240701T090000Z\nEND:VEVENT\nEND:VCALENDAR\n"
+	assert.Equal(t, []string{
+		"...",
+		" BEGIN:VEVENT",
+		" UID:a",
+		"-SUMMARY:Old",
+		"+SUMMARY:New",
+		" DTSTART:20240701T090000Z",
+		" END:VEVENT",
+		"...",
+	}, Diff(a, b, 2))
+
+	// line endings alone are no change
+	assert.Empty(t, Diff(a, strings.ReplaceAll(a, "\r\n", "\n"), 2))
+
+	assert.Equal(t, []string{"+x", " a", "-b", "+c"}, Diff("a\nb", "x\na\nc", 1))
+	assert.Equal(t, []string{"-a"}, Diff("a", "", 3))
+}
+
+func TestCheckObject(t *testing.T) {
+	cal, err := CheckObject([]byte(calendarData("a")), "a")
+	assert.NoError(t, err)
+	assert.Len(t, cal.Children, 1)
+
+	for name, text := range map[string]string{
+		"not iCalendar": "SUMMARY:x\r\n",
+		"broken":        strings.Replace(calendarData("a"), "END:VEVENT", "END:VTODO", 1),
+		"changed uid":   calendarData("b"),
+		"two calendars": calendarData("a") + calendarData("a"),
+		"no event":      "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nEND:VCALENDAR\r\n",
+		"no dtstamp":    strings.Replace(calendarData("a"), "DTSTAMP:20240701T090000Z\r\n", "", 1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := CheckObject([]byte(text), "a")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEditObject(t *testing.T) {
+	dav := newFakeDAV("default", "work")
+	dav.put(syncHomeset+"work/x.ics", calendarData("x"))
+	dav.put(syncHomeset+"work/a.ics", calendarData("a"))
+	server, client := startFakeDAV(t, dav)
+	ctx := context.Background()
+	url := server.URL + "/dav.php"
+
+	found, err := FindObject(ctx, client, syncHomeset, "", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, syncHomeset+"work/a.ics", found.Path)
+	_, err = FindObject(ctx, client, syncHomeset, "work/", "missing")
+	assert.Error(t, err)
+
+	obj, err := OpenObject(ctx, server.Client(), url, found.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, calendarData("a"), string(obj.Data))
+	pretty, err := PrettyObject(obj.Data)
+	assert.NoError(t, err)
+	assert.Contains(t, string(pretty), "UID:a\r\n")
+
+	edited := strings.Replace(calendarData("a"), "END:VEVENT", "SUMMARY:Edited\r\nEND:VEVENT", 1)
+	cal, err := CheckObject([]byte(edited), "a")
+	assert.NoError(t, err)
+	assert.NoError(t, SaveObject(ctx, server.Client(), url, obj, cal))
+	assert.Contains(t, dav.objects[found.Path], "SUMMARY:Edited")
+	assert.Equal(t, dav.etags[found.Path], obj.ETag)
+
+	// object changed by someone else after it was opened
+	stale := *obj
+	dav.put(found.Path, calendarData("a"))
+	assert.ErrorIs(t, SaveObject(ctx, server.Client(), url, &stale, cal), ErrChanged)
+	assert.Equal(t, calendarData("a"), dav.objects[found.Path])
+
+	// object found by query keeps ETag it was found with
+	found, err = FindObject(ctx, client, syncHomeset, "work/", "a")
+	assert.NoError(t, err)
+	found.Data = cal
+	assert.NoError(t, UpdateObject(ctx, server.Client(), url, found))
+	assert.Contains(t, dav.objects[found.Path], "SUMMARY:Edited")
+	assert.Equal(t, dav.etags[found.Path], found.ETag)
+	dav.put(found.Path, calendarData("a"))
+	assert.ErrorIs(t, UpdateObject(ctx, server.Client(), url, found), ErrChanged)
+	found.ETag = ""
+	assert.NoError(t, UpdateObject(ctx, server.Client(), url, found))
+	assert.Contains(t, dav.objects[found.Path], "SUMMARY:Edited")
+}
@@ -0,0 +1,191 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// properties of exported calendar, X-WR-* are understood by most calendar apps
+const (
+	PropCalendarID          = "X-WR-RELCALID"
+	PropCalendarName        = "X-WR-CALNAME"
+	PropCalendarDescription = "X-WR-CALDESC"
+	PropCalendarTimezone    = "X-WR-TIMEZONE"
+	PropCalendarColor       = "X-APPLE-CALENDAR-COLOR"
+	PropCalendarOrder       = "X-APPLE-CALENDAR-ORDER"
+	PropCalendarComponents  = "X-CALDAV-SUPPORTED-COMPONENTS"
+)
+
+// textProp makes TEXT property without VALUE parameter, SetText adds it to X- properties
+func textProp(name, value string) *ical.Prop {
+	prop := ical.NewProp(name)
+	prop.SetText(value)
+	prop.Params.Del(ical.ParamValue)
+	return prop
+}
+
+// allObjectsQuery requests every object of calendar whatever component it has
+func allObjectsQuery() *caldav.CalendarQuery {
+	return &caldav.CalendarQuery{
+		CompRequest: caldav.CalendarCompRequest{
+			Name:     "VCALENDAR",
+			AllProps: true,
+			AllComps: true,
+		},
+		CompFilter: caldav.CompFilter{Name: "VCALENDAR"},
+	}
+}
+
+// timezoneOf returns VTIMEZONE of calendar-timezone property
+func timezoneOf(props *CalendarProps) *ical.Component {
+	if props.Timezone == "" {
+		return nil
+	}
+	cal, err := ical.NewDecoder(strings.NewReader(props.Timezone)).Decode()
+	if err != nil {
+		return nil
+	}
+	for _, comp := range cal.Children {
+		if comp.Name == ical.CompTimezone {
+			return comp
+		}
+	}
+	return nil
+}
+
+// MergeCalendar puts objects of calendar into one VCALENDAR with calendar
+// properties, VTIMEZONEs shared by objects are written once
+func MergeCalendar(props *CalendarProps, objects []caldav.CalendarObject) *ical.Calendar {
+	cal := newCalendar()
+	if props.Name != "" {
+		cal.Props.Set(textProp(PropCalendarID, props.Name))
+	}
+	if props.DisplayName != "" {
+		cal.Props.Set(textProp(PropCalendarName, props.DisplayName))
+	}
+	if props.Description != "" {
+		cal.Props.Set(textProp(PropCalendarDescription, props.Description))
+	}
+	if props.Color != "" {
+		cal.Props.Set(textProp(PropCalendarColor, props.Color))
+	}
+	if props.Order != "" {
+		cal.Props.Set(textProp(PropCalendarOrder, props.Order))
+	}
+	if len(props.Components) > 0 {
+		cal.Props.Set(textProp(PropCalendarComponents, strings.Join(props.Components, ",")))
+	}
+
+	seen := make(map[string]bool)
+	addTimezone := func(tz *ical.Component) {
+		tzid, _ := tz.Props.Text(ical.PropTimezoneID)
+		if !seen[tzid] {
+			seen[tzid] = true
+			cal.Children = append(cal.Children, tz)
+		}
+	}
+	if tz := timezoneOf(props); tz != nil {
+		tzid, _ := tz.Props.Text(ical.PropTimezoneID)
+		cal.Props.Set(textProp(PropCalendarTimezone, tzid))
+		addTimezone(tz)
+	}
+	var comps []*ical.Component
+	for _, obj := range objects {
+		for _, comp := range obj.Data.Children {
+			if comp.Name == ical.CompTimezone {
+				addTimezone(comp)
+			} else {
+				comps = append(comps, comp)
+			}
+		}
+	}
+	cal.Children = append(cal.Children, comps...)
+	return cal
+}
+
+// CalendarPropsOf reads calendar properties back from exported calendar
+func CalendarPropsOf(cal *ical.Calendar) *CalendarProps {
+	text := func(name string) string {
+		value, _ := cal.Props.Text(name)
+		return value
+	}
+	props := &CalendarProps{
+		Name:        text(PropCalendarID),
+		DisplayName: text(PropCalendarName),
+		Description: text(PropCalendarDescription),
+		Color:       text(PropCalendarColor),
+		Order:       text(PropCalendarOrder),
+	}
+	if comps := text(PropCalendarComponents); comps != "" {
+		props.Components = strings.Split(comps, ",")
+	}
+	if tzid := text(PropCalendarTimezone); tzid != "" {
+		for _, comp := range cal.Children {
+			if id, _ := comp.Props.Text(ical.PropTimezoneID); comp.Name == ical.CompTimezone && id == tzid {
+				var buf bytes.Buffer
+				if err := ical.NewEncoder(&buf).Encode(newCalendar(comp)); err == nil {
+					props.Timezone = buf.String()
+				}
+			}
+		}
+	}
+	return props
+}
+
+// ExportCalendars merges every calendar of homeset into its own VCALENDAR,
+// names limit export to calendars with these names or display names
+func ExportCalendars(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset string, names []string) ([]*ical.Calendar, error) {
+	calendars, err := ListCalendarProps(ctx, httpClient, url, homeset)
+	if err != nil {
+		return nil, err
+	}
+	var exported []*ical.Calendar
+	for i := range calendars {
+		props := &calendars[i]
+		if len(names) > 0 && !contains(names, props.Name) && !contains(names, props.DisplayName) {
+			continue
+		}
+		objects, err := client.QueryCalendar(ctx, props.Path, allObjectsQuery())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", props.Name, err)
+		}
+		exported = append(exported, MergeCalendar(props, objects))
+	}
+	if len(names) > 0 && len(exported) == 0 {
+		return nil, fmt.Errorf("calendars %s not found", strings.Join(names, ", "))
+	}
+	return exported, nil
+}
+
+// RestoreCalendar imports exported calendar, calendar itself is created with
+// its properties when homeset has none with the same name
+func RestoreCalendar(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset string, cal *ical.Calendar, mode ImportMode) (*ImportReport, error) {
+	props := CalendarPropsOf(cal)
+	if props.Name == "" {
+		props.Name = props.DisplayName
+	}
+	if props.Name == "" {
+		return nil, fmt.Errorf("calendar has no %s or %s", PropCalendarID, PropCalendarName)
+	}
+	_, err := GetCalendarProps(ctx, httpClient, url, homeset, props.Name)
+	var de *davError
+	if errors.As(err, &de) && de.StatusCode == http.StatusNotFound {
+		err = MakeCalendar(ctx, httpClient, url, homeset, props.Name, props)
+	}
+	if err != nil {
+		return nil, err
+	}
+	objects, err := SplitCalendars(cal)
+	if err != nil {
+		return nil, err
+	}
+	return ImportCalendars(ctx, httpClient, client, url, homeset, props.Name, objects, mode)
+}
@@ -0,0 +1,73 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+func TestMergeCalendar(t *testing.T) {
+	cals, err := ReadCalendars(strings.NewReader(importData))
+	assert.NoError(t, err)
+	objects, err := SplitCalendars(cals...)
+	assert.NoError(t, err)
+	// both objects carry same zone, export must have it once
+	objects[1].Children = append([]*ical.Component{objects[0].Children[0]}, objects[1].Children...)
+
+	var tz bytes.Buffer
+	assert.NoError(t, ical.NewEncoder(&tz).Encode(newCalendar(objects[0].Children[0])))
+	props := &CalendarProps{
+		Name:        "work",
+		DisplayName: "Work, main",
+		Description: "meetings",
+		Color:       "#FF0000FF",
+		Timezone:    tz.String(),
+		Components:  []string{"VEVENT", "VTODO"},
+	}
+	merged := MergeCalendar(props, []caldav.CalendarObject{{Data: objects[0]}, {Data: objects[1]}})
+
+	var names []string
+	for _, comp := range merged.Children {
+		names = append(names, comp.Name)
+	}
+	assert.Equal(t, []string{ical.CompTimezone, ical.CompTimezone, ical.CompEvent, ical.CompEvent, ical.CompEvent}, names)
+	assert.Nil(t, merged.Props.Get(PropCalendarName).Params[ical.ParamValue])
+
+	var buf bytes.Buffer
+	assert.NoError(t, ical.NewEncoder(&buf).Encode(merged))
+	assert.Contains(t, buf.String(), "X-WR-CALNAME:Work\\, main\r\n")
+	decoded, err := ical.NewDecoder(&buf).Decode()
+	assert.NoError(t, err)
+	restored := CalendarPropsOf(decoded)
+	assert.Equal(t, props, restored)
+}
+
+func TestExportRestore(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeDAV("default")
+	source.put(syncHomeset+"default/a.ics", calendarData("a"))
+	source.put(syncHomeset+"default/b.ics", calendarData("b"))
+	server, client := startFakeDAV(t, source)
+
+	exported, err := ExportCalendars(ctx, server.Client(), client, server.URL+"/dav.php", syncHomeset, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(exported))
+	id, _ := exported[0].Props.Text(PropCalendarID)
+	assert.Equal(t, "default", id)
+	_, err = ExportCalendars(ctx, server.Client(), client, server.URL+"/dav.php", syncHomeset, []string{"missing"})
+	assert.Error(t, err)
+
+	dest := newFakeDAV()
+	server, client = startFakeDAV(t, dest)
+	report, err := RestoreCalendar(ctx, server.Client(), client, server.URL+"/dav.php", syncHomeset, exported[0], ImportSkip)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, report.Created)
+	assert.Equal(t, 1, len(dest.made))
+	assert.Contains(t, dest.made[0], "<D:displayname>default</D:displayname>")
+	assert.Contains(t, dest.objects, syncHomeset+"default/a.ics")
+}
@@ -0,0 +1,356 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+type SlotOptions struct {
+	Duration  time.Duration
+	From      time.Time
+	To        time.Time
+	WorkStart time.Duration // offset from midnight in Location
+	WorkEnd   time.Duration
+	Location  *time.Location
+	Count     int
+}
+
+type MeetingRequest struct {
+	Summary   string
+	Organizer string
+	Attendees []string
+	Options   SlotOptions
+}
+
+type scheduleResponse struct {
+	XMLName   xml.Name               `xml:"urn:ietf:params:xml:ns:caldav schedule-response"`
+	Responses []scheduleResponseItem `xml:"urn:ietf:params:xml:ns:caldav response"`
+}
+
+type scheduleResponseItem struct {
+	Recipient     string `xml:"urn:ietf:params:xml:ns:caldav recipient>href"`
+	RequestStatus string `xml:"urn:ietf:params:xml:ns:caldav request-status"`
+	CalendarData  string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+// newCalendar wraps components into a VCALENDAR with the client's PRODID
+func newCalendar(comps ...*ical.Component) *ical.Calendar {
+	calendar := ical.NewCalendar()
+	calendar.Props.SetText(ical.PropVersion, "2.0")
+	calendar.Props.SetText(ical.PropProductID, "-//trvita//EN")
+	calendar.Props.SetText(ical.PropCalendarScale, "GREGORIAN")
+	calendar.Children = append(calendar.Children, comps...)
+	return calendar
+}
+
+// collectionURL builds absolute url of a collection in homeset. Homeset is
+// absolute path on server, so it replaces path of url ("/dav.php" on Baikal).
+func collectionURL(url, homeset, name string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url + homeset + name
+	}
+	return u.Scheme + "://" + u.Host + homeset + name
+}
+
+// IsBusy reports whether event blocks time: transparent and cancelled events don't
+func IsBusy(comp *ical.Component) bool {
+	transp, _ := comp.Props.Text(ical.PropTransparency)
+	if strings.EqualFold(transp, "TRANSPARENT") {
+		return false
+	}
+	status, _ := comp.Props.Text(ical.PropStatus)
+	return !strings.EqualFold(status, string(ical.EventCancelled))
+}
+
+// EventPeriods returns occurrences of event that intersect [start, end), recurrences are expanded
+func EventPeriods(comp *ical.Component, start, end time.Time, loc *time.Location) ([]Period, error) {
+	event := ical.Event{Component: comp}
+	dtStart, err := event.DateTimeStart(loc)
+	if err != nil {
+		return nil, err
+	}
+	dtEnd, err := event.DateTimeEnd(loc)
+	if err != nil {
+		return nil, err
+	}
+	length := dtEnd.Sub(dtStart)
+
+	set, err := comp.RecurrenceSet(loc)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		if dtStart.Before(end) && dtEnd.After(start) {
+			return []Period{{Start: dtStart, End: dtEnd}}, nil
+		}
+		return nil, nil
+	}
+
+	var periods []Period
+	for _, occurrence := range set.Between(start.Add(-length), end, true) {
+		p := Period{Start: occurrence, End: occurrence.Add(length)}
+		if p.Start.Before(end) && p.End.After(start) {
+			periods = append(periods, p)
+		}
+	}
+	return periods, nil
+}
+
+// tested
+func MergePeriods(periods []Period) []Period {
+	if len(periods) == 0 {
+		return nil
+	}
+	sorted := make([]Period, len(periods))
+	copy(sorted, periods)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	merged := []Period{sorted[0]}
+	for _, p := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if p.Start.After(last.End) {
+			merged = append(merged, p)
+			continue
+		}
+		if p.End.After(last.End) {
+			last.End = p.End
+		}
+	}
+	return merged
+}
+
+// GetBusy collects busy periods of calendar between start and end
+func GetBusy(ctx context.Context, client *caldav.Client, homeset, calendarName string, start, end time.Time, loc *time.Location) ([]Period, error) {
+	resp, err := client.QueryCalendar(ctx, homeset+calendarName, timeRangeQuery(start, end))
+	if err != nil {
+		return nil, fmt.Errorf("error getting calendar query: %v", err)
+	}
+
+	var busy []Period
+	for _, obj := range resp {
+		for _, comp := range obj.Data.Children {
+			if comp.Name != ical.CompEvent || !IsBusy(comp) {
+				continue
+			}
+			periods, err := EventPeriods(comp, start, end, loc)
+			if err != nil {
+				return nil, err
+			}
+			busy = append(busy, periods...)
+		}
+	}
+	return MergePeriods(busy), nil
+}
+
+// tested
+func ParseFreeBusy(value string) ([]Period, error) {
+	var periods []Period
+	for _, period := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(period), "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid period %q", period)
+		}
+		start, err := time.Parse("20060102T150405Z", parts[0])
+		if err != nil {
+			return nil, err
+		}
+		var end time.Time
+		if strings.HasPrefix(parts[1], "P") {
+			prop := ical.NewProp(ical.PropDuration)
+			prop.Value = parts[1]
+			dur, err := prop.Duration()
+			if err != nil {
+				return nil, err
+			}
+			end = start.Add(dur)
+		} else {
+			end, err = time.Parse("20060102T150405Z", parts[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		periods = append(periods, Period{Start: start, End: end})
+	}
+	return periods, nil
+}
+
+// FreeBusyQuery asks the server for busy time of attendees via schedule outbox (RFC 6638)
+func FreeBusyQuery(ctx context.Context, httpClient webdav.HTTPClient, url, homeset, organizer string, attendees []string, start, end time.Time) (map[string][]Period, error) {
+	freebusy := ical.NewComponent(ical.CompFreeBusy)
+	freebusy.Props.SetText(ical.PropUID, uuid.New().String())
+	freebusy.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	freebusy.Props.SetDateTime(ical.PropDateTimeStart, start.UTC())
+	freebusy.Props.SetDateTime(ical.PropDateTimeEnd, end.UTC())
+	propOrg := ical.NewProp(ical.PropOrganizer)
+	propOrg.Value = "mailto:" + organizer
+	freebusy.Props.Add(propOrg)
+	for _, attendee := range attendees {
+		prop := ical.NewProp(ical.PropAttendee)
+		prop.Value = "mailto:" + attendee
+		freebusy.Props.Add(prop)
+	}
+	calendar := newCalendar(freebusy)
+	calendar.Props.SetText(ical.PropMethod, "REQUEST")
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(calendar); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, collectionURL(url, homeset, "outbox/"), &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8; method=REQUEST")
+	req.Header.Set("Originator", "mailto:"+organizer)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %v", resp.StatusCode)
+	}
+
+	var sr scheduleResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return nil, err
+	}
+
+	busy := make(map[string][]Period)
+	for _, r := range sr.Responses {
+		recipient := strings.TrimPrefix(strings.TrimSpace(r.Recipient), "mailto:")
+		if !strings.HasPrefix(r.RequestStatus, "2.") {
+			return nil, fmt.Errorf("free/busy for %s: %s", recipient, r.RequestStatus)
+		}
+		cal, err := ical.NewDecoder(strings.NewReader(r.CalendarData)).Decode()
+		if err != nil {
+			return nil, err
+		}
+		var periods []Period
+		for _, comp := range cal.Children {
+			if comp.Name != ical.CompFreeBusy {
+				continue
+			}
+			for _, fb := range comp.Props.Values(ical.PropFreeBusy) {
+				if fbtype := fb.Params.Get(ical.ParamFreeBusyType); strings.EqualFold(fbtype, "FREE") {
+					continue
+				}
+				p, err := ParseFreeBusy(fb.Value)
+				if err != nil {
+					return nil, err
+				}
+				periods = append(periods, p...)
+			}
+		}
+		busy[recipient] = MergePeriods(periods)
+	}
+	return busy, nil
+}
+
+// tested
+func FindSlots(busy []Period, opts *SlotOptions) []Period {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	busy = MergePeriods(busy)
+
+	var slots []Period
+	from := opts.From.In(loc)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(opts.To) && len(slots) < opts.Count; day = day.AddDate(0, 0, 1) {
+		// time.Date keeps working hours in wall clock time across DST changes
+		windowStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, int(opts.WorkStart.Seconds()), 0, loc)
+		windowEnd := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, int(opts.WorkEnd.Seconds()), 0, loc)
+		if windowStart.Before(opts.From) {
+			windowStart = opts.From
+		}
+		if windowEnd.After(opts.To) {
+			windowEnd = opts.To
+		}
+
+		cursor := windowStart
+		for _, b := range append(busy, Period{Start: windowEnd, End: windowEnd}) {
+			if !b.End.After(cursor) {
+				continue
+			}
+			freeEnd := b.Start
+			if freeEnd.After(windowEnd) {
+				freeEnd = windowEnd
+			}
+			for !cursor.Add(opts.Duration).After(freeEnd) && len(slots) < opts.Count {
+				slots = append(slots, Period{Start: cursor, End: cursor.Add(opts.Duration)})
+				cursor = cursor.Add(opts.Duration)
+			}
+			if !b.End.Before(windowEnd) {
+				break
+			}
+			if b.End.After(cursor) {
+				cursor = b.End
+			}
+		}
+	}
+	return slots
+}
+
+// FindMeetingSlots returns first free slots common for organizer's calendars and all attendees
+func FindMeetingSlots(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset string, meeting *MeetingRequest) ([]Period, error) {
+	opts := meeting.Options
+	calendars, err := client.FindCalendars(ctx, homeset)
+	if err != nil {
+		return nil, err
+	}
+	var busy []Period
+	for _, calendar := range calendars {
+		periods, err := GetBusy(ctx, client, calendar.Path, "", opts.From, opts.To, opts.Location)
+		if err != nil {
+			return nil, err
+		}
+		busy = append(busy, periods...)
+	}
+
+	if len(meeting.Attendees) > 0 {
+		attendeesBusy, err := FreeBusyQuery(ctx, httpClient, url, homeset, meeting.Organizer, meeting.Attendees, opts.From, opts.To)
+		if err != nil {
+			return nil, err
+		}
+		for _, periods := range attendeesBusy {
+			busy = append(busy, periods...)
+		}
+	}
+	return FindSlots(busy, &opts), nil
+}
+
+// MeetingEvent makes event for chosen slot that can be passed to GetEvent
+func MeetingEvent(meeting *MeetingRequest, slot Period) *Event {
+	return &Event{
+		Name:          ical.CompEvent,
+		Summary:       meeting.Summary,
+		Uid:           uuid.New().String(),
+		DateTimeStart: slot.Start.UTC(),
+		DateTimeEnd:   slot.End.UTC(),
+		Attendees:     meeting.Attendees,
+		Organizer:     meeting.Organizer,
+	}
+}
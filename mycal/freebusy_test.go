@@ -0,0 +1,118 @@
+package mycal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+func at(day, hour, min int) time.Time {
+	return time.Date(2024, time.July, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestMergePeriods(t *testing.T) {
+	merged := MergePeriods([]Period{
+		{Start: at(1, 12, 0), End: at(1, 13, 0)},
+		{Start: at(1, 9, 0), End: at(1, 10, 0)},
+		{Start: at(1, 9, 30), End: at(1, 11, 0)},
+		{Start: at(1, 11, 0), End: at(1, 11, 30)},
+	})
+	assert.Equal(t, []Period{
+		{Start: at(1, 9, 0), End: at(1, 11, 30)},
+		{Start: at(1, 12, 0), End: at(1, 13, 0)},
+	}, merged)
+	assert.Nil(t, MergePeriods(nil))
+}
+
+func TestParseFreeBusy(t *testing.T) {
+	periods, err := ParseFreeBusy("20240701T090000Z/20240701T100000Z,20240701T120000Z/PT30M")
+	assert.NoError(t, err)
+	assert.Equal(t, []Period{
+		{Start: at(1, 9, 0), End: at(1, 10, 0)},
+		{Start: at(1, 12, 0), End: at(1, 12, 30)},
+	}, periods)
+
+	_, err = ParseFreeBusy("20240701T090000Z")
+	assert.Error(t, err)
+}
+
+func TestFindSlots(t *testing.T) {
+	opts := &SlotOptions{
+		Duration:  time.Hour,
+		From:      at(1, 0, 0),
+		To:        at(3, 0, 0),
+		WorkStart: 9 * time.Hour,
+		WorkEnd:   12 * time.Hour,
+		Location:  time.UTC,
+		Count:     3,
+	}
+	busy := []Period{
+		{Start: at(1, 8, 0), End: at(1, 9, 30)},
+		{Start: at(1, 10, 30), End: at(1, 11, 30)},
+	}
+	slots := FindSlots(busy, opts)
+	assert.Equal(t, []Period{
+		{Start: at(1, 9, 30), End: at(1, 10, 30)},
+		{Start: at(2, 9, 0), End: at(2, 10, 0)},
+		{Start: at(2, 10, 0), End: at(2, 11, 0)},
+	}, slots)
+
+	opts.Duration = 30 * time.Minute
+	opts.Count = 2
+	slots = FindSlots(busy, opts)
+	assert.Equal(t, []Period{
+		{Start: at(1, 9, 30), End: at(1, 10, 0)},
+		{Start: at(1, 10, 0), End: at(1, 10, 30)},
+	}, slots)
+}
+
+func TestFindSlotsTimezone(t *testing.T) {
+	loc := time.FixedZone("UTC+7", 7*60*60)
+	slots := FindSlots(nil, &SlotOptions{
+		Duration:  time.Hour,
+		From:      time.Date(2024, time.July, 1, 0, 0, 0, 0, loc),
+		To:        time.Date(2024, time.July, 2, 0, 0, 0, 0, loc),
+		WorkStart: 9 * time.Hour,
+		WorkEnd:   18 * time.Hour,
+		Location:  loc,
+		Count:     1,
+	})
+	assert.Equal(t, 1, len(slots))
+	assert.True(t, at(1, 2, 0).Equal(slots[0].Start))
+}
+
+func TestMeetingEventUTC(t *testing.T) {
+	// slot in zone of slot finder is stored as UTC, not with TZID server doesn't know
+	loc := time.FixedZone("UTC+7", 7*60*60)
+	meeting := &MeetingRequest{Summary: "meeting", Organizer: "maso-meil@mail.com", Attendees: []string{"some-mail@mail.com"}}
+	event := MeetingEvent(meeting, Period{Start: at(1, 2, 0).In(loc), End: at(1, 3, 0).In(loc)})
+	assert.Equal(t, time.UTC, event.DateTimeStart.Location())
+	assert.Equal(t, time.UTC, event.DateTimeEnd.Location())
+	assert.True(t, at(1, 2, 0).Equal(event.DateTimeStart))
+}
+
+func TestEventPeriods(t *testing.T) {
+	event := GetRecurrentEvent(&ReccurentEvent{
+		Event: &Event{
+			Name:          ical.CompEvent,
+			Uid:           "recurrent",
+			DateTimeStart: at(1, 9, 0),
+		},
+		Frequency: 3,
+		Interval:  1,
+		Count:     5,
+	})
+	event.Props.SetDateTime(ical.PropDateTimeEnd, at(1, 10, 0))
+
+	periods, err := EventPeriods(event.Component, at(2, 0, 0), at(4, 0, 0), time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(periods))
+	assert.True(t, at(2, 9, 0).Equal(periods[0].Start))
+	assert.True(t, at(3, 10, 0).Equal(periods[1].End))
+
+	assert.True(t, IsBusy(event.Component))
+	event.Props.SetText(ical.PropTransparency, "TRANSPARENT")
+	assert.False(t, IsBusy(event.Component))
+}
@@ -0,0 +1,359 @@
+package mycal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// ImportMode says what to do with objects whose UID already exists in calendar
+type ImportMode int
+
+const (
+	ImportSkip ImportMode = iota
+	ImportOverwrite
+	ImportNewUID
+)
+
+func ParseImportMode(s string) (ImportMode, error) {
+	switch s {
+	case "skip":
+		return ImportSkip, nil
+	case "overwrite":
+		return ImportOverwrite, nil
+	case "newuid":
+		return ImportNewUID, nil
+	}
+	return ImportSkip, fmt.Errorf("unknown import mode %s", s)
+}
+
+type ImportReport struct {
+	Created     []string
+	Skipped     []string
+	Overwritten []string
+	// Renamed are duplicates uploaded under new UID, "old -> new"
+	Renamed []string
+	Failed  []string
+}
+
+// ReadCalendars decodes every VCALENDAR of stream, .ics files sometimes have many.
+// jCal is recognized by leading [ and xCal by leading <.
+func ReadCalendars(r io.Reader) ([]*ical.Calendar, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !unicode.IsSpace(rune(b[0])) {
+			break
+		}
+		br.ReadByte()
+	}
+	switch b, _ := br.Peek(1); b[0] {
+	case '[':
+		return DecodeJCal(br)
+	case '<':
+		return DecodeXCal(br)
+	}
+
+	dec := ical.NewDecoder(br)
+	var calendars []*ical.Calendar
+	for {
+		cal, err := dec.Decode()
+		if err == io.EOF {
+			return calendars, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, cal)
+	}
+}
+
+// SplitCalendars regroups components into one calendar per UID as CalDAV stores
+// them: master with its overridden instances and VTIMEZONEs they use
+func SplitCalendars(cals ...*ical.Calendar) ([]*ical.Calendar, error) {
+	timezones := make(map[string]*ical.Component)
+	groups := make(map[string][]*ical.Component)
+	var uids []string
+	for _, cal := range cals {
+		for _, comp := range cal.Children {
+			if comp.Name == ical.CompTimezone {
+				tzid, _ := comp.Props.Text(ical.PropTimezoneID)
+				timezones[tzid] = comp
+				continue
+			}
+			uid, err := comp.Props.Text(ical.PropUID)
+			if err != nil {
+				return nil, err
+			}
+			if uid == "" {
+				return nil, fmt.Errorf("%s without UID", comp.Name)
+			}
+			if _, ok := groups[uid]; !ok {
+				uids = append(uids, uid)
+			}
+			groups[uid] = append(groups[uid], comp)
+		}
+	}
+
+	objects := make([]*ical.Calendar, 0, len(uids))
+	for _, uid := range uids {
+		comps := groups[uid]
+		year := time.Now().Year()
+		if start := comps[0].Props.Get(ical.PropDateTimeStart); start != nil {
+			if t, err := start.DateTime(time.UTC); err == nil {
+				year = t.Year()
+			}
+		}
+		var used []*ical.Component
+		seen := make(map[string]bool)
+		for _, comp := range comps {
+			for _, tzid := range timezoneIDs(comp) {
+				if seen[tzid] {
+					continue
+				}
+				seen[tzid] = true
+				tz, ok := timezones[tzid]
+				if !ok {
+					var err error
+					tz, err = LocationTimezone(tzid, year)
+					if err != nil {
+						return nil, fmt.Errorf("%s: %v", uid, err)
+					}
+				}
+				used = append(used, tz)
+			}
+		}
+		objects = append(objects, newCalendar(append(used, comps...)...))
+	}
+	return objects, nil
+}
+
+// timezoneIDs returns TZID parameters used by component and its children
+func timezoneIDs(comp *ical.Component) []string {
+	var tzids []string
+	for _, props := range comp.Props {
+		for _, prop := range props {
+			if tzid := prop.Params.Get(ical.ParamTimezoneID); tzid != "" {
+				tzids = append(tzids, tzid)
+			}
+		}
+	}
+	for _, child := range comp.Children {
+		tzids = append(tzids, timezoneIDs(child)...)
+	}
+	return tzids
+}
+
+// LocationTimezone builds VTIMEZONE from Go time zone database with rules of given year
+func LocationTimezone(tzid string, year int) (*ical.Component, error) {
+	loc, err := time.LoadLocation(tzid)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %s", tzid)
+	}
+	tz := ical.NewComponent(ical.CompTimezone)
+	tz.Props.SetText(ical.PropTimezoneID, tzid)
+
+	// look for offset changes hour by hour through the year
+	t := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	_, offset := t.In(loc).Zone()
+	var transitions []time.Time
+	for end := t.AddDate(1, 0, 0); t.Before(end); t = t.Add(time.Hour) {
+		if _, o := t.In(loc).Zone(); o != offset {
+			transitions = append(transitions, t)
+			offset = o
+		}
+	}
+	if len(transitions) == 0 {
+		name, offset := t.In(loc).Zone()
+		tz.Children = append(tz.Children, observance(ical.CompTimezoneStandard, name, offset, offset, time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC), ""))
+		return tz, nil
+	}
+	for _, tr := range transitions {
+		_, before := tr.Add(-time.Hour).In(loc).Zone()
+		name, after := tr.In(loc).Zone()
+		kind := ical.CompTimezoneStandard
+		if tr.In(loc).IsDST() {
+			kind = ical.CompTimezoneDaylight
+		}
+		// DTSTART of observance is local time before the change
+		local := tr.In(time.FixedZone("", before))
+		tz.Children = append(tz.Children, observance(kind, name, before, after, local, yearlyRule(local)))
+	}
+	return tz, nil
+}
+
+func observance(kind, name string, from, to int, start time.Time, rule string) *ical.Component {
+	comp := ical.NewComponent(kind)
+	comp.Props.SetText(ical.PropTimezoneName, name)
+	comp.Props.Set(rawProp(ical.PropTimezoneOffsetFrom, utcOffset(from)))
+	comp.Props.Set(rawProp(ical.PropTimezoneOffsetTo, utcOffset(to)))
+	comp.Props.Set(rawProp(ical.PropDateTimeStart, start.Format("20060102T150405")))
+	if rule != "" {
+		comp.Props.Set(rawProp(ical.PropRecurrenceRule, rule))
+	}
+	return comp
+}
+
+// rawProp makes property with value already in iCalendar format
+func rawProp(name, value string) *ical.Prop {
+	prop := ical.NewProp(name)
+	prop.Value = value
+	return prop
+}
+
+func utcOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// yearlyRule describes day of transition like "last Sunday of March"
+func yearlyRule(t time.Time) string {
+	n := (t.Day()-1)/7 + 1
+	if t.AddDate(0, 0, 7).Month() != t.Month() {
+		n = -1
+	}
+	days := []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+	return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", int(t.Month()), n, days[t.Weekday()])
+}
+
+// existingUIDs maps UIDs of objects in calendar to their paths and ETags
+func existingUIDs(ctx context.Context, client *caldav.Client, homeset, calendarName string) (map[string]caldav.CalendarObject, error) {
+	resp, err := client.QueryCalendar(ctx, homeset+calendarName, &caldav.CalendarQuery{
+		CompRequest: caldav.CalendarCompRequest{
+			Name: "VCALENDAR",
+			Comps: []caldav.CalendarCompRequest{
+				{Name: "VEVENT", Props: []string{ical.PropUID}},
+				{Name: "VTODO", Props: []string{ical.PropUID}},
+				{Name: "VJOURNAL", Props: []string{ical.PropUID}},
+			},
+		},
+		CompFilter: caldav.CompFilter{Name: "VCALENDAR"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting calendar query: %v", err)
+	}
+	uids := make(map[string]caldav.CalendarObject)
+	for _, obj := range resp {
+		for _, comp := range obj.Data.Children {
+			if uid, _ := comp.Props.Text(ical.PropUID); uid != "" {
+				uids[uid] = caldav.CalendarObject{Path: obj.Path, ETag: obj.ETag}
+			}
+		}
+	}
+	return uids, nil
+}
+
+// ImportCalendars uploads objects made by SplitCalendars through CreateEvent
+func ImportCalendars(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset, calendarName string, objects []*ical.Calendar, mode ImportMode) (*ImportReport, error) {
+	existing, err := existingUIDs(ctx, client, homeset, calendarName)
+	if err != nil {
+		return nil, err
+	}
+	report := &ImportReport{}
+	for _, obj := range objects {
+		var main *ical.Component
+		var related []*ical.Component
+		for _, comp := range obj.Children {
+			if main == nil && comp.Name != ical.CompTimezone && comp.Props.Get(ical.PropRecurrenceID) == nil {
+				main = comp
+				continue
+			}
+			related = append(related, comp)
+		}
+		if main == nil {
+			// only overridden instances, first of them stands for the object
+			for i, comp := range related {
+				if comp.Name != ical.CompTimezone {
+					main = comp
+					related = append(related[:i:i], related[i+1:]...)
+					break
+				}
+			}
+		}
+		uid, _ := main.Props.Text(ical.PropUID)
+
+		old, duplicate := existing[uid]
+		path := homeset + calendarName + "/" + uid + ".ics"
+		switch {
+		case duplicate && mode == ImportSkip:
+			report.Skipped = append(report.Skipped, uid)
+			continue
+		case duplicate && mode == ImportOverwrite && old.Path != path:
+			// object was stored under other name, new one would duplicate UID,
+			// so data is put in place of old one unless it changed meanwhile
+			etag, err := replaceObject(ctx, httpClient, url, old, newCalendar(append([]*ical.Component{main}, related...)...))
+			if err != nil {
+				report.Failed = append(report.Failed, fmt.Sprintf("%s: %v", uid, err))
+				continue
+			}
+			existing[uid] = caldav.CalendarObject{Path: old.Path, ETag: etag}
+			report.Overwritten = append(report.Overwritten, uid)
+			continue
+		case duplicate && mode == ImportNewUID:
+			newUID := uuid.New().String()
+			for _, comp := range append(related, main) {
+				if comp.Name != ical.CompTimezone {
+					comp.Props.SetText(ical.PropUID, newUID)
+				}
+			}
+			report.Renamed = append(report.Renamed, uid+" -> "+newUID)
+			uid = newUID
+		}
+
+		err := CreateEvent(ctx, client, homeset, calendarName, &ical.Event{Component: main}, related...)
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %v", uid, err))
+			continue
+		}
+		existing[uid] = caldav.CalendarObject{Path: homeset + calendarName + "/" + uid + ".ics"}
+		switch {
+		case duplicate && mode == ImportOverwrite:
+			report.Overwritten = append(report.Overwritten, uid)
+		case !duplicate:
+			report.Created = append(report.Created, uid)
+		}
+	}
+	return report, nil
+}
+
+// replaceObject puts cal in place of old object if it still has ETag it was listed with,
+// objects listed without ETag get it from server first
+func replaceObject(ctx context.Context, httpClient webdav.HTTPClient, url string, old caldav.CalendarObject, cal *ical.Calendar) (string, error) {
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return "", err
+	}
+	etag := unquoteETag(old.ETag)
+	if etag == "" {
+		current, err := OpenObject(ctx, httpClient, url, old.Path)
+		if err != nil {
+			return "", err
+		}
+		etag = current.ETag
+	}
+	etag, err := writeObject(ctx, httpClient, http.MethodPut, collectionURL(url, old.Path, ""), etag, buf.Bytes())
+	if isPrecondition(err) {
+		err = ErrChanged
+	}
+	return etag, err
+}
@@ -0,0 +1,119 @@
+package mycal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+const importData = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" +
+	"BEGIN:VTIMEZONE\r\nTZID:Custom/Zone\r\nBEGIN:STANDARD\r\nTZOFFSETFROM:+0300\r\nTZOFFSETTO:+0300\r\nDTSTART:19700101T000000\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\nUID:weekly\r\nDTSTAMP:20240701T090000Z\r\nDTSTART;TZID=Custom/Zone:20240701T090000\r\nRRULE:FREQ=WEEKLY;COUNT=3\r\nSUMMARY:Weekly\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:single\r\nDTSTAMP:20240701T090000Z\r\nDTSTART;TZID=Europe/Berlin:20240702T090000\r\nSUMMARY:Single\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nUID:weekly\r\nDTSTAMP:20240701T090000Z\r\nRECURRENCE-ID;TZID=Custom/Zone:20240708T090000\r\nDTSTART;TZID=Custom/Zone:20240708T100000\r\nSUMMARY:Weekly moved\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestSplitCalendars(t *testing.T) {
+	cals, err := ReadCalendars(strings.NewReader(importData + strings.Replace(importData, "UID:single", "UID:other", 1)))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(cals))
+
+	objects, err := SplitCalendars(cals[0])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(objects))
+
+	var names []string
+	for _, comp := range objects[0].Children {
+		names = append(names, comp.Name)
+	}
+	assert.Equal(t, []string{ical.CompTimezone, ical.CompEvent, ical.CompEvent}, names)
+	tzid, _ := objects[0].Children[0].Props.Text(ical.PropTimezoneID)
+	assert.Equal(t, "Custom/Zone", tzid)
+
+	// Europe/Berlin isn't defined in file, it comes from time zone database
+	tz := objects[1].Children[0]
+	tzid, _ = tz.Props.Text(ical.PropTimezoneID)
+	assert.Equal(t, "Europe/Berlin", tzid)
+	assert.Equal(t, 2, len(tz.Children))
+
+	_, err = SplitCalendars(&ical.Calendar{Component: &ical.Component{
+		Name:     ical.CompCalendar,
+		Props:    make(ical.Props),
+		Children: []*ical.Component{{Name: ical.CompEvent, Props: make(ical.Props)}},
+	}})
+	assert.Error(t, err)
+}
+
+func TestLocationTimezone(t *testing.T) {
+	tz, err := LocationTimezone("Europe/Berlin", 2024)
+	assert.NoError(t, err)
+	daylight, standard := tz.Children[0], tz.Children[1]
+	assert.Equal(t, ical.CompTimezoneDaylight, daylight.Name)
+	assert.Equal(t, "+0100", daylight.Props.Get(ical.PropTimezoneOffsetFrom).Value)
+	assert.Equal(t, "+0200", daylight.Props.Get(ical.PropTimezoneOffsetTo).Value)
+	assert.Equal(t, "20240331T020000", daylight.Props.Get(ical.PropDateTimeStart).Value)
+	assert.Equal(t, "FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU", daylight.Props.Get(ical.PropRecurrenceRule).Value)
+	assert.Equal(t, ical.CompTimezoneStandard, standard.Name)
+	assert.Equal(t, "20241027T030000", standard.Props.Get(ical.PropDateTimeStart).Value)
+
+	tz, err = LocationTimezone("Asia/Krasnoyarsk", 2024)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(tz.Children))
+	assert.Equal(t, "+0700", tz.Children[0].Props.Get(ical.PropTimezoneOffsetTo).Value)
+
+	_, err = LocationTimezone("Nowhere/Town", 2024)
+	assert.Error(t, err)
+}
+
+func TestImportCalendars(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		mode     ImportMode
+		expected ImportReport
+		objects  int
+	}{
+		{mode: ImportSkip, expected: ImportReport{Created: []string{"single"}, Skipped: []string{"weekly"}}, objects: 2},
+		{mode: ImportOverwrite, expected: ImportReport{Created: []string{"single"}, Overwritten: []string{"weekly"}}, objects: 2},
+		{mode: ImportNewUID, objects: 3},
+	} {
+		dav := newFakeDAV("default")
+		dav.put(syncHomeset+"default/weekly-old.ics", calendarData("weekly"))
+		end := fakeEndpoint(t, dav)
+
+		cals, err := ReadCalendars(strings.NewReader(importData))
+		assert.NoError(t, err)
+		objects, err := SplitCalendars(cals...)
+		assert.NoError(t, err)
+		report, err := ImportCalendars(ctx, end.HTTPClient, end.Client, end.URL, syncHomeset, "default", objects, tc.mode)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.objects, len(dav.objects))
+		if tc.mode == ImportNewUID {
+			assert.Equal(t, 1, len(report.Renamed))
+			assert.True(t, strings.HasPrefix(report.Renamed[0], "weekly -> "))
+			continue
+		}
+		assert.Equal(t, tc.expected, *report)
+	}
+
+	// object stored under other name is overwritten in place, so UID stays unique
+	dav := newFakeDAV("default")
+	dav.put(syncHomeset+"default/weekly-old.ics", calendarData("weekly"))
+	end := fakeEndpoint(t, dav)
+	cals, _ := ReadCalendars(strings.NewReader(importData))
+	objects, _ := SplitCalendars(cals...)
+	_, err := ImportCalendars(ctx, end.HTTPClient, end.Client, end.URL, syncHomeset, "default", objects, ImportOverwrite)
+	assert.NoError(t, err)
+	assert.NotContains(t, dav.objects, syncHomeset+"default/weekly.ics")
+	assert.NotEqual(t, calendarData("weekly"), dav.objects[syncHomeset+"default/weekly-old.ics"])
+
+	// object changed since it was listed is kept
+	stale := caldav.CalendarObject{Path: syncHomeset + "default/weekly-old.ics", ETag: `"` + dav.etags[syncHomeset+"default/weekly-old.ics"] + `"`}
+	dav.put(stale.Path, calendarData("weekly"))
+	_, err = replaceObject(ctx, end.HTTPClient, end.URL, stale, objects[0])
+	assert.ErrorIs(t, err, ErrChanged)
+	assert.Equal(t, calendarData("weekly"), dav.objects[stale.Path])
+}
@@ -0,0 +1,353 @@
+package mycal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// SMTPConfig describes server used for iMIP (RFC 6047) delivery to attendees
+// that are not on our CalDAV server
+type SMTPConfig struct {
+	Host            string
+	Port            string
+	Username        string
+	Password        string
+	From            string
+	InternalDomains []string
+}
+
+// SMTPConfigFromEnv reads CALDAV_SMTP_* variables, nil means iMIP is disabled
+func SMTPConfigFromEnv() *SMTPConfig {
+	host := os.Getenv("CALDAV_SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+	port := os.Getenv("CALDAV_SMTP_PORT")
+	if port == "" {
+		port = "25"
+	}
+	var domains []string
+	for _, domain := range strings.Split(os.Getenv("CALDAV_INTERNAL_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, strings.ToLower(domain))
+		}
+	}
+	return &SMTPConfig{
+		Host:            host,
+		Port:            port,
+		Username:        os.Getenv("CALDAV_SMTP_USER"),
+		Password:        os.Getenv("CALDAV_SMTP_PASSWORD"),
+		From:            os.Getenv("CALDAV_SMTP_FROM"),
+		InternalDomains: domains,
+	}
+}
+
+// IsExternal reports whether email is outside of internal domains
+func (cfg *SMTPConfig) IsExternal(email string) bool {
+	email = strings.TrimPrefix(strings.ToLower(email), "mailto:")
+	for _, domain := range cfg.InternalDomains {
+		if strings.HasSuffix(email, "@"+domain) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExternalRecipients filters recipients of iTIP message that need email
+func (cfg *SMTPConfig) ExternalRecipients(msg *ical.Calendar, originator string) []string {
+	var recipients []string
+	for _, recipient := range Recipients(msg, originator) {
+		if cfg.IsExternal(recipient) {
+			recipients = append(recipients, strings.TrimPrefix(recipient, "mailto:"))
+		}
+	}
+	return recipients
+}
+
+// BuildIMIP makes multipart email with text description and text/calendar part of msg
+func BuildIMIP(from string, to []string, msg *ical.Calendar) ([]byte, error) {
+	method, err := msg.Props.Text(ical.PropMethod)
+	if err != nil {
+		return nil, err
+	}
+	if method == "" {
+		return nil, fmt.Errorf("iMIP message must have METHOD")
+	}
+	var cal bytes.Buffer
+	if err := ical.NewEncoder(&cal).Encode(msg); err != nil {
+		return nil, err
+	}
+	var summary string
+	for _, comp := range msg.Children {
+		if s, _ := comp.Props.Text(ical.PropSummary); s != "" {
+			summary = s
+			break
+		}
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", imipSubject(method, summary)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@caldav-client>\r\n", uuid.New().String())
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", w.Boundary())
+
+	text, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(text)
+	if _, err := io.WriteString(qp, imipSubject(method, summary)+"\r\n"); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {fmt.Sprintf("text/calendar; charset=utf-8; method=%s", method)},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.NewEncoder(base64.StdEncoding, &lineWriter{w: part})
+	if _, err := enc.Write(cal.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func imipSubject(method, summary string) string {
+	switch method {
+	case MethodRequest:
+		return "Invitation: " + summary
+	case MethodCancel:
+		return "Cancelled: " + summary
+	case MethodReply:
+		return "Reply: " + summary
+	case MethodCounter:
+		return "New time proposed: " + summary
+	}
+	return summary
+}
+
+// lineWriter breaks base64 output into 76 character lines
+type lineWriter struct {
+	w   io.Writer
+	col int
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	for i, b := range p {
+		if lw.col == 76 {
+			if _, err := lw.w.Write([]byte("\r\n")); err != nil {
+				return i, err
+			}
+			lw.col = 0
+		}
+		if _, err := lw.w.Write([]byte{b}); err != nil {
+			return i, err
+		}
+		lw.col++
+	}
+	return len(p), nil
+}
+
+// SendIMIP emails msg to recipients through configured SMTP server
+func SendIMIP(cfg *SMTPConfig, msg *ical.Calendar, recipients []string) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	data, err := BuildIMIP(cfg.From, recipients, msg)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return smtp.SendMail(cfg.Host+":"+cfg.Port, auth, cfg.From, recipients, data)
+}
+
+// ReadIMIP extracts iTIP messages from .eml file or mbox with many emails
+func ReadIMIP(r io.Reader) ([]*ical.Calendar, error) {
+	var calendars []*ical.Calendar
+	messages, err := splitMbox(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range messages {
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		cals, err := calendarParts(textproto.MIMEHeader(msg.Header), msg.Body)
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, cals...)
+	}
+	return calendars, nil
+}
+
+// splitMbox splits mbox on "From " lines, single .eml is returned as is
+func splitMbox(r io.Reader) ([][]byte, error) {
+	var messages [][]byte
+	var current bytes.Buffer
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "From ") {
+			if current.Len() > 0 {
+				messages = append(messages, append([]byte(nil), current.Bytes()...))
+				current.Reset()
+			}
+			continue
+		}
+		// mboxrd escapes From lines in bodies with >
+		if strings.HasPrefix(line, ">From ") {
+			line = line[1:]
+		}
+		current.WriteString(line + "\r\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current.Len() > 0 {
+		messages = append(messages, current.Bytes())
+	}
+	return messages, nil
+}
+
+func calendarParts(header textproto.MIMEHeader, body io.Reader) ([]*ical.Calendar, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		var calendars []*ical.Calendar
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return calendars, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			cals, err := calendarParts(part.Header, part)
+			if err != nil {
+				return nil, err
+			}
+			calendars = append(calendars, cals...)
+		}
+	case mediaType == ical.MIMEType || mediaType == "application/ics":
+		switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+		case "base64":
+			body = base64.NewDecoder(base64.StdEncoding, body)
+		case "quoted-printable":
+			body = quotedprintable.NewReader(body)
+		}
+		cal, err := ical.NewDecoder(body).Decode()
+		if err != nil {
+			return nil, err
+		}
+		if method, ok := params["method"]; ok && cal.Props.Get(ical.PropMethod) == nil {
+			cal.Props.SetText(ical.PropMethod, strings.ToUpper(method))
+		}
+		return []*ical.Calendar{cal}, nil
+	}
+	return nil, nil
+}
+
+// IngestIMIP applies iTIP messages received by email to stored copies of events.
+// Outdated messages are skipped, messages that can't be applied don't stop the rest
+// and their errors are returned together with UIDs of applied ones.
+func IngestIMIP(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset, calendarName string, messages []*ical.Calendar) ([]string, error) {
+	var applied []string
+	var errs []error
+	for _, msg := range messages {
+		var uid string
+		for _, comp := range msg.Children {
+			if comp.Name != ical.CompTimezone {
+				uid, _ = comp.Props.Text(ical.PropUID)
+				break
+			}
+		}
+		var stored *ical.Calendar
+		obj, err := FindByUid(ctx, client, homeset, uid)
+		switch {
+		case err == nil:
+			stored = obj.Data
+		case errors.Is(err, ErrNotFound):
+			obj = &caldav.CalendarObject{Path: homeset + calendarName + "/" + uid + ".ics"}
+		default:
+			errs = append(errs, fmt.Errorf("%s: %w", uid, err))
+			continue
+		}
+		updated, err := ApplyITIPCalendar(stored, msg)
+		if errors.Is(err, ErrOutdated) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", uid, err))
+			continue
+		}
+		setLastModified(updated, time.Now())
+		obj.Data = updated
+		if stored != nil {
+			// copy changed on server meanwhile is not overwritten
+			err = UpdateObject(ctx, httpClient, url, obj)
+		} else {
+			// object created on server meanwhile is not overwritten either
+			var buf bytes.Buffer
+			if err = ical.NewEncoder(&buf).Encode(updated); err == nil {
+				_, err = writeObject(ctx, httpClient, http.MethodPut, collectionURL(url, obj.Path, ""), "", buf.Bytes())
+			}
+			if isPrecondition(err) {
+				err = ErrChanged
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", uid, err))
+			continue
+		}
+		applied = append(applied, uid)
+	}
+	return applied, errors.Join(errs...)
+}
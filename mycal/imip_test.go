@@ -0,0 +1,141 @@
+package mycal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+// smtpStandIn accepts one mail and sends its DATA to the returned channel
+func smtpStandIn(t *testing.T) (string, string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	data := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 stand-in")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 stand-in")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go on")
+				var body strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					body.WriteString(line)
+				}
+				data <- body.String()
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	assert.NoError(t, err)
+	return host, port, data
+}
+
+func TestIsExternal(t *testing.T) {
+	cfg := &SMTPConfig{InternalDomains: []string{"mail.com"}}
+	assert.False(t, cfg.IsExternal("mailto:some-mail@mail.com"))
+	assert.True(t, cfg.IsExternal("some-mail@gmail.com"))
+
+	msg := ITIPRequest(invitation(t))
+	FindAttendee(msg.Children[0], "mail-some@mail.com").Value = "mailto:mail-some@other.org"
+	assert.Equal(t, []string{"mail-some@other.org"}, cfg.ExternalRecipients(msg, "maso-meil@mail.com"))
+}
+
+func TestIMIPRoundTrip(t *testing.T) {
+	msg := ITIPRequest(invitation(t))
+	data, err := BuildIMIP("maso-meil@mail.com", []string{"some-mail@mail.com"}, msg)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "text/calendar; charset=utf-8; method=REQUEST")
+
+	mbox := "From someone Mon Jul  1 09:00:00 2024\r\n" + string(data) + "\r\nFrom someone Mon Jul  1 09:00:00 2024\r\n" + string(data)
+	calendars, err := ReadIMIP(strings.NewReader(mbox))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(calendars))
+	method, err := calendars[0].Props.Text(ical.PropMethod)
+	assert.NoError(t, err)
+	assert.Equal(t, MethodRequest, method)
+	uid, err := calendars[1].Children[0].Props.Text(ical.PropUID)
+	assert.NoError(t, err)
+	assert.Equal(t, "itip-uid", uid)
+
+	// mbox cut off by read error is not taken as complete
+	_, err = ReadIMIP(io.MultiReader(strings.NewReader(mbox), iotest.ErrReader(io.ErrUnexpectedEOF)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestSendIMIP(t *testing.T) {
+	host, port, data := smtpStandIn(t)
+	cfg := &SMTPConfig{Host: host, Port: port, From: "maso-meil@mail.com"}
+	event := invitation(t)
+	err := SendIMIP(cfg, ITIPCancel(event), []string{"some-mail@mail.com"})
+	assert.NoError(t, err)
+
+	received := <-data
+	assert.Contains(t, received, "Subject: Cancelled: meeting")
+	calendars, err := ReadIMIP(bytes.NewBufferString(received))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(calendars))
+	method, _ := calendars[0].Props.Text(ical.PropMethod)
+	assert.Equal(t, MethodCancel, method)
+}
+
+func TestIngestIMIP(t *testing.T) {
+	stored := invitation(t)
+	SetSequence(stored, 2)
+	var buf strings.Builder
+	assert.NoError(t, ical.NewEncoder(&buf).Encode(newCalendar(stored)))
+	dav := newFakeDAV("default")
+	dav.put(syncHomeset+"default/stored.ics", buf.String())
+	end := fakeEndpoint(t, dav)
+
+	other := invitation(t)
+	other.Props.SetText(ical.PropUID, "other-uid")
+	missing := invitation(t)
+	missing.Props.SetText(ical.PropUID, "missing-uid")
+	messages := []*ical.Calendar{
+		ITIPRequest(invitation(t)), // sequence 0 < 2, skipped
+		ITIPCancel(missing),
+		ITIPRequest(other),
+		ITIPCancel(stored),
+	}
+
+	// failed message doesn't stop the rest, stored copy is changed in place
+	applied, err := IngestIMIP(context.Background(), end.HTTPClient, end.Client, end.URL, syncHomeset, "default", messages)
+	assert.ErrorContains(t, err, "missing-uid")
+	assert.NotErrorIs(t, err, ErrOutdated)
+	assert.Equal(t, []string{"other-uid", "itip-uid"}, applied)
+	assert.Contains(t, dav.objects[syncHomeset+"default/other-uid.ics"], "UID:other-uid")
+	assert.Contains(t, dav.objects[syncHomeset+"default/stored.ics"], "STATUS:CANCELLED")
+	assert.NotContains(t, dav.objects, syncHomeset+"default/itip-uid.ics")
+}
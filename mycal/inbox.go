@@ -0,0 +1,261 @@
+package mycal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+type Invitation struct {
+	Path      string
+	Method    string
+	Uid       string
+	Summary   string
+	Organizer string
+	Location  string
+	Start     time.Time
+	End       time.Time
+	PartStat  string
+	Sequence  int
+	Conflicts []Period
+	Data      *ical.Calendar
+	// Outdated is set by ProcessInbox for items removed because stored event is newer
+	Outdated bool
+}
+
+// FileName returns name of inbox item without .ics as ModifyAttendance expects it
+func (inv *Invitation) FileName() string {
+	return strings.TrimSuffix(path.Base(inv.Path), ".ics")
+}
+
+// Component returns scheduled component of invitation
+func (inv *Invitation) Component() *ical.Component {
+	for _, comp := range inv.Data.Children {
+		if comp.Name != ical.CompTimezone {
+			return comp
+		}
+	}
+	return nil
+}
+
+func newInvitation(obj caldav.CalendarObject, email string) (*Invitation, error) {
+	inv := &Invitation{Path: obj.Path, Data: obj.Data}
+	comp := inv.Component()
+	if comp == nil {
+		return nil, fmt.Errorf("empty inbox item %s", obj.Path)
+	}
+	var err error
+	inv.Method, err = obj.Data.Props.Text(ical.PropMethod)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Method == "" {
+		inv.Method = MethodRequest
+	}
+	inv.Uid, err = comp.Props.Text(ical.PropUID)
+	if err != nil {
+		return nil, err
+	}
+	inv.Summary, err = comp.Props.Text(ical.PropSummary)
+	if err != nil {
+		return nil, err
+	}
+	inv.Location, err = comp.Props.Text(ical.PropLocation)
+	if err != nil {
+		return nil, err
+	}
+	if org := comp.Props.Get(ical.PropOrganizer); org != nil {
+		inv.Organizer = strings.TrimPrefix(org.Value, "mailto:")
+	}
+	event := ical.Event{Component: comp}
+	inv.Start, err = event.DateTimeStart(time.Local)
+	if err != nil {
+		return nil, err
+	}
+	inv.End, err = event.DateTimeEnd(time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if att := FindAttendee(comp, email); att != nil {
+		inv.PartStat = att.Params.Get(ical.ParamParticipationStatus)
+	}
+	inv.Sequence = Sequence(comp)
+	return inv, nil
+}
+
+// FindByUid looks for object with uid in every calendar of homeset, ErrNotFound
+// means there is none
+func FindByUid(ctx context.Context, client *caldav.Client, homeset, uid string) (*caldav.CalendarObject, error) {
+	calendars, err := client.FindCalendars(ctx, homeset)
+	if err != nil {
+		return nil, err
+	}
+	for _, calendar := range calendars {
+		resp, err := client.QueryCalendar(ctx, calendar.Path, uidQuery(ical.CompEvent, uid))
+		if err != nil {
+			return nil, fmt.Errorf("error getting calendar query: %w", err)
+		}
+		// text-match is substring match, so uid is checked exactly
+		for i := range resp {
+			if HasUID(resp[i].Data, uid) {
+				return &resp[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w with UID %s", ErrNotFound, uid)
+}
+
+// Conflicts returns busy periods of user's calendars that overlap with any occurrence of event
+func Conflicts(ctx context.Context, client *caldav.Client, homeset string, comp *ical.Component, loc *time.Location) ([]Period, error) {
+	calendars, err := client.FindCalendars(ctx, homeset)
+	if err != nil {
+		return nil, err
+	}
+	cal := ical.NewCalendar()
+	cal.Children = append(cal.Children, comp)
+	overlaps, err := EventConflicts(ctx, client, calendarsOf(calendars), cal, time.Time{}, loc)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := make([]Period, 0, len(overlaps))
+	for _, overlap := range overlaps {
+		conflicts = append(conflicts, overlap.With.Period)
+	}
+	return MergePeriods(conflicts), nil
+}
+
+// PendingInvitations lists REQUEST items of schedule inbox that user with email hasn't answered yet
+func PendingInvitations(ctx context.Context, client *caldav.Client, homeset, email string) ([]Invitation, error) {
+	resp, err := client.QueryCalendar(ctx, homeset+"inbox", timeRangeQuery(time.Time{}, time.Time{}))
+	if err != nil {
+		return nil, fmt.Errorf("error getting calendar query: %v", err)
+	}
+	var invitations []Invitation
+	for _, obj := range resp {
+		// item that isn't iTIP message doesn't hide the rest
+		inv, err := newInvitation(obj, email)
+		if err != nil {
+			continue
+		}
+		if !strings.EqualFold(inv.Method, MethodRequest) || (inv.PartStat != "" && inv.PartStat != "NEEDS-ACTION") {
+			continue
+		}
+		inv.Conflicts, err = Conflicts(ctx, client, homeset, inv.Component(), time.Local)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, nil
+}
+
+// ProcessInbox applies updates, cancellations and replies from inbox to stored copies
+// of events and removes handled items. New invitations are left for user to answer,
+// outdated items are removed without applying. Items that can't be applied are kept
+// and their errors are returned together after the rest is processed.
+func ProcessInbox(ctx context.Context, client *caldav.Client, homeset, email string) ([]Invitation, error) {
+	resp, err := client.QueryCalendar(ctx, homeset+"inbox", timeRangeQuery(time.Time{}, time.Time{}))
+	if err != nil {
+		return nil, fmt.Errorf("error getting calendar query: %v", err)
+	}
+	var applied []Invitation
+	var errs []error
+	for _, obj := range resp {
+		inv, err := newInvitation(obj, email)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", obj.Path, err))
+			continue
+		}
+		stored, err := FindByUid(ctx, client, homeset, inv.Uid)
+		if errors.Is(err, ErrNotFound) {
+			// new invitation, user has to answer it
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", obj.Path, err))
+			continue
+		}
+		if i := findInstance(stored.Data, recurrenceKey(inv.Component())); i >= 0 &&
+			inv.Method == MethodRequest && inv.Sequence == Sequence(stored.Data.Children[i]) {
+			// nothing changed, organizer is only resending
+			continue
+		}
+		updated, err := ApplyITIPCalendar(stored.Data, obj.Data)
+		if errors.Is(err, ErrOutdated) {
+			if err := Delete(ctx, client, obj.Path); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", obj.Path, err))
+				continue
+			}
+			inv.Outdated = true
+			applied = append(applied, *inv)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", obj.Path, err))
+			continue
+		}
+		setLastModified(updated, time.Now())
+		_, err = client.PutCalendarObject(ctx, stored.Path, updated)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", obj.Path, err))
+			continue
+		}
+		err = Delete(ctx, client, obj.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", obj.Path, err))
+			continue
+		}
+		applied = append(applied, *inv)
+	}
+	return applied, errors.Join(errs...)
+}
+
+// CounterInvitation proposes organizer another time for invitation
+func CounterInvitation(ctx context.Context, httpClient webdav.HTTPClient, url, homeset string, inv *Invitation, email string, start, end time.Time, comment string) error {
+	msg, err := ITIPCounter(inv.Component(), email, start, end, comment)
+	if err != nil {
+		return err
+	}
+	_, err = SendITIP(ctx, httpClient, url, homeset, email, msg)
+	return err
+}
+
+func findComponent(cal *ical.Calendar, uid string) (*ical.Component, error) {
+	for _, comp := range cal.Children {
+		compUID, err := comp.Props.Text(ical.PropUID)
+		if err != nil {
+			return nil, err
+		}
+		if compUID == uid && comp.Props.Get(ical.PropRecurrenceID) == nil {
+			return comp, nil
+		}
+	}
+	return nil, fmt.Errorf("event with UID %s not found", uid)
+}
+
+// timeRangeQuery requests whole VEVENTs, zero start and end mean no time-range filter
+func timeRangeQuery(start, end time.Time) *caldav.CalendarQuery {
+	filter := caldav.CompFilter{Name: "VEVENT"}
+	if !start.IsZero() {
+		filter.Start = start.UTC()
+		filter.End = end.UTC()
+	}
+	return &caldav.CalendarQuery{
+		CompRequest: caldav.CalendarCompRequest{
+			Name:     "VCALENDAR",
+			AllProps: true,
+			AllComps: true,
+		},
+		CompFilter: caldav.CompFilter{
+			Name:  "VCALENDAR",
+			Comps: []caldav.CompFilter{filter},
+		},
+	}
+}
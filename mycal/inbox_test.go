@@ -0,0 +1,52 @@
+package mycal
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+func TestNewInvitation(t *testing.T) {
+	event := invitation(t)
+	event.Props.SetText(ical.PropLocation, "room 1")
+	obj := caldav.CalendarObject{
+		Path: "/dav.php/calendars/testuser/inbox/abc-123.ics",
+		Data: ITIPRequest(event),
+	}
+	inv, err := newInvitation(obj, "some-mail@mail.com")
+	assert.NoError(t, err)
+	assert.Equal(t, MethodRequest, inv.Method)
+	assert.Equal(t, "itip-uid", inv.Uid)
+	assert.Equal(t, "meeting", inv.Summary)
+	assert.Equal(t, "room 1", inv.Location)
+	assert.Equal(t, "maso-meil@mail.com", inv.Organizer)
+	assert.Equal(t, "NEEDS-ACTION", inv.PartStat)
+	assert.Equal(t, "abc-123", inv.FileName())
+	assert.True(t, at(1, 9, 0).Equal(inv.Start))
+
+	inv, err = newInvitation(obj, "nobody@mail.com")
+	assert.NoError(t, err)
+	assert.Empty(t, inv.PartStat)
+}
+
+func TestPendingInvitations(t *testing.T) {
+	var buf strings.Builder
+	msg := ITIPRequest(invitation(t))
+	msg.Props.SetText(ical.PropMethod, "request")
+	assert.NoError(t, ical.NewEncoder(&buf).Encode(msg))
+	dav := newFakeDAV("default", "inbox")
+	dav.put(syncHomeset+"inbox/a.ics", strings.Replace(calendarData("broken"), "UID:broken", "UID:broken\r\nSUMMARY:bad\\", 1))
+	dav.put(syncHomeset+"inbox/b.ics", buf.String())
+	end := fakeEndpoint(t, dav)
+
+	// unparsable item is skipped, method is compared case-insensitively
+	invitations, err := PendingInvitations(context.Background(), end.Client, syncHomeset, "some-mail@mail.com")
+	assert.NoError(t, err)
+	if assert.Len(t, invitations, 1) {
+		assert.Equal(t, "itip-uid", invitations[0].Uid)
+	}
+}
@@ -0,0 +1,618 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/go-ical"
+)
+
+// iTIP methods, RFC 5546 section 1.4
+const (
+	MethodRequest        = "REQUEST"
+	MethodReply          = "REPLY"
+	MethodCancel         = "CANCEL"
+	MethodAdd            = "ADD"
+	MethodRefresh        = "REFRESH"
+	MethodCounter        = "COUNTER"
+	MethodDeclineCounter = "DECLINECOUNTER"
+)
+
+// ErrOutdated means iTIP message is older than stored event, it can't be applied
+var ErrOutdated = errors.New("outdated")
+
+type ScheduleStatus struct {
+	Recipient     string
+	RequestStatus string
+}
+
+func mailto(email string) string {
+	if strings.HasPrefix(strings.ToLower(email), "mailto:") {
+		return email
+	}
+	return "mailto:" + email
+}
+
+func sameAddress(a, b string) bool {
+	a = strings.TrimPrefix(strings.ToLower(a), "mailto:")
+	b = strings.TrimPrefix(strings.ToLower(b), "mailto:")
+	return a == b
+}
+
+// FindAttendee returns ATTENDEE of comp with given email, changes to it are kept in comp
+func FindAttendee(comp *ical.Component, email string) *ical.Prop {
+	attendees := comp.Props[ical.PropAttendee]
+	for i := range attendees {
+		if sameAddress(attendees[i].Value, email) {
+			return &attendees[i]
+		}
+	}
+	return nil
+}
+
+func Sequence(comp *ical.Component) int {
+	prop := comp.Props.Get(ical.PropSequence)
+	if prop == nil {
+		return 0
+	}
+	seq, err := prop.Int()
+	if err != nil {
+		return 0
+	}
+	return seq
+}
+
+func SetSequence(comp *ical.Component, seq int) {
+	prop := ical.NewProp(ical.PropSequence)
+	prop.Value = strconv.Itoa(seq)
+	comp.Props.Set(prop)
+}
+
+// IncrementSequence should be called by organizer on every significant change of event
+func IncrementSequence(comp *ical.Component) {
+	SetSequence(comp, Sequence(comp)+1)
+}
+
+func copyProp(prop *ical.Prop) *ical.Prop {
+	p := ical.NewProp(prop.Name)
+	p.Value = prop.Value
+	for param, values := range prop.Params {
+		p.Params[param] = append([]string(nil), values...)
+	}
+	return p
+}
+
+func copyComponent(comp *ical.Component) *ical.Component {
+	c := ical.NewComponent(comp.Name)
+	for _, props := range comp.Props {
+		for i := range props {
+			c.Props.Add(copyProp(&props[i]))
+		}
+	}
+	for _, child := range comp.Children {
+		c.Children = append(c.Children, copyComponent(child))
+	}
+	return c
+}
+
+func newITIP(method string, comps ...*ical.Component) *ical.Calendar {
+	calendar := newCalendar(comps...)
+	calendar.Props.SetText(ical.PropMethod, method)
+	return calendar
+}
+
+// ITIPRequest makes REQUEST with a copy of organizer's event
+func ITIPRequest(event *ical.Component) *ical.Calendar {
+	msg := copyComponent(event)
+	msg.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	return newITIP(MethodRequest, msg)
+}
+
+// ITIPAdd makes ADD with new instances of recurring event
+func ITIPAdd(event *ical.Component, instances ...*ical.Component) *ical.Calendar {
+	uid, _ := event.Props.Text(ical.PropUID)
+	var comps []*ical.Component
+	for _, instance := range instances {
+		msg := copyComponent(instance)
+		msg.Props.SetText(ical.PropUID, uid)
+		SetSequence(msg, Sequence(event))
+		msg.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+		comps = append(comps, msg)
+	}
+	return newITIP(MethodAdd, comps...)
+}
+
+// ITIPCancel cancels event for given attendees or for everyone if none given.
+// SEQUENCE of organizer's event is incremented.
+func ITIPCancel(event *ical.Component, attendees ...string) *ical.Calendar {
+	IncrementSequence(event)
+	msg := copyComponent(event)
+	msg.Children = nil
+	msg.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	if len(attendees) == 0 {
+		msg.Props.SetText(ical.PropStatus, string(ical.EventCancelled))
+		return newITIP(MethodCancel, msg)
+	}
+	msg.Props.Del(ical.PropAttendee)
+	for _, attendee := range attendees {
+		if att := FindAttendee(event, attendee); att != nil {
+			msg.Props.Add(copyProp(att))
+		}
+	}
+	return newITIP(MethodCancel, msg)
+}
+
+// OrganizedBy returns events of cal organized by email, overridden instances and
+// cancelled events are left out
+func OrganizedBy(cal *ical.Calendar, email string) []*ical.Component {
+	var events []*ical.Component
+	for _, comp := range cal.Children {
+		org := comp.Props.Get(ical.PropOrganizer)
+		if comp.Name != ical.CompEvent || org == nil || !sameAddress(org.Value, email) ||
+			comp.Props.Get(ical.PropRecurrenceID) != nil || isCancelled(comp) {
+			continue
+		}
+		events = append(events, comp)
+	}
+	return events
+}
+
+// replyBase copies properties that identify event in REPLY, COUNTER and REFRESH
+func replyBase(event *ical.Component) *ical.Component {
+	msg := ical.NewComponent(event.Name)
+	for _, name := range []string{
+		ical.PropUID,
+		ical.PropOrganizer,
+		ical.PropSummary,
+		ical.PropDateTimeStart,
+		ical.PropDateTimeEnd,
+		ical.PropDuration,
+		ical.PropRecurrenceID,
+		ical.PropRecurrenceRule,
+		ical.PropSequence,
+	} {
+		if prop := event.Props.Get(name); prop != nil {
+			msg.Props.Set(copyProp(prop))
+		}
+	}
+	msg.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	return msg
+}
+
+// ITIPReply makes REPLY of attendee with partstat, attendee's PARTSTAT in event is updated too
+func ITIPReply(event *ical.Component, attendee, partstat string) (*ical.Calendar, error) {
+	att := FindAttendee(event, attendee)
+	if att == nil {
+		return nil, fmt.Errorf("attendee %s not found", attendee)
+	}
+	att.Params.Set(ical.ParamParticipationStatus, partstat)
+	att.Params.Del(ical.ParamRSVP)
+	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+
+	msg := replyBase(event)
+	msg.Props.Add(copyProp(att))
+	return newITIP(MethodReply, msg), nil
+}
+
+// ITIPRefresh asks organizer to send latest version of event
+func ITIPRefresh(event *ical.Component, attendee string) *ical.Calendar {
+	msg := replyBase(event)
+	msg.Props.Del(ical.PropSummary)
+	msg.Props.Del(ical.PropDateTimeStart)
+	msg.Props.Del(ical.PropDateTimeEnd)
+	msg.Props.Del(ical.PropDuration)
+	msg.Props.Del(ical.PropRecurrenceRule)
+	prop := ical.NewProp(ical.PropAttendee)
+	prop.Value = mailto(attendee)
+	msg.Props.Add(prop)
+	return newITIP(MethodRefresh, msg)
+}
+
+// ITIPCounter proposes new time of event to organizer
+func ITIPCounter(event *ical.Component, attendee string, start, end time.Time, comment string) (*ical.Calendar, error) {
+	att := FindAttendee(event, attendee)
+	if att == nil {
+		return nil, fmt.Errorf("attendee %s not found", attendee)
+	}
+	msg := replyBase(event)
+	msg.Props.SetDateTime(ical.PropDateTimeStart, start)
+	msg.Props.Del(ical.PropDuration)
+	msg.Props.SetDateTime(ical.PropDateTimeEnd, end)
+	msg.Props.Add(copyProp(att))
+	if comment != "" {
+		msg.Props.SetText(ical.PropComment, comment)
+	}
+	return newITIP(MethodCounter, msg), nil
+}
+
+// ITIPDeclineCounter rejects COUNTER sent by attendee
+func ITIPDeclineCounter(event *ical.Component, attendee, comment string) (*ical.Calendar, error) {
+	att := FindAttendee(event, attendee)
+	if att == nil {
+		return nil, fmt.Errorf("attendee %s not found", attendee)
+	}
+	msg := replyBase(event)
+	msg.Props.Add(copyProp(att))
+	if comment != "" {
+		msg.Props.SetText(ical.PropComment, comment)
+	}
+	return newITIP(MethodDeclineCounter, msg), nil
+}
+
+// ApplyITIP applies message to stored copy of event and returns updated copy.
+// stored is nil if there is no copy yet. REFRESH, COUNTER and DECLINECOUNTER
+// need a decision from user, so stored is returned as is.
+func ApplyITIP(stored *ical.Component, msg *ical.Calendar) (*ical.Component, error) {
+	method, err := msg.Props.Text(ical.PropMethod)
+	if err != nil {
+		return nil, err
+	}
+	method = strings.ToUpper(method)
+	var incoming *ical.Component
+	for _, comp := range msg.Children {
+		if comp.Name != ical.CompTimezone {
+			incoming = comp
+			break
+		}
+	}
+	if incoming == nil {
+		return nil, fmt.Errorf("no components in %s message", method)
+	}
+	if stored == nil {
+		if method != MethodRequest {
+			return nil, fmt.Errorf("no stored event to apply %s to", method)
+		}
+		return copyComponent(incoming), nil
+	}
+
+	storedUID, _ := stored.Props.Text(ical.PropUID)
+	incomingUID, _ := incoming.Props.Text(ical.PropUID)
+	if storedUID != incomingUID {
+		return nil, fmt.Errorf("UID mismatch: %s and %s", storedUID, incomingUID)
+	}
+
+	switch method {
+	case MethodRequest:
+		if Sequence(incoming) < Sequence(stored) {
+			return nil, fmt.Errorf("%w request: sequence %d < %d", ErrOutdated, Sequence(incoming), Sequence(stored))
+		}
+		return copyComponent(incoming), nil
+	case MethodAdd:
+		if Sequence(incoming) < Sequence(stored) {
+			return nil, fmt.Errorf("%w add: sequence %d < %d", ErrOutdated, Sequence(incoming), Sequence(stored))
+		}
+		updated := copyComponent(stored)
+		for _, comp := range msg.Children {
+			if start := comp.Props.Get(ical.PropDateTimeStart); start != nil {
+				rdate := copyProp(start)
+				rdate.Name = ical.PropRecurrenceDates
+				updated.Props.Add(rdate)
+			}
+		}
+		return updated, nil
+	case MethodCancel:
+		if Sequence(incoming) < Sequence(stored) {
+			return nil, fmt.Errorf("%w cancel: sequence %d < %d", ErrOutdated, Sequence(incoming), Sequence(stored))
+		}
+		updated := copyComponent(stored)
+		if recurrenceID := incoming.Props.Get(ical.PropRecurrenceID); recurrenceID != nil {
+			exdate := copyProp(recurrenceID)
+			exdate.Name = ical.PropExceptionDates
+			updated.Props.Add(exdate)
+		} else {
+			updated.Props.SetText(ical.PropStatus, string(ical.EventCancelled))
+		}
+		SetSequence(updated, Sequence(incoming))
+		return updated, nil
+	case MethodReply:
+		if Sequence(incoming) < Sequence(stored) {
+			return nil, fmt.Errorf("reply to %w sequence %d < %d", ErrOutdated, Sequence(incoming), Sequence(stored))
+		}
+		updated := copyComponent(stored)
+		for _, reply := range incoming.Props.Values(ical.PropAttendee) {
+			att := FindAttendee(updated, reply.Value)
+			if att == nil {
+				if reply.Params.Get(ical.ParamDelegatedFrom) == "" {
+					return nil, fmt.Errorf("reply from unknown attendee %s", reply.Value)
+				}
+				updated.Props.Add(copyProp(&reply))
+				continue
+			}
+			for _, param := range []string{ical.ParamParticipationStatus, ical.ParamDelegatedTo, ical.ParamDelegatedFrom} {
+				if value := reply.Params.Get(param); value != "" {
+					att.Params.Set(param, value)
+				}
+			}
+			att.Params.Del(ical.ParamRSVP)
+		}
+		return updated, nil
+	case MethodRefresh, MethodCounter, MethodDeclineCounter:
+		return stored, nil
+	}
+	return nil, fmt.Errorf("unsupported iTIP method %s", method)
+}
+
+// recurrenceKey identifies instance of event by its RECURRENCE-ID, empty for master component
+func recurrenceKey(comp *ical.Component) string {
+	prop := comp.Props.Get(ical.PropRecurrenceID)
+	if prop == nil {
+		return ""
+	}
+	if t, err := prop.DateTime(time.UTC); err == nil {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return prop.Value
+}
+
+// findInstance returns index of component of cal with recurrence key, -1 if there is none
+func findInstance(cal *ical.Calendar, key string) int {
+	for i, comp := range cal.Children {
+		if comp.Name != ical.CompTimezone && recurrenceKey(comp) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// ApplyITIPCalendar applies message to stored calendar object of event and returns
+// updated copy. Components of message are matched to stored instances by RECURRENCE-ID:
+// REQUEST and REPLY update override of instance or add it, CANCEL of instance excludes
+// it from master and removes its override, REQUEST of master drops overrides it doesn't
+// list. stored is nil if there is no copy yet.
+func ApplyITIPCalendar(stored, msg *ical.Calendar) (*ical.Calendar, error) {
+	method, err := msg.Props.Text(ical.PropMethod)
+	if err != nil {
+		return nil, err
+	}
+	method = strings.ToUpper(method)
+	updated := newCalendar()
+	if stored != nil {
+		updated = copyCalendar(stored)
+	}
+	var incoming, timezones []*ical.Component
+	for _, comp := range msg.Children {
+		if comp.Name == ical.CompTimezone {
+			timezones = append(timezones, comp)
+		} else {
+			incoming = append(incoming, comp)
+		}
+	}
+	if len(incoming) == 0 {
+		return nil, fmt.Errorf("no components in %s message", method)
+	}
+
+	switch method {
+	case MethodAdd, MethodRefresh, MethodCounter, MethodDeclineCounter:
+		// these apply to event as a whole
+		i := findInstance(updated, "")
+		if i < 0 {
+			return nil, fmt.Errorf("no stored event to apply %s to", method)
+		}
+		comp, err := ApplyITIP(updated.Children[i], msg)
+		if err != nil {
+			return nil, err
+		}
+		updated.Children[i] = comp
+		return updated, nil
+	}
+
+	storedUID := ""
+	for _, comp := range updated.Children {
+		if comp.Name != ical.CompTimezone {
+			storedUID, _ = comp.Props.Text(ical.PropUID)
+			break
+		}
+	}
+	for _, comp := range incoming {
+		if uid, _ := comp.Props.Text(ical.PropUID); storedUID != "" && uid != storedUID {
+			return nil, fmt.Errorf("UID mismatch: %s and %s", storedUID, uid)
+		}
+	}
+
+	for _, comp := range incoming {
+		key := recurrenceKey(comp)
+		part := newITIP(method, comp)
+		i := findInstance(updated, key)
+		if key != "" && (i < 0 || method == MethodCancel) && method != MethodRequest {
+			// instance without override, or cancelled one, is changed in master
+			master := findInstance(updated, "")
+			if master < 0 {
+				return nil, fmt.Errorf("no stored event to apply %s to", method)
+			}
+			applied, err := ApplyITIP(updated.Children[master], part)
+			if err != nil {
+				return nil, err
+			}
+			updated.Children[master] = applied
+			if method == MethodCancel && i >= 0 {
+				updated.Children = append(updated.Children[:i], updated.Children[i+1:]...)
+			}
+			continue
+		}
+		var instance *ical.Component
+		if i >= 0 {
+			instance = updated.Children[i]
+		}
+		applied, err := ApplyITIP(instance, part)
+		if err != nil {
+			return nil, err
+		}
+		if i >= 0 {
+			updated.Children[i] = applied
+		} else {
+			updated.Children = append(updated.Children, applied)
+		}
+	}
+
+	if method == MethodRequest && findInstance(msg, "") >= 0 {
+		listed := make(map[string]bool)
+		for _, comp := range incoming {
+			listed[recurrenceKey(comp)] = true
+		}
+		children := updated.Children[:0]
+		for _, comp := range updated.Children {
+			if comp.Name == ical.CompTimezone || listed[recurrenceKey(comp)] {
+				children = append(children, comp)
+			}
+		}
+		updated.Children = children
+	}
+	for _, tz := range timezones {
+		tzid, _ := tz.Props.Text(ical.PropTimezoneID)
+		if !hasTimezone(updated, tzid) {
+			updated.Children = append([]*ical.Component{copyComponent(tz)}, updated.Children...)
+		}
+	}
+	return updated, nil
+}
+
+func hasTimezone(cal *ical.Calendar, tzid string) bool {
+	for _, comp := range cal.Children {
+		if id, _ := comp.Props.Text(ical.PropTimezoneID); comp.Name == ical.CompTimezone && id == tzid {
+			return true
+		}
+	}
+	return false
+}
+
+func copyCalendar(cal *ical.Calendar) *ical.Calendar {
+	c := ical.NewCalendar()
+	for _, props := range cal.Props {
+		for i := range props {
+			c.Props.Add(copyProp(&props[i]))
+		}
+	}
+	for _, child := range cal.Children {
+		c.Children = append(c.Children, copyComponent(child))
+	}
+	return c
+}
+
+// Recipients returns who should receive iTIP message
+func Recipients(msg *ical.Calendar, originator string) []string {
+	method, _ := msg.Props.Text(ical.PropMethod)
+	var recipients []string
+	for _, comp := range msg.Children {
+		switch method {
+		case MethodReply, MethodCounter, MethodRefresh:
+			if org := comp.Props.Get(ical.PropOrganizer); org != nil {
+				recipients = append(recipients, org.Value)
+			}
+		default:
+			for _, att := range comp.Props.Values(ical.PropAttendee) {
+				if !sameAddress(att.Value, originator) {
+					recipients = append(recipients, att.Value)
+				}
+			}
+		}
+		if len(recipients) > 0 {
+			break
+		}
+	}
+	return recipients
+}
+
+// SendITIP delivers message through POST to schedule outbox (RFC 6638).
+// Recipients are taken from message unless given explicitly.
+// Servers that only do implicit scheduling answer with an error, then PUT of
+// the updated event delivers it instead.
+func SendITIP(ctx context.Context, httpClient webdav.HTTPClient, url, homeset, originator string, msg *ical.Calendar, recipients ...string) ([]ScheduleStatus, error) {
+	method, err := msg.Props.Text(ical.PropMethod)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(msg); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, collectionURL(url, homeset, "outbox/"), &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8; method="+method)
+	req.Header.Set("Originator", mailto(originator))
+	if len(recipients) == 0 {
+		recipients = Recipients(msg, originator)
+	}
+	for _, recipient := range recipients {
+		req.Header.Add("Recipient", mailto(recipient))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %v", resp.StatusCode)
+	}
+
+	var sr scheduleResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return nil, err
+	}
+	statuses := make([]ScheduleStatus, 0, len(sr.Responses))
+	for _, r := range sr.Responses {
+		statuses = append(statuses, ScheduleStatus{
+			Recipient:     strings.TrimSpace(r.Recipient),
+			RequestStatus: r.RequestStatus,
+		})
+	}
+	return statuses, nil
+}
+
+// ITIPDelegate delegates attendance of delegator to delegate (RFC 5546 section 4.2.5).
+// event gets delegator with PARTSTAT=DELEGATED and new attendee for delegate,
+// returned REPLY is for organizer and REQUEST is for delegate.
+func ITIPDelegate(event *ical.Component, delegator, delegate string) (*ical.Calendar, *ical.Calendar, error) {
+	att := FindAttendee(event, delegator)
+	if att == nil {
+		return nil, nil, fmt.Errorf("attendee %s not found", delegator)
+	}
+	if delegate == "" || sameAddress(delegator, delegate) {
+		return nil, nil, fmt.Errorf("invalid delegate %q", delegate)
+	}
+	att.Params.Set(ical.ParamParticipationStatus, "DELEGATED")
+	att.Params.Set(ical.ParamDelegatedTo, mailto(delegate))
+	att.Params.Del(ical.ParamRSVP)
+
+	delegated := FindAttendee(event, delegate)
+	if delegated == nil {
+		prop := ical.NewProp(ical.PropAttendee)
+		prop.Value = mailto(delegate)
+		event.Props.Add(prop)
+		delegated = FindAttendee(event, delegate)
+		// att points to old slice after Add
+		att = FindAttendee(event, delegator)
+	}
+	delegated.Params.Set(ical.ParamParticipationStatus, "NEEDS-ACTION")
+	delegated.Params.Set(ical.ParamDelegatedFrom, mailto(delegator))
+	delegated.Params.Set(ical.ParamRSVP, "TRUE")
+	if role := att.Params.Get(ical.ParamRole); role != "" {
+		delegated.Params.Set(ical.ParamRole, role)
+	}
+	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+
+	reply := replyBase(event)
+	reply.Props.Add(copyProp(att))
+	reply.Props.Add(copyProp(delegated))
+
+	return newITIP(MethodReply, reply), ITIPRequest(event), nil
+}
+
+// setLastModified stamps every component of event in cal
+func setLastModified(cal *ical.Calendar, t time.Time) {
+	for _, comp := range cal.Children {
+		if comp.Name != ical.CompTimezone {
+			comp.Props.SetDateTime(ical.PropLastModified, t)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package mycal
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+func invitation(t *testing.T) *ical.Component {
+	event, err := GetEvent(&Event{
+		Name:          ical.CompEvent,
+		Summary:       "meeting",
+		Uid:           "itip-uid",
+		DateTimeStart: at(1, 9, 0),
+		DateTimeEnd:   at(1, 10, 0),
+		Attendees:     []string{"some-mail@mail.com", "mail-some@mail.com"},
+		Organizer:     "maso-meil@mail.com",
+	})
+	assert.NoError(t, err)
+	return event.Component
+}
+
+func TestITIPReply(t *testing.T) {
+	event := invitation(t)
+	msg, err := ITIPReply(event, "MAIL-SOME@mail.com", "ACCEPTED")
+	assert.NoError(t, err)
+
+	method, err := msg.Props.Text(ical.PropMethod)
+	assert.NoError(t, err)
+	assert.Equal(t, MethodReply, method)
+	reply := msg.Children[0]
+	assert.Equal(t, 1, len(reply.Props.Values(ical.PropAttendee)))
+	assert.Equal(t, "ACCEPTED", reply.Props.Get(ical.PropAttendee).Params.Get(ical.ParamParticipationStatus))
+	assert.Equal(t, "ACCEPTED", FindAttendee(event, "mail-some@mail.com").Params.Get(ical.ParamParticipationStatus))
+	assert.Equal(t, "NEEDS-ACTION", FindAttendee(event, "some-mail@mail.com").Params.Get(ical.ParamParticipationStatus))
+
+	_, err = ITIPReply(event, "nobody@mail.com", "ACCEPTED")
+	assert.Error(t, err)
+}
+
+func TestApplyITIPReply(t *testing.T) {
+	organizerCopy := invitation(t)
+	attendeeCopy := invitation(t)
+	msg, err := ITIPReply(attendeeCopy, "some-mail@mail.com", "DECLINED")
+	assert.NoError(t, err)
+
+	updated, err := ApplyITIP(organizerCopy, msg)
+	assert.NoError(t, err)
+	assert.Equal(t, "DECLINED", FindAttendee(updated, "some-mail@mail.com").Params.Get(ical.ParamParticipationStatus))
+	assert.Equal(t, "NEEDS-ACTION", FindAttendee(organizerCopy, "some-mail@mail.com").Params.Get(ical.ParamParticipationStatus))
+	assert.Equal(t, []string{"mailto:maso-meil@mail.com"}, Recipients(msg, "some-mail@mail.com"))
+}
+
+func TestApplyITIPRequest(t *testing.T) {
+	event := invitation(t)
+	stored, err := ApplyITIP(nil, ITIPRequest(event))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, Sequence(stored))
+
+	IncrementSequence(event)
+	event.Props.SetDateTime(ical.PropDateTimeStart, at(1, 11, 0))
+	stored, err = ApplyITIP(stored, ITIPRequest(event))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, Sequence(stored))
+	start, err := stored.Props.DateTime(ical.PropDateTimeStart, time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, at(1, 11, 0).Equal(start))
+
+	SetSequence(event, 0)
+	_, err = ApplyITIP(stored, ITIPRequest(event))
+	assert.Error(t, err)
+
+	_, err = ApplyITIP(nil, newITIP("request", event))
+	assert.NoError(t, err)
+}
+
+func TestApplyITIPCancel(t *testing.T) {
+	event := invitation(t)
+	stored, err := ApplyITIP(nil, ITIPRequest(event))
+	assert.NoError(t, err)
+
+	msg := ITIPCancel(event)
+	assert.Equal(t, 1, Sequence(event))
+	assert.Equal(t, []string{"mailto:some-mail@mail.com", "mailto:mail-some@mail.com"}, Recipients(msg, "maso-meil@mail.com"))
+	stored, err = ApplyITIP(stored, msg)
+	assert.NoError(t, err)
+	status, err := stored.Props.Text(ical.PropStatus)
+	assert.NoError(t, err)
+	assert.Equal(t, "CANCELLED", status)
+}
+
+func TestApplyITIPInstances(t *testing.T) {
+	master := invitation(t)
+	master.Props.SetText(ical.PropRecurrenceRule, "FREQ=DAILY;COUNT=5")
+	override := func(day, hour int) *ical.Component {
+		comp := invitation(t)
+		comp.Props.SetDateTime(ical.PropRecurrenceID, at(day, 9, 0))
+		comp.Props.SetDateTime(ical.PropDateTimeStart, at(day, hour, 0))
+		comp.Props.SetDateTime(ical.PropDateTimeEnd, at(day, hour+1, 0))
+		return comp
+	}
+
+	// lower case method and master with override in one message
+	msg := newITIP("request", master, override(2, 11))
+	stored, err := ApplyITIPCalendar(nil, msg)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(stored.Children))
+
+	// instance is moved again, master is kept
+	stored, err = ApplyITIPCalendar(stored, newITIP(MethodRequest, override(2, 12)))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(stored.Children))
+	start, err := stored.Children[findInstance(stored, recurrenceKey(override(2, 12)))].Props.DateTime(ical.PropDateTimeStart, time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, at(2, 12, 0).Equal(start))
+	assert.NotNil(t, stored.Children[findInstance(stored, "")].Props.Get(ical.PropRecurrenceRule))
+
+	// another instance gets override
+	stored, err = ApplyITIPCalendar(stored, newITIP(MethodRequest, override(3, 15)))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(stored.Children))
+
+	// cancelled instance is excluded and its override removed
+	cancel := override(2, 12)
+	SetSequence(cancel, 1)
+	stored, err = ApplyITIPCalendar(stored, newITIP(MethodCancel, cancel))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(stored.Children))
+	assert.Equal(t, -1, findInstance(stored, recurrenceKey(cancel)))
+	assert.NotNil(t, stored.Children[findInstance(stored, "")].Props.Get(ical.PropExceptionDates))
+
+	// request of whole series drops overrides it doesn't list
+	SetSequence(master, 2)
+	stored, err = ApplyITIPCalendar(stored, newITIP(MethodRequest, master))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(stored.Children))
+
+	_, err = ApplyITIPCalendar(nil, newITIP("cancel", master))
+	assert.Error(t, err)
+	other := invitation(t)
+	other.Props.SetText(ical.PropUID, "other-uid")
+	_, err = ApplyITIPCalendar(stored, newITIP(MethodRequest, other))
+	assert.Error(t, err)
+}
+
+func TestITIPCounter(t *testing.T) {
+	event := invitation(t)
+	msg, err := ITIPCounter(event, "some-mail@mail.com", at(2, 9, 0), at(2, 10, 0), "busy on monday")
+	assert.NoError(t, err)
+	counter := msg.Children[0]
+	start, err := counter.Props.DateTime(ical.PropDateTimeStart, time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, at(2, 9, 0).Equal(start))
+
+	stored, err := ApplyITIP(event, msg)
+	assert.NoError(t, err)
+	assert.Equal(t, event, stored)
+
+	msg, err = ITIPDeclineCounter(event, "some-mail@mail.com", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mailto:some-mail@mail.com"}, Recipients(msg, "maso-meil@mail.com"))
+}
+
+func TestITIPDelegate(t *testing.T) {
+	event := invitation(t)
+	FindAttendee(event, "some-mail@mail.com").Params.Set(ical.ParamRole, "REQ-PARTICIPANT")
+	reply, request, err := ITIPDelegate(event, "some-mail@mail.com", "new-mail@mail.com")
+	assert.NoError(t, err)
+
+	delegator := FindAttendee(event, "some-mail@mail.com")
+	assert.Equal(t, "DELEGATED", delegator.Params.Get(ical.ParamParticipationStatus))
+	assert.Equal(t, "mailto:new-mail@mail.com", delegator.Params.Get(ical.ParamDelegatedTo))
+	delegate := FindAttendee(event, "new-mail@mail.com")
+	assert.NotNil(t, delegate)
+	assert.Equal(t, "mailto:some-mail@mail.com", delegate.Params.Get(ical.ParamDelegatedFrom))
+	assert.Equal(t, "REQ-PARTICIPANT", delegate.Params.Get(ical.ParamRole))
+	assert.Nil(t, event.Props.Get(ical.ParamDelegatedTo))
+
+	method, _ := request.Props.Text(ical.PropMethod)
+	assert.Equal(t, MethodRequest, method)
+	assert.Equal(t, 2, len(reply.Children[0].Props.Values(ical.PropAttendee)))
+
+	organizerCopy := invitation(t)
+	updated, err := ApplyITIP(organizerCopy, reply)
+	assert.NoError(t, err)
+	assert.Equal(t, "DELEGATED", FindAttendee(updated, "some-mail@mail.com").Params.Get(ical.ParamParticipationStatus))
+	assert.NotNil(t, FindAttendee(updated, "new-mail@mail.com"))
+
+	_, _, err = ITIPDelegate(event, "nobody@mail.com", "new-mail@mail.com")
+	assert.Error(t, err)
+	_, _, err = ITIPDelegate(event, "mail-some@mail.com", "")
+	assert.Error(t, err)
+}
+
+func TestAttendeeStatuses(t *testing.T) {
+	event := invitation(t)
+	_, err := ITIPReply(event, "some-mail@mail.com", "ACCEPTED")
+	assert.NoError(t, err)
+	FindAttendee(event, "mail-some@mail.com").Params.Set(ParamScheduleStatus, "1.2")
+
+	statuses := AttendeeStatuses(event)
+	assert.Equal(t, []AttendeeStatus{
+		{Email: "some-mail@mail.com", PartStat: "ACCEPTED"},
+		{Email: "mail-some@mail.com", PartStat: "NEEDS-ACTION", ScheduleStatus: "1.2"},
+	}, statuses)
+	assert.Equal(t, map[string][]string{
+		"accepted":    {"some-mail@mail.com"},
+		"no response": {"mail-some@mail.com"},
+	}, SummarizeAttendees(statuses))
+}
+
+func TestLookUpAttendees(t *testing.T) {
+	encode := func(cal *ical.Calendar) string {
+		var buf strings.Builder
+		assert.NoError(t, ical.NewEncoder(&buf).Encode(cal))
+		return buf.String()
+	}
+	organizerCopy := ical.NewCalendar()
+	organizerCopy.Props.SetText(ical.PropVersion, "2.0")
+	organizerCopy.Props.SetText(ical.PropProductID, "-//test//EN")
+	organizerCopy.Children = append(organizerCopy.Children, invitation(t))
+	accepted, err := ITIPReply(invitation(t), "some-mail@mail.com", "ACCEPTED")
+	assert.NoError(t, err)
+	unknown, err := ITIPReply(invitation(t), "mail-some@mail.com", "DECLINED")
+	assert.NoError(t, err)
+	unknown.Children[0].Props.Get(ical.PropAttendee).Value = "mailto:stranger@mail.com"
+
+	dav := newFakeDAV("default", "inbox")
+	dav.put(syncHomeset+"default/meeting.ics", encode(organizerCopy))
+	dav.put(syncHomeset+"inbox/accepted.ics", encode(accepted))
+	dav.put(syncHomeset+"inbox/unknown.ics", encode(unknown))
+	_, client := startFakeDAV(t, dav)
+
+	// reply that can't be applied is reported and kept, the other one is stored and removed
+	statuses, err := LookUpAttendees(context.Background(), client, syncHomeset, "default", "itip-uid")
+	assert.ErrorContains(t, err, "stranger@mail.com")
+	assert.Equal(t, "ACCEPTED", statuses[0].PartStat)
+	assert.Contains(t, dav.objects[syncHomeset+"default/meeting.ics"], "PARTSTAT=ACCEPTED")
+	assert.Equal(t, []string{syncHomeset + "inbox/unknown.ics"}, dav.paths(syncHomeset+"inbox/"))
+}
+
+func TestModifyAttendanceInstances(t *testing.T) {
+	master := invitation(t)
+	master.Props.SetText(ical.PropRecurrenceRule, "FREQ=DAILY;COUNT=3")
+	override := invitation(t)
+	override.Props.SetDateTime(ical.PropRecurrenceID, at(2, 9, 0))
+	override.Props.SetDateTime(ical.PropDateTimeStart, at(2, 11, 0))
+	override.Props.SetDateTime(ical.PropDateTimeEnd, at(2, 12, 0))
+	tz, err := LocationTimezone("Europe/Berlin", 2024)
+	assert.NoError(t, err)
+	var buf strings.Builder
+	assert.NoError(t, ical.NewEncoder(&buf).Encode(newITIP(MethodRequest, tz, master, override)))
+
+	dav := newFakeDAV("default", "inbox")
+	dav.put(syncHomeset+"inbox/item.ics", buf.String())
+	end := fakeEndpoint(t, dav)
+	ctx := context.Background()
+	mods := &Modifications{Email: "some-mail@mail.com", PartStat: "ACCEPTED", CalendarName: "default"}
+
+	// every instance gets the answer, time zone is kept and inbox item is removed
+	assert.NoError(t, ModifyAttendance(ctx, end.HTTPClient, end.Client, end.URL, syncHomeset, "inbox", "itip-uid", "item", mods))
+	stored := dav.objects[syncHomeset+"default/item.ics"]
+	assert.Equal(t, 2, strings.Count(stored, "PARTSTAT=ACCEPTED"))
+	assert.Contains(t, stored, "BEGIN:VTIMEZONE")
+	assert.Contains(t, stored, "RECURRENCE-ID")
+	assert.NotContains(t, stored, "METHOD")
+	assert.Empty(t, dav.paths(syncHomeset+"inbox/"))
+
+	mods.PartStat = "DECLINED"
+	assert.NoError(t, ModifyAttendance(ctx, end.HTTPClient, end.Client, end.URL, syncHomeset, "default", "itip-uid", "item", mods))
+	assert.Equal(t, 2, strings.Count(dav.objects[syncHomeset+"default/item.ics"], "PARTSTAT=DECLINED"))
+
+	mods.Email = "nobody@mail.com"
+	assert.Error(t, ModifyAttendance(ctx, end.HTTPClient, end.Client, end.URL, syncHomeset, "default", "itip-uid", "item", mods))
+}
+
+func TestOrganizedBy(t *testing.T) {
+	cal := newCalendar(invitation(t))
+	assert.Len(t, OrganizedBy(cal, "MASO-MEIL@mail.com"), 1)
+	assert.Empty(t, OrganizedBy(cal, "some-mail@mail.com"))
+	cal.Children[0].Props.SetText(ical.PropStatus, string(ical.EventCancelled))
+	assert.Empty(t, OrganizedBy(cal, "maso-meil@mail.com"))
+}
+
+func TestApplyITIPOutdated(t *testing.T) {
+	stored := invitation(t)
+	SetSequence(stored, 2)
+	for _, msg := range []*ical.Calendar{ITIPRequest(invitation(t)), ITIPCancel(invitation(t))} {
+		_, err := ApplyITIP(stored, msg)
+		assert.ErrorIs(t, err, ErrOutdated)
+	}
+}
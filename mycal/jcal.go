@@ -0,0 +1,490 @@
+package mycal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trvita/go-ical"
+)
+
+// jCal (RFC 7265) is iCalendar as json arrays:
+// component is [name, [properties], [components]],
+// property is [name, {parameters}, type, value...]
+
+// properties with comma separated list of values
+var multiValueProps = map[string]bool{
+	ical.PropCategories:      true,
+	ical.PropResources:       true,
+	ical.PropExceptionDates:  true,
+	ical.PropRecurrenceDates: true,
+	ical.PropFreeBusy:        true,
+}
+
+// recur parts that are numbers in jCal
+var recurIntParts = map[string]bool{
+	"COUNT": true, "INTERVAL": true, "BYSECOND": true, "BYMINUTE": true, "BYHOUR": true,
+	"BYMONTHDAY": true, "BYYEARDAY": true, "BYWEEKNO": true, "BYMONTH": true, "BYSETPOS": true,
+}
+
+// EncodeJCal converts calendar to jCal
+func EncodeJCal(cal *ical.Calendar) ([]byte, error) {
+	return json.Marshal(JCalComponent(cal.Component))
+}
+
+func JCalComponent(comp *ical.Component) []interface{} {
+	names := make([]string, 0, len(comp.Props))
+	for name := range comp.Props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	props := []interface{}{}
+	for _, name := range names {
+		for _, prop := range comp.Props[name] {
+			props = append(props, jcalProp(&prop))
+		}
+	}
+	children := []interface{}{}
+	for _, child := range comp.Children {
+		children = append(children, JCalComponent(child))
+	}
+	return []interface{}{strings.ToLower(comp.Name), props, children}
+}
+
+func valueType(prop *ical.Prop) ical.ValueType {
+	t := prop.ValueType()
+	// dates without VALUE=DATE are common enough
+	if t == ical.ValueDateTime && len(prop.Value) == 8 {
+		t = ical.ValueDate
+	}
+	return t
+}
+
+func jcalProp(prop *ical.Prop) []interface{} {
+	params := map[string]interface{}{}
+	for name, values := range prop.Params {
+		if name == ical.ParamValue {
+			continue
+		}
+		if len(values) == 1 {
+			params[strings.ToLower(name)] = values[0]
+		} else {
+			params[strings.ToLower(name)] = values
+		}
+	}
+	t, values := propValues(prop)
+	typeName := strings.ToLower(string(t))
+	if t == ical.ValueDefault {
+		typeName = "unknown"
+	}
+	return append([]interface{}{strings.ToLower(prop.Name), params, typeName}, values...)
+}
+
+// propValues returns type of property and its values in jCal form
+func propValues(prop *ical.Prop) (ical.ValueType, []interface{}) {
+	t := valueType(prop)
+	var values []string
+	switch {
+	case t == ical.ValueText && multiValueProps[prop.Name]:
+		values, _ = prop.TextList()
+	case t == ical.ValueText:
+		text, _ := prop.Text()
+		values = []string{text}
+	case multiValueProps[prop.Name]:
+		values = strings.Split(prop.Value, ",")
+	default:
+		values = []string{prop.Value}
+	}
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		result = append(result, jcalValue(prop.Name, t, value))
+	}
+	return t, result
+}
+
+func jcalValue(name string, t ical.ValueType, value string) interface{} {
+	switch t {
+	case ical.ValueDate:
+		return jcalDate(value)
+	case ical.ValueDateTime:
+		return jcalDateTime(value)
+	case ical.ValueTime:
+		return jcalTime(value)
+	case ical.ValueUTCOffset:
+		return jcalOffset(value)
+	case ical.ValueInt:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	case ical.ValueFloat:
+		if name == ical.PropGeo {
+			var geo []interface{}
+			for _, part := range strings.Split(value, ";") {
+				f, _ := strconv.ParseFloat(part, 64)
+				geo = append(geo, f)
+			}
+			return geo
+		}
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case ical.ValueBool:
+		return strings.EqualFold(value, "TRUE")
+	case ical.ValuePeriod:
+		parts := strings.SplitN(value, "/", 2)
+		if len(parts) == 2 {
+			end := parts[1]
+			if !strings.HasPrefix(end, "P") && !strings.HasPrefix(end, "-P") && !strings.HasPrefix(end, "+P") {
+				end = jcalDateTime(end)
+			}
+			return []interface{}{jcalDateTime(parts[0]), end}
+		}
+	case ical.ValueRecurrence:
+		recur := map[string]interface{}{}
+		for _, part := range strings.Split(value, ";") {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			key := strings.ToUpper(kv[0])
+			var items []interface{}
+			for _, item := range strings.Split(kv[1], ",") {
+				switch {
+				case recurIntParts[key]:
+					n, _ := strconv.Atoi(item)
+					items = append(items, n)
+				case key == "UNTIL" && len(item) == 8:
+					items = append(items, jcalDate(item))
+				case key == "UNTIL":
+					items = append(items, jcalDateTime(item))
+				default:
+					items = append(items, item)
+				}
+			}
+			if len(items) == 1 {
+				recur[strings.ToLower(key)] = items[0]
+			} else {
+				recur[strings.ToLower(key)] = items
+			}
+		}
+		return recur
+	}
+	return value
+}
+
+func jcalDate(value string) string {
+	if len(value) != 8 {
+		return value
+	}
+	return value[:4] + "-" + value[4:6] + "-" + value[6:]
+}
+
+func jcalDateTime(value string) string {
+	if len(value) < 15 || value[8] != 'T' {
+		return jcalDate(value)
+	}
+	return jcalDate(value[:8]) + "T" + jcalTime(value[9:])
+}
+
+func jcalTime(value string) string {
+	if len(value) < 6 {
+		return value
+	}
+	return value[:2] + ":" + value[2:4] + ":" + value[4:]
+}
+
+func jcalOffset(value string) string {
+	if len(value) < 5 {
+		return value
+	}
+	s := value[:3] + ":" + value[3:5]
+	if len(value) == 7 {
+		s += ":" + value[5:]
+	}
+	return s
+}
+
+// DecodeJCal reads one jCal calendar or array of them
+func DecodeJCal(r io.Reader) ([]*ical.Calendar, error) {
+	var raw []interface{}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	list := []interface{}{raw}
+	if len(raw) > 0 {
+		if _, ok := raw[0].([]interface{}); ok {
+			list = raw
+		}
+	}
+	var cals []*ical.Calendar
+	for _, item := range list {
+		comp, err := parseJCalComponent(item)
+		if err != nil {
+			return nil, err
+		}
+		if comp.Name != ical.CompCalendar {
+			return nil, fmt.Errorf("jcal: expected vcalendar, got %s", comp.Name)
+		}
+		cals = append(cals, &ical.Calendar{Component: comp})
+	}
+	return cals, nil
+}
+
+func parseJCalComponent(v interface{}) (*ical.Component, error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 3 {
+		return nil, fmt.Errorf("jcal: component must be array of 3 elements")
+	}
+	name, ok := arr[0].(string)
+	props, ok2 := arr[1].([]interface{})
+	children, ok3 := arr[2].([]interface{})
+	if !ok || !ok2 || !ok3 {
+		return nil, fmt.Errorf("jcal: malformed component")
+	}
+	comp := ical.NewComponent(strings.ToUpper(name))
+	for _, p := range props {
+		prop, err := parseJCalProp(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", comp.Name, err)
+		}
+		comp.Props.Add(prop)
+	}
+	for _, c := range children {
+		child, err := parseJCalComponent(c)
+		if err != nil {
+			return nil, err
+		}
+		comp.Children = append(comp.Children, child)
+	}
+	return comp, nil
+}
+
+func parseJCalProp(v interface{}) (*ical.Prop, error) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) < 4 {
+		return nil, fmt.Errorf("jcal: property must have name, parameters, type and value")
+	}
+	name, ok := arr[0].(string)
+	params, ok2 := arr[1].(map[string]interface{})
+	typeName, ok3 := arr[2].(string)
+	if !ok || !ok2 || !ok3 {
+		return nil, fmt.Errorf("jcal: malformed property")
+	}
+	prop := ical.NewProp(strings.ToUpper(name))
+	for key, value := range params {
+		switch value := value.(type) {
+		case []interface{}:
+			for _, item := range value {
+				prop.Params.Add(strings.ToUpper(key), fmt.Sprint(item))
+			}
+		default:
+			prop.Params.Set(strings.ToUpper(key), fmt.Sprint(value))
+		}
+	}
+	t := ical.ValueType(strings.ToUpper(typeName))
+	if typeName == "unknown" {
+		t = ical.ValueDefault
+	}
+	setPropValues(prop, t, arr[3:])
+	return prop, nil
+}
+
+// setPropValues sets value of property from values in jCal form
+func setPropValues(prop *ical.Prop, t ical.ValueType, values []interface{}) {
+	var strs []string
+	for _, value := range values {
+		strs = append(strs, icalValue(t, value))
+	}
+	if t == ical.ValueText {
+		prop.SetTextList(strs)
+	} else {
+		prop.Value = strings.Join(strs, ",")
+	}
+	prop.SetValueType(t)
+}
+
+// icalValue converts jCal value back to iCalendar text, text is left unescaped
+func icalValue(t ical.ValueType, v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		switch t {
+		case ical.ValueDate, ical.ValueDateTime, ical.ValueTime:
+			return strings.NewReplacer("-", "", ":", "").Replace(v)
+		case ical.ValueUTCOffset:
+			return strings.ReplaceAll(v, ":", "")
+		}
+		return v
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case float64:
+		if t == ical.ValueInt {
+			return strconv.Itoa(int(v))
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			if t == ical.ValuePeriod {
+				s := fmt.Sprint(item)
+				if !strings.Contains(s, "P") {
+					s = icalValue(ical.ValueDateTime, s)
+				}
+				parts = append(parts, s)
+			} else {
+				parts = append(parts, icalValue(t, item))
+			}
+		}
+		if t == ical.ValuePeriod {
+			return strings.Join(parts, "/")
+		}
+		// GEO
+		return strings.Join(parts, ";")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// FREQ goes first as some parsers expect it
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i] == "freq" || keys[j] == "freq" {
+				return keys[i] == "freq"
+			}
+			return keys[i] < keys[j]
+		})
+		var parts []string
+		for _, key := range keys {
+			var items []string
+			values, ok := v[key].([]interface{})
+			if !ok {
+				values = []interface{}{v[key]}
+			}
+			for _, item := range values {
+				s := fmt.Sprint(item)
+				if f, ok := item.(float64); ok {
+					s = strconv.Itoa(int(f))
+				}
+				if key == "until" {
+					s = icalValue(ical.ValueDateTime, s)
+				}
+				items = append(items, s)
+			}
+			parts = append(parts, strings.ToUpper(key)+"="+strings.Join(items, ","))
+		}
+		return strings.Join(parts, ";")
+	}
+	return fmt.Sprint(v)
+}
+
+// EventFromComponent flattens event or todo into Event for consumers that don't speak iCalendar
+func EventFromComponent(comp *ical.Component) (*Event, error) {
+	event := &Event{Name: comp.Name}
+	var err error
+	if event.Uid, err = comp.Props.Text(ical.PropUID); err != nil {
+		return nil, err
+	}
+	if event.Summary, err = comp.Props.Text(ical.PropSummary); err != nil {
+		return nil, err
+	}
+	if org := comp.Props.Get(ical.PropOrganizer); org != nil {
+		event.Organizer = strings.TrimPrefix(org.Value, "mailto:")
+	}
+	for _, att := range comp.Props.Values(ical.PropAttendee) {
+		event.Attendees = append(event.Attendees, strings.TrimPrefix(att.Value, "mailto:"))
+	}
+	if prop := comp.Props.Get(ical.PropDateTimeStart); prop != nil {
+		if event.DateTimeStart, err = propTime(prop); err != nil {
+			return nil, err
+		}
+	}
+	event.Location, _ = comp.Props.Text(ical.PropLocation)
+	event.Status, _ = comp.Props.Text(ical.PropStatus)
+	if prop := comp.Props.Get(ical.PropDateTimeEnd); prop != nil {
+		if event.DateTimeEnd, err = propTime(prop); err != nil {
+			return nil, err
+		}
+	} else if prop := comp.Props.Get(ical.PropDue); prop != nil {
+		if event.DateTimeEnd, err = propTime(prop); err != nil {
+			return nil, err
+		}
+	} else if prop := comp.Props.Get(ical.PropDuration); prop != nil {
+		duration, err := prop.Duration()
+		if err != nil {
+			return nil, err
+		}
+		event.DateTimeEnd = event.DateTimeStart.Add(duration)
+	}
+	for _, child := range comp.Children {
+		if child.Name == ical.CompAlarm {
+			action, _ := child.Props.Text(ical.PropAction)
+			trigger := ""
+			if prop := child.Props.Get(ical.PropTrigger); prop != nil {
+				trigger = prop.Value
+			}
+			event.Alarm = &Alarm{Action: action, Trigger: trigger}
+			break
+		}
+	}
+	return event, nil
+}
+
+// propTime reads date-time, time zones that Go doesn't know are taken as local time
+func propTime(prop *ical.Prop) (time.Time, error) {
+	t, err := prop.DateTime(time.Local)
+	if err != nil && prop.Params.Get(ical.ParamTimezoneID) != "" {
+		local := *prop
+		local.Params = ical.Params{}
+		return local.DateTime(time.Local)
+	}
+	return t, err
+}
+
+// MarshalJSON leaves out start and end that aren't set, omitempty doesn't
+// apply to time.Time
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	flat := struct {
+		event
+		DateTimeStart *time.Time `json:"start,omitempty"`
+		DateTimeEnd   *time.Time `json:"end,omitempty"`
+	}{event: event(e)}
+	if !e.DateTimeStart.IsZero() {
+		flat.DateTimeStart = &e.DateTimeStart
+	}
+	if !e.DateTimeEnd.IsZero() {
+		flat.DateTimeEnd = &e.DateTimeEnd
+	}
+	return json.Marshal(flat)
+}
+
+// EncodeJSON writes events of objects as json array of Event
+func EncodeJSON(w io.Writer, cals ...*ical.Calendar) error {
+	events := []*Event{}
+	for _, cal := range cals {
+		for _, comp := range cal.Children {
+			if comp.Name == ical.CompTimezone {
+				continue
+			}
+			event, err := EventFromComponent(comp)
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(events); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
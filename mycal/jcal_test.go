@@ -0,0 +1,148 @@
+package mycal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+const jcalData = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" +
+	"BEGIN:VTIMEZONE\r\nTZID:Custom/Zone\r\nBEGIN:STANDARD\r\nTZOFFSETFROM:-0330\r\nTZOFFSETTO:-0330\r\nDTSTART:19700101T000000\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\nUID:weekly\r\nDTSTAMP:20240701T090000Z\r\nDTSTART;TZID=Custom/Zone:20240701T090000\r\nDTEND;VALUE=DATE:20240702\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=3;BYDAY=MO,WE;UNTIL=20241231T000000Z\r\nEXDATE:20240703T090000Z,20240708T090000Z\r\n" +
+	"SUMMARY:Planning\\, weekly\r\nCATEGORIES:work,planning\r\nGEO:37.386013;-122.082932\r\nSEQUENCE:2\r\n" +
+	"ATTENDEE;PARTSTAT=ACCEPTED;DELEGATED-TO=\"mailto:a@example.com\",\"mailto:b@example.com\":mailto:c@example.com\r\n" +
+	"X-CUSTOM:anything\r\n" +
+	"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT15M\r\nEND:VALARM\r\n" +
+	"END:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func jcalEvent(t *testing.T, data []byte) []interface{} {
+	var cal []interface{}
+	assert.NoError(t, json.Unmarshal(data, &cal))
+	comps := cal[2].([]interface{})
+	return comps[1].([]interface{})
+}
+
+func jcalPropOf(comp []interface{}, name string) []interface{} {
+	for _, p := range comp[1].([]interface{}) {
+		prop := p.([]interface{})
+		if prop[0] == name {
+			return prop
+		}
+	}
+	return nil
+}
+
+func TestEncodeJCal(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(jcalData)).Decode()
+	assert.NoError(t, err)
+	data, err := EncodeJCal(cal)
+	assert.NoError(t, err)
+	event := jcalEvent(t, data)
+	assert.Equal(t, "vevent", event[0])
+
+	for _, tc := range []struct {
+		name     string
+		expected []interface{}
+	}{
+		{"dtstart", []interface{}{"dtstart", map[string]interface{}{"tzid": "Custom/Zone"}, "date-time", "2024-07-01T09:00:00"}},
+		{"dtend", []interface{}{"dtend", map[string]interface{}{}, "date", "2024-07-02"}},
+		{"summary", []interface{}{"summary", map[string]interface{}{}, "text", "Planning, weekly"}},
+		{"categories", []interface{}{"categories", map[string]interface{}{}, "text", "work", "planning"}},
+		{"exdate", []interface{}{"exdate", map[string]interface{}{}, "date-time", "2024-07-03T09:00:00Z", "2024-07-08T09:00:00Z"}},
+		{"geo", []interface{}{"geo", map[string]interface{}{}, "float", []interface{}{37.386013, -122.082932}}},
+		{"sequence", []interface{}{"sequence", map[string]interface{}{}, "integer", float64(2)}},
+		{"rrule", []interface{}{"rrule", map[string]interface{}{}, "recur", map[string]interface{}{
+			"freq": "WEEKLY", "count": float64(3), "byday": []interface{}{"MO", "WE"}, "until": "2024-12-31T00:00:00Z",
+		}}},
+		{"attendee", []interface{}{"attendee", map[string]interface{}{
+			"partstat": "ACCEPTED", "delegated-to": []interface{}{"mailto:a@example.com", "mailto:b@example.com"},
+		}, "cal-address", "mailto:c@example.com"}},
+		{"x-custom", []interface{}{"x-custom", map[string]interface{}{}, "unknown", "anything"}},
+	} {
+		assert.Equal(t, tc.expected, jcalPropOf(event, tc.name), tc.name)
+	}
+	alarm := event[2].([]interface{})[0].([]interface{})
+	assert.Equal(t, []interface{}{"trigger", map[string]interface{}{}, "duration", "-PT15M"}, jcalPropOf(alarm, "trigger"))
+}
+
+func TestDecodeJCal(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(jcalData)).Decode()
+	assert.NoError(t, err)
+	data, err := EncodeJCal(cal)
+	assert.NoError(t, err)
+
+	// array of calendars is accepted too
+	cals, err := DecodeJCal(bytes.NewReader([]byte("[" + string(data) + "," + string(data) + "]")))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(cals))
+	cals, err = DecodeJCal(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(cals))
+
+	var buf bytes.Buffer
+	assert.NoError(t, ical.NewEncoder(&buf).Encode(cals[0]))
+	decoded, err := ical.NewDecoder(&buf).Decode()
+	assert.NoError(t, err)
+	for _, comp := range [][2]*ical.Component{{cal.Children[0], decoded.Children[0]}, {cal.Children[1], decoded.Children[1]}} {
+		for name, props := range comp[0].Props {
+			for i, prop := range props {
+				got := comp[1].Props[name][i]
+				if name == ical.PropRecurrenceRule {
+					// order of rule parts isn't kept by json object
+					expected, actual := strings.Split(prop.Value, ";"), strings.Split(got.Value, ";")
+					assert.ElementsMatch(t, expected, actual)
+					continue
+				}
+				assert.Equal(t, prop.Value, got.Value, name)
+				assert.Equal(t, prop.Params, got.Params, name)
+			}
+		}
+	}
+	assert.Equal(t, "-0330", decoded.Children[0].Children[0].Props.Get(ical.PropTimezoneOffsetTo).Value)
+	assert.Equal(t, 1, len(decoded.Children[1].Children))
+
+	_, err = DecodeJCal(strings.NewReader(`["vevent", [], []]`))
+	assert.Error(t, err)
+	_, err = DecodeJCal(strings.NewReader(`["vcalendar", [["version", {}]], []]`))
+	assert.Error(t, err)
+}
+
+func TestEncodeJSON(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(jcalData)).Decode()
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeJSON(&buf, cal))
+	var events []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &events))
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, "weekly", events[0]["uid"])
+	assert.Equal(t, "Planning, weekly", events[0]["summary"])
+	assert.Equal(t, []interface{}{"c@example.com"}, events[0]["attendees"])
+	assert.Equal(t, map[string]interface{}{"action": "DISPLAY", "trigger": "-PT15M"}, events[0]["alarm"])
+
+	// todo without dates has no start and end instead of zero time
+	data, err := json.Marshal(&Event{Name: ical.CompToDo, Uid: "todo"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"VTODO","summary":"","uid":"todo"}`, string(data))
+	data, err = json.Marshal(Event{Name: ical.CompEvent, Uid: "event", DateTimeStart: at(1, 9, 0)})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"VEVENT","summary":"","uid":"event","start":"2024-07-01T09:00:00Z"}`, string(data))
+}
+
+func TestReadCalendarsJCal(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(jcalData)).Decode()
+	assert.NoError(t, err)
+	data, err := EncodeJCal(cal)
+	assert.NoError(t, err)
+	cals, err := ReadCalendars(bytes.NewReader(append([]byte("\n  "), data...)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(cals))
+	objects, err := SplitCalendars(cals...)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(objects))
+}
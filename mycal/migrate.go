@@ -0,0 +1,195 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// Endpoint is logged in account on one server
+type Endpoint struct {
+	HTTPClient webdav.HTTPClient
+	Client     *caldav.Client
+	URL        string
+	Homeset    string
+}
+
+type MigrateOptions struct {
+	// Calendars limits migration to calendars with these names, all when empty
+	Calendars []string
+	DryRun    bool
+	// StatePath is json file with progress, migration continues from it when interrupted
+	StatePath string
+}
+
+type MigrateReport struct {
+	CreatedCalendars []string
+	Copied           []string
+	// Skipped are objects copied by previous run and unchanged since
+	Skipped []string
+	// Existing are objects that were on destination before migration or changed
+	// after it copied them, they are left as they are
+	Existing []string
+	// Mismatches are objects that differ after copying
+	Mismatches []string
+}
+
+// MigrateState maps every copied object, by its source and destination URL, to its ETag
+// on destination, so one state file serves migrations between different servers
+type MigrateState struct {
+	Path   string
+	Copied map[string]string
+}
+
+func LoadMigrateState(path string) (*MigrateState, error) {
+	state := &MigrateState{Path: path, Copied: make(map[string]string)}
+	if path == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state.Copied); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func migrateKey(src, dst *Endpoint, srcPath, dstPath string) string {
+	return collectionURL(src.URL, srcPath, "") + " " + collectionURL(dst.URL, dstPath, "")
+}
+
+func (state *MigrateState) Save() error {
+	if state.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(state.Copied, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(state.Path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(state.Path, data, 0o600)
+}
+
+// Migrate recreates calendars of src on dst with their properties and copies
+// objects under the same names, UIDs are kept as data is copied unchanged
+func Migrate(ctx context.Context, src, dst *Endpoint, opts MigrateOptions) (*MigrateReport, error) {
+	state, err := LoadMigrateState(opts.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	calendars, err := ListCalendarProps(ctx, src.HTTPClient, src.URL, src.Homeset)
+	if err != nil {
+		return nil, err
+	}
+	report := &MigrateReport{}
+	for i := range calendars {
+		props := &calendars[i]
+		if len(opts.Calendars) > 0 && !contains(opts.Calendars, props.Name) && !contains(opts.Calendars, props.DisplayName) {
+			continue
+		}
+		if err := migrateCalendar(ctx, src, dst, props, opts, state, report); err != nil {
+			return report, fmt.Errorf("%s: %v", props.Name, err)
+		}
+	}
+	return report, nil
+}
+
+func migrateCalendar(ctx context.Context, src, dst *Endpoint, props *CalendarProps, opts MigrateOptions, state *MigrateState, report *MigrateReport) error {
+	_, err := GetCalendarProps(ctx, dst.HTTPClient, dst.URL, dst.Homeset, props.Name)
+	var de *davError
+	exists := true
+	if errors.As(err, &de) && de.StatusCode == http.StatusNotFound {
+		exists = false
+		report.CreatedCalendars = append(report.CreatedCalendars, props.Name)
+		if !opts.DryRun {
+			err = MakeCalendar(ctx, dst.HTTPClient, dst.URL, dst.Homeset, props.Name, props)
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	objects, err := src.Client.QueryCalendar(ctx, props.Path, allObjectsQuery())
+	if err != nil {
+		return fmt.Errorf("error getting calendar query: %v", err)
+	}
+	dstURL := collectionURL(dst.URL, dst.Homeset, props.Name+"/")
+	dstETags := make(map[string]string)
+	if exists {
+		dstETags, err = listETags(ctx, dst.HTTPClient, dstURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, obj := range objects {
+		dstPath := dst.Homeset + props.Name + "/" + path.Base(obj.Path)
+		if etag, ok := dstETags[dstPath]; ok {
+			if copied := state.Copied[migrateKey(src, dst, obj.Path, dstPath)]; copied != "" && copied == etag {
+				report.Skipped = append(report.Skipped, dstPath)
+			} else {
+				report.Existing = append(report.Existing, dstPath)
+			}
+			continue
+		}
+		report.Copied = append(report.Copied, dstPath)
+		if opts.DryRun {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := ical.NewEncoder(&buf).Encode(obj.Data); err != nil {
+			return err
+		}
+		etag, err := writeObject(ctx, dst.HTTPClient, http.MethodPut, collectionURL(dst.URL, dstPath, ""), "", buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s: %v", obj.Path, err)
+		}
+		state.Copied[migrateKey(src, dst, obj.Path, dstPath)] = etag
+		if err := state.Save(); err != nil {
+			return err
+		}
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	// every source object must be on destination, unchanged since it was put there
+	dstETags, err = listETags(ctx, dst.HTTPClient, dstURL)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		dstPath := dst.Homeset + props.Name + "/" + path.Base(obj.Path)
+		etag, ok := dstETags[dstPath]
+		copied := state.Copied[migrateKey(src, dst, obj.Path, dstPath)]
+		switch {
+		case !ok:
+			report.Mismatches = append(report.Mismatches, dstPath+": missing")
+		case copied != "" && copied != etag && !contains(report.Existing, dstPath):
+			report.Mismatches = append(report.Mismatches, dstPath+": ETag changed")
+		}
+	}
+	if len(dstETags) < len(objects) {
+		report.Mismatches = append(report.Mismatches, fmt.Sprintf("%s: %d objects on source, %d on destination", props.Name, len(objects), len(dstETags)))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package mycal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeDAV("default", "work")
+	source.put(syncHomeset+"default/a.ics", calendarData("a"))
+	source.put(syncHomeset+"default/b.ics", calendarData("b"))
+	source.put(syncHomeset+"work/c.ics", calendarData("c"))
+	srcServer, srcClient := startFakeDAV(t, source)
+	src := &Endpoint{HTTPClient: srcServer.Client(), Client: srcClient, URL: srcServer.URL + "/dav.php", Homeset: syncHomeset}
+
+	dest := newFakeDAV("default")
+	// left by interrupted run
+	dest.put(syncHomeset+"default/a.ics", calendarData("a"))
+	dstServer, dstClient := startFakeDAV(t, dest)
+	dst := &Endpoint{HTTPClient: dstServer.Client(), Client: dstClient, URL: dstServer.URL, Homeset: syncHomeset}
+
+	opts := MigrateOptions{DryRun: true, StatePath: filepath.Join(t.TempDir(), "migrate.json")}
+	report, err := Migrate(ctx, src, dst, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"work"}, report.CreatedCalendars)
+	assert.ElementsMatch(t, []string{syncHomeset + "default/b.ics", syncHomeset + "work/c.ics"}, report.Copied)
+	assert.Equal(t, 1, len(dest.objects))
+	assert.Empty(t, dest.made)
+
+	opts.DryRun = false
+	report, err = Migrate(ctx, src, dst, opts)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Skipped)
+	assert.Equal(t, []string{syncHomeset + "default/a.ics"}, report.Existing)
+	assert.Empty(t, report.Mismatches)
+	assert.Equal(t, 3, len(dest.objects))
+	assert.Equal(t, 1, len(dest.made))
+
+	state, err := LoadMigrateState(opts.StatePath)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(state.Copied))
+
+	// nothing left to copy
+	report, err = Migrate(ctx, src, dst, opts)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Copied)
+	assert.Equal(t, 2, len(report.Skipped))
+	assert.Equal(t, 1, len(report.Existing))
+
+	// the same state doesn't count objects copied to another destination
+	other := newFakeDAV("default", "work")
+	other.put(syncHomeset+"default/b.ics", calendarData("b"))
+	otherServer, otherClient := startFakeDAV(t, other)
+	report, err = Migrate(ctx, src, &Endpoint{HTTPClient: otherServer.Client(), Client: otherClient, URL: otherServer.URL, Homeset: syncHomeset}, opts)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Skipped)
+	assert.Equal(t, []string{syncHomeset + "default/b.ics"}, report.Existing)
+	assert.Equal(t, 2, len(report.Copied))
+}
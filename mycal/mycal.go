@@ -4,12 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -21,19 +23,21 @@ import (
 )
 
 type Event struct {
-	Name          string
-	Summary       string
-	Uid           string
-	DateTimeStart time.Time
-	DateTimeEnd   time.Time
-	Attendees     []string
-	Organizer     string
-	Alarm         *Alarm
+	Name          string    `json:"type"`
+	Summary       string    `json:"summary"`
+	Uid           string    `json:"uid"`
+	DateTimeStart time.Time `json:"start,omitempty"`
+	DateTimeEnd   time.Time `json:"end,omitempty"`
+	Attendees     []string  `json:"attendees,omitempty"`
+	Organizer     string    `json:"organizer,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	Alarm         *Alarm    `json:"alarm,omitempty"`
 }
 
 type Alarm struct {
-	Action  string
-	Trigger string
+	Action  string `json:"action"`
+	Trigger string `json:"trigger"`
 	// Description string
 	// Duration    time.Time
 	// Repeat      int
@@ -54,6 +58,16 @@ type ReccurentEvent struct {
 	BySetPos   []int
 }
 
+type AttendeeStatus struct {
+	Email          string
+	PartStat       string
+	ScheduleStatus string
+	DelegatedTo    string
+}
+
+// SCHEDULE-STATUS is set by server on organizer's copy, RFC 6638 section 7.3
+const ParamScheduleStatus = "SCHEDULE-STATUS"
+
 type Modifications struct {
 	Email        string
 	PartStat     string
@@ -139,48 +153,7 @@ func ListCalendars(ctx context.Context, client *caldav.Client, homeset string) e
 
 // tested
 func CreateCalendar(ctx context.Context, httpClient webdav.HTTPClient, url, homeset, calendarName, description string) error {
-	timezone := `
-	BEGIN:VTIMEZONE
-	TZID:Asia/Krasnoyarsk
-	TZURL:https://www.tzurl.org/zoneinfo/Asia/Krasnoyarsk
-	BEGIN:STANDARD
-	TZNAME:+06
-	TZOFFSETFROM:+061126
-	TZOFFSETTO:+0600
-	DTSTART:19200106T000000
-	END:STANDARD
-	BEGIN:DAYLIGHT
-	TZNAME:+07
-	TZOFFSETFROM:+0700
-	TZOFFSETTO:+0700
-	DTSTART:19910331T020000
-	END:DAYLIGHT
-	END:VTIMEZONE`
-	reqBody := fmt.Sprintf(`
-	<C:mkcalendar xmlns:D='DAV:' xmlns:C='urn:ietf:params:xml:ns:caldav'>
-			<D:set>
-				<D:prop>
-					<D:displayname>%s</D:displayname>
-					<C:calendar-description>%s</C:calendar-description>
-					<C:calendar-timezone>%s</C:calendar-timezone>
-				</D:prop>
-			</D:set>
-		</C:mkcalendar>`, calendarName, description, timezone)
-	calURL := url + homeset[8:] + calendarName
-	req, err := http.NewRequest("MKCALENDAR", calURL, bytes.NewBufferString(reqBody))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/xml")
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusCreated {
-		return err
-	}
-	return nil
+	return MakeCalendar(ctx, httpClient, url, homeset, calendarName, &CalendarProps{DisplayName: calendarName, Description: description})
 }
 
 // tested
@@ -229,25 +202,7 @@ func GetEvents(ctx context.Context, client *caldav.Client, homeset, calendarName
 }
 
 func GetByUid(ctx context.Context, client *caldav.Client, homeset, calendarName, uid string) ([]caldav.CalendarObject, error) {
-	query := &caldav.CalendarQuery{
-		CompRequest: caldav.CalendarCompRequest{
-			Name: "VCALENDAR",
-			Comps: []caldav.CalendarCompRequest{{
-				Name:     "VEVENT",
-				AllProps: true,
-			}},
-		},
-		CompFilter: caldav.CompFilter{
-			Name: "VCALENDAR",
-			Comps: []caldav.CompFilter{{
-				Name: "VEVENT",
-				Props: []caldav.PropFilter{{
-					Name:      ical.PropUID,
-					TextMatch: &caldav.TextMatch{Text: uid},
-				}},
-			}},
-		},
-	}
+	query := uidQuery(ical.CompEvent, uid)
 
 	calendarURL := homeset + calendarName
 	resp, err := client.QueryCalendar(ctx, calendarURL, query)
@@ -293,6 +248,9 @@ func GetEvent(newEvent *Event) (*ical.Event, error) {
 	event := ical.NewEvent()
 	event.Name = newEvent.Name
 	event.Props.SetText(ical.PropUID, newEvent.Uid)
+	if newEvent.Summary != "" {
+		event.Props.SetText(ical.PropSummary, newEvent.Summary)
+	}
 	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
 	event.Props.SetDateTime(ical.PropDateTimeStart, newEvent.DateTimeStart)
 	event.Props.SetDateTime(ical.PropDateTimeEnd, newEvent.DateTimeEnd)
@@ -307,6 +265,7 @@ func GetEvent(newEvent *Event) (*ical.Event, error) {
 		event.Props.Add(prop)
 	}
 	SetOrganizer(event, newEvent)
+	SetDetails(event, newEvent)
 	AddAlarm(event, newEvent)
 	return event, nil
 }
@@ -348,7 +307,7 @@ func SetSummary(old *ical.Event, new *Event) error {
 // }
 
 func AddAttendee(old *ical.Event, attendee string) {
-	if attendee != "" {
+	if attendee == "" {
 		return
 	}
 	prop := ical.NewProp(ical.PropAttendee)
@@ -366,6 +325,16 @@ func SetOrganizer(old *ical.Event, new *Event) {
 	}
 }
 
+// SetDetails sets location and status when they are given
+func SetDetails(old *ical.Event, new *Event) {
+	if new.Location != "" {
+		old.Props.SetText(ical.PropLocation, new.Location)
+	}
+	if new.Status != "" {
+		old.Props.SetText(ical.PropStatus, strings.ToUpper(new.Status))
+	}
+}
+
 func AddAlarm(old *ical.Event, new *Event) {
 	if new.Alarm != nil {
 		alarm := ical.NewComponent(ical.CompAlarm)
@@ -385,11 +354,17 @@ func GetTodo(newEvent *Event) (*ical.Event, error) {
 	if err != nil {
 		return nil, err
 	}
+	if newEvent.Summary != "" {
+		event.Props.SetText(ical.PropSummary, newEvent.Summary)
+	}
 	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
 	//SetDTStart(event, newEvent)
-	event.Props.SetDateTime(ical.PropDateTimeStart, newEvent.DateTimeStart)
+	if !newEvent.DateTimeStart.IsZero() {
+		event.Props.SetDateTime(ical.PropDateTimeStart, newEvent.DateTimeStart)
+	}
 	event.Props.SetDateTime(ical.PropDue, newEvent.DateTimeEnd)
 	event.Props.SetText(ical.PropStatus, "NEEDS-ACTION")
+	SetDetails(event, newEvent)
 	return event, nil
 }
 
@@ -421,21 +396,23 @@ func GetRecurrentEvent(newRecEvent *ReccurentEvent) *ical.Event {
 		Byeaster:   []int{},
 	})
 
+	if newRecEvent.Event.Summary != "" {
+		event.Props.SetText(ical.PropSummary, newRecEvent.Event.Summary)
+	}
 	for _, attendee := range newRecEvent.Event.Attendees {
 		AddAttendee(event, attendee)
 	}
 	SetOrganizer(event, newRecEvent.Event)
+	SetDetails(event, newRecEvent.Event)
 	return event
 }
 
 // tested
-func CreateEvent(ctx context.Context, client *caldav.Client, homeset string, calendarName string, event *ical.Event) error {
-	calendar := ical.NewCalendar()
-	calendar.Props.SetText(ical.PropVersion, "2.0")
-	calendar.Props.SetText(ical.PropProductID, "-//trvita//EN")
-	calendar.Props.SetText(ical.PropCalendarScale, "GREGORIAN")
-
-	calendar.Children = append(calendar.Children, event.Component)
+// CreateEvent uploads event as one object, related components such as
+// overridden instances and VTIMEZONEs go to the same object
+func CreateEvent(ctx context.Context, client *caldav.Client, homeset string, calendarName string, event *ical.Event, related ...*ical.Component) error {
+	calendar := newCalendar(event.Component)
+	calendar.Children = append(calendar.Children, related...)
 	eventUID, err := event.Props.Text(ical.PropUID)
 	if err != nil {
 		return err
@@ -536,55 +513,84 @@ func FindEvent(ctx context.Context, client *caldav.Client, eventURL, eventUID st
 }
 
 // tested
-func ModifyAttendance(ctx context.Context, client *caldav.Client, homeset, calendarName, eventUID, eventPath string, mods *Modifications) error {
+func ModifyAttendance(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset, calendarName, eventUID, eventPath string, mods *Modifications) error {
 	eventURL := homeset[9:] + calendarName + "/" + eventPath + ".ics"
-	comp, err := FindEvent(ctx, client, eventURL, eventUID)
+	obj, err := client.GetCalendarObject(ctx, eventURL)
 	if err != nil {
 		return err
 	}
-	newEventURL := homeset[9:] + mods.CalendarName + "/" + eventPath + ".ics"
-
-	var att ical.Prop
-	for _, att = range comp.Props.Values(ical.PropAttendee) {
-		uri, err := att.URI()
-		if err != nil {
-			return err
+	// whole object is kept: time zones and overridden instances go with event,
+	// METHOD of inbox item doesn't belong to stored copy
+	cal := copyCalendar(obj.Data)
+	cal.Props.Del(ical.PropMethod)
+	lastModified := mods.LastModified
+	if lastModified.IsZero() {
+		lastModified = time.Now()
+	}
+
+	// server delivers REPLY to organizer by itself once attendee's copy
+	// with new PARTSTAT is stored (implicit scheduling, RFC 6638)
+	var request *ical.Calendar
+	answered := false
+	for _, comp := range cal.Children {
+		if uid, _ := comp.Props.Text(ical.PropUID); comp.Name != ical.CompEvent || uid != eventUID || FindAttendee(comp, mods.Email) == nil {
+			continue
 		}
-		if uri.String() == mods.Email {
-			break
+		if mods.PartStat == "DELEGATED" {
+			_, req, err := ITIPDelegate(comp, mods.Email, mods.DelegateTo)
+			if err != nil {
+				return err
+			}
+			if request == nil {
+				request = req
+			} else {
+				request.Children = append(request.Children, req.Children...)
+			}
+		} else if _, err := ITIPReply(comp, mods.Email, mods.PartStat); err != nil {
+			return err
 		}
+		comp.Props.SetDateTime(ical.PropLastModified, lastModified)
+		answered = true
+	}
+	if !answered {
+		return fmt.Errorf("attendee %s not found in event %s", mods.Email, eventUID)
 	}
 
-	if mods.PartStat == "DECLINED" {
-		err = Delete(ctx, client, eventURL)
-		if err != nil {
-			return err
-		} else {
-			return nil
-		}
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return err
 	}
-	if mods.PartStat == "ACCEPTED" {
-		att.Params.Set(ical.ParamParticipationStatus, mods.PartStat)
+	path := homeset + calendarName + "/" + eventPath + ".ics"
+	newPath := homeset + mods.CalendarName + "/" + eventPath + ".ics"
+	etag := ""
+	if newPath == path {
+		etag = unquoteETag(obj.ETag)
 	}
-	// add delegation support
-	if !mods.LastModified.IsZero() {
-		comp.Props.SetDateTime(ical.PropLastModified, mods.LastModified)
+	if etag == "" {
+		// copy may already be in destination calendar, it is replaced only as it is now
+		if current, err := OpenObject(ctx, httpClient, url, newPath); err == nil {
+			etag = current.ETag
+		}
 	}
-	if mods.DelegateTo != "" {
-		comp.Props.SetText(ical.ParamDelegatedTo, mods.DelegateTo)
+	_, err = writeObject(ctx, httpClient, http.MethodPut, collectionURL(url, newPath, ""), etag, buf.Bytes())
+	if isPrecondition(err) {
+		return ErrChanged
 	}
-	comp.Props.SetDateTime(ical.PropLastModified, time.Now())
-
-	calendar := ical.NewCalendar()
-	calendar.Props.SetText(ical.PropVersion, "2.0")
-	calendar.Props.SetText(ical.PropProductID, "-//trvita//EN")
-	calendar.Props.SetText(ical.PropCalendarScale, "GREGORIAN")
-	calendar.Children = append(calendar.Children, comp)
-	_, err = client.PutCalendarObject(ctx, newEventURL, calendar)
 	if err != nil {
 		return err
 	}
-	return nil
+	// attendees can't invite others implicitly, so delegate gets REQUEST from outbox
+	if request != nil {
+		_, err = SendITIP(ctx, httpClient, url, homeset, mods.Email, request, mods.DelegateTo)
+		if err != nil {
+			return fmt.Errorf("sending request to delegate: %v", err)
+		}
+	}
+	if newPath == path {
+		return nil
+	}
+	// inbox item is handled, it is no longer needed
+	return Delete(ctx, client, eventURL)
 }
 
 // tested
@@ -614,26 +620,148 @@ func PutAttendee(ctx context.Context, client *caldav.Client, attendee, homeset,
 	return nil
 }
 
-// TODO write func that requests attendees aka attendee syncronization
-func LookUpAttendees() {
+// LookUpAttendees synchronizes attendees of event organized by user: replies
+// waiting in schedule inbox are applied to organizer's copy and removed, then
+// current PARTSTAT and SCHEDULE-STATUS of every attendee are returned
+func LookUpAttendees(ctx context.Context, client *caldav.Client, homeset, calendarName, eventUID string) ([]AttendeeStatus, error) {
+	resp, err := GetByUid(ctx, client, homeset, calendarName, eventUID)
+	if err != nil {
+		return nil, err
+	}
+	obj := resp[0]
+	if _, err := findComponent(obj.Data, eventUID); err != nil {
+		return nil, err
+	}
+
+	// inbox may be empty, then there is nothing to apply
+	replies, _ := GetByUid(ctx, client, homeset, "inbox", eventUID)
+	sort.Slice(replies, func(i, j int) bool {
+		return replyStamp(replies[i]).Before(replyStamp(replies[j]))
+	})
+	// replies are deleted only after organizer's copy with their changes is stored,
+	// replies that can't be applied stay in inbox and are reported
+	var applied []string
+	var errs []error
+	for _, reply := range replies {
+		method, _ := reply.Data.Props.Text(ical.PropMethod)
+		if !strings.EqualFold(method, MethodReply) {
+			continue
+		}
+		updated, err := ApplyITIPCalendar(obj.Data, reply.Data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", reply.Path, err))
+			continue
+		}
+		obj.Data = updated
+		applied = append(applied, reply.Path)
+	}
+	if len(applied) > 0 {
+		_, err = client.PutCalendarObject(ctx, obj.Path, obj.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range applied {
+		if err := Delete(ctx, client, path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	comp, err := findComponent(obj.Data, eventUID)
+	if err != nil {
+		return nil, err
+	}
+	return AttendeeStatuses(comp), errors.Join(errs...)
+}
+
+func replyStamp(obj caldav.CalendarObject) time.Time {
+	for _, comp := range obj.Data.Children {
+		if stamp, err := comp.Props.DateTime(ical.PropDateTimeStamp, time.UTC); err == nil && !stamp.IsZero() {
+			return stamp
+		}
+	}
+	return time.Time{}
+}
 
+// AttendeeStatuses reads PARTSTAT and SCHEDULE-STATUS of attendees of event
+func AttendeeStatuses(comp *ical.Component) []AttendeeStatus {
+	var statuses []AttendeeStatus
+	for _, att := range comp.Props.Values(ical.PropAttendee) {
+		partstat := strings.ToUpper(att.Params.Get(ical.ParamParticipationStatus))
+		if partstat == "" {
+			partstat = "NEEDS-ACTION"
+		}
+		statuses = append(statuses, AttendeeStatus{
+			Email:          strings.TrimPrefix(att.Value, "mailto:"),
+			PartStat:       partstat,
+			ScheduleStatus: att.Params.Get(ParamScheduleStatus),
+			DelegatedTo:    strings.TrimPrefix(att.Params.Get(ical.ParamDelegatedTo), "mailto:"),
+		})
+	}
+	return statuses
+}
+
+// SummarizeAttendees groups attendees by answer: accepted, declined, tentative, delegated and no response
+func SummarizeAttendees(statuses []AttendeeStatus) map[string][]string {
+	summary := make(map[string][]string)
+	for _, status := range statuses {
+		var group string
+		switch status.PartStat {
+		case "ACCEPTED":
+			group = "accepted"
+		case "DECLINED":
+			group = "declined"
+		case "TENTATIVE":
+			group = "tentative"
+		case "DELEGATED":
+			group = "delegated"
+		default:
+			group = "no response"
+		}
+		summary[group] = append(summary[group], status.Email)
+	}
+	return summary
+}
+
+// OrganizedEvents returns events of calendar whose organizer is email
+func OrganizedEvents(ctx context.Context, client *caldav.Client, homeset, calendarName, email string) ([]*ical.Component, error) {
+	resp, err := GetEvents(ctx, client, homeset, calendarName)
+	if err != nil {
+		return nil, err
+	}
+	var events []*ical.Component
+	for _, obj := range resp {
+		for _, comp := range obj.Data.Children {
+			org := comp.Props.Get(ical.PropOrganizer)
+			if comp.Name == ical.CompEvent && org != nil && sameAddress(org.Value, email) && comp.Props.Get(ical.PropRecurrenceID) == nil {
+				events = append(events, comp)
+			}
+		}
+	}
+	return events, nil
 }
 
 func UpdateEvent(ctx context.Context, client *caldav.Client, homeset, calendarName, eventUID, eventPath string) error {
 	eventURL := homeset[9:] + "inbox/" + eventPath + ".ics"
 	oldEventURL := homeset[9:] + calendarName + "/" + eventUID + ".ics"
-	comp, err := FindEvent(ctx, client, eventURL, eventUID)
+	obj, err := client.GetCalendarObject(ctx, eventURL)
 	if err != nil {
 		return err
 	}
-	comp.Props.SetDateTime(ical.PropLastModified, time.Now())
+	if obj.Data.Props.Get(ical.PropMethod) == nil {
+		obj.Data.Props.SetText(ical.PropMethod, MethodRequest)
+	}
+	// there is no stored copy when event is new
+	var stored *ical.Calendar
+	if storedObj, err := client.GetCalendarObject(ctx, oldEventURL); err == nil {
+		stored = storedObj.Data
+	}
+	cal, err := ApplyITIPCalendar(stored, obj.Data)
+	if err != nil {
+		return err
+	}
+	setLastModified(cal, time.Now())
 
-	calendar := ical.NewCalendar()
-	calendar.Props.SetText(ical.PropVersion, "2.0")
-	calendar.Props.SetText(ical.PropProductID, "-//trvita//EN")
-	calendar.Props.SetText(ical.PropCalendarScale, "GREGORIAN")
-	calendar.Children = append(calendar.Children, comp)
-	_, err = client.PutCalendarObject(ctx, oldEventURL, calendar)
+	_, err = client.PutCalendarObject(ctx, oldEventURL, cal)
 	if err != nil {
 		return err
 	}
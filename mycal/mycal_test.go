@@ -230,7 +230,7 @@ func TestAttend_Reply(t *testing.T) {
 	currentUser := "user3"
 	currentUID := uids[0]
 	currentCalendar := calendars[1]
-	_, client, homeset, ctx := setupClient(t, currentUser)
+	httpClient, client, homeset, ctx := setupClient(t, currentUser)
 
 	resp, err := GetEvents(ctx, client, homeset, currentCalendar)
 	assert.NoError(t, err)
@@ -256,7 +256,7 @@ func TestAttend_Reply(t *testing.T) {
 		CalendarName: calendars[0],
 		Email:        users[currentUser][email],
 	}
-	err = ModifyAttendance(ctx, client, homeset, currentCalendar, currentUID, eventFileName, mods)
+	err = ModifyAttendance(ctx, httpClient, client, URL, homeset, currentCalendar, currentUID, eventFileName, mods)
 	assert.NoError(t, err)
 }
 func TestAttend_Check(t *testing.T) {
@@ -304,7 +304,7 @@ func TestAddAttendee(t *testing.T) {
 // redo with real uid and calendar names
 func TestPutEvent(t *testing.T) {
 	currentUser := "user1"
-	_, client, homeset, ctx := setupClient(t, currentUser)
+	httpClient, client, homeset, ctx := setupClient(t, currentUser)
 
 	resp, err := GetEvents(ctx, client, homeset, calendars[1])
 	assert.NoError(t, err)
@@ -330,7 +330,7 @@ func TestPutEvent(t *testing.T) {
 		CalendarName: calendars[5],
 		Email:        "",
 	}
-	err = ModifyAttendance(ctx, client, homeset, calendars[1], uids[2], eventFileName, mods)
+	err = ModifyAttendance(ctx, httpClient, client, URL, homeset, calendars[1], uids[2], eventFileName, mods)
 	assert.NoError(t, err)
 
 }
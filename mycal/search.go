@@ -0,0 +1,351 @@
+package mycal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// collations of CalDAV text-match (RFC 4790)
+const (
+	// CollationASCII ignores case of ASCII letters, every server supports it
+	CollationASCII = "i;ascii-casemap"
+	// CollationOctet compares bytes, case matters
+	CollationOctet = "i;octet"
+	// CollationUnicode ignores case of all letters, not every server supports it
+	CollationUnicode = "i;unicode-casemap"
+)
+
+var Collations = []string{CollationASCII, CollationOctet, CollationUnicode}
+
+// SearchFields are properties text is looked for in
+var SearchFields = []string{ical.PropSummary, ical.PropDescription, ical.PropLocation, ical.PropAttendee, ical.PropCategories}
+
+// SearchQuery selects objects by text in any of Fields, time range, status and
+// category, empty parts don't restrict anything
+type SearchQuery struct {
+	Text string
+	// Fields are property names, SearchFields when empty
+	Fields []string
+	// Components are VEVENT, VTODO or VJOURNAL, ObjectComponents when empty
+	Components []string
+	// Collation is CollationASCII when empty
+	Collation  string
+	Start, End time.Time
+	Status     string
+	// Category must be one of CATEGORIES, case is ignored
+	Category string
+}
+
+// SearchResult is matching object with display name of its calendar
+type SearchResult struct {
+	Calendar string
+	Object   caldav.CalendarObject
+}
+
+func (q *SearchQuery) fields() []string {
+	if len(q.Fields) == 0 {
+		return SearchFields
+	}
+	return q.Fields
+}
+
+func (q *SearchQuery) components() []string {
+	if len(q.Components) == 0 {
+		return ObjectComponents
+	}
+	return q.Components
+}
+
+func (q *SearchQuery) collation() string {
+	if q.Collation == "" {
+		return CollationASCII
+	}
+	return q.Collation
+}
+
+// Check validates fields, components and collation of query
+func (q *SearchQuery) Check() error {
+	for _, field := range q.Fields {
+		if !contains(SearchFields, field) {
+			return fmt.Errorf("can't search in %s, fields are %s", field, strings.Join(SearchFields, ", "))
+		}
+	}
+	for _, comp := range q.Components {
+		if !contains(ObjectComponents, comp) {
+			return fmt.Errorf("can't search %s, components are %s", comp, strings.Join(ObjectComponents, ", "))
+		}
+	}
+	if !contains(Collations, q.collation()) {
+		return fmt.Errorf("unknown collation %s", q.Collation)
+	}
+	if !q.Start.IsZero() && !q.End.IsZero() && !q.End.After(q.Start) {
+		return fmt.Errorf("end of time range must be after its start")
+	}
+	return nil
+}
+
+func (q *SearchQuery) fold(s string) string {
+	switch q.collation() {
+	case CollationOctet:
+		return s
+	case CollationUnicode:
+		return strings.ToLower(s)
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// Matches checks component the way server evaluates query, attendees also match by CN
+func (q *SearchQuery) Matches(comp *ical.Component) bool {
+	if !contains(q.components(), comp.Name) {
+		return false
+	}
+	if q.Status != "" {
+		status, _ := comp.Props.Text(ical.PropStatus)
+		if !strings.EqualFold(status, q.Status) {
+			return false
+		}
+	}
+	if q.Category != "" && !hasCategory(comp, q.Category) {
+		return false
+	}
+	if !q.inRange(comp) {
+		return false
+	}
+	if q.Text == "" {
+		return true
+	}
+	text := q.fold(q.Text)
+	for _, field := range q.fields() {
+		for _, prop := range comp.Props.Values(field) {
+			values := []string{prop.Value, prop.Params.Get(ical.ParamCommonName)}
+			// text is unescaped, lists such as CATEGORIES are split
+			if list, err := prop.TextList(); err == nil {
+				values = append(list, values[1])
+			}
+			for _, value := range values {
+				if value != "" && strings.Contains(q.fold(value), text) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func hasCategory(comp *ical.Component, category string) bool {
+	for _, prop := range comp.Props.Values(ical.PropCategories) {
+		list, _ := prop.TextList()
+		for _, value := range list {
+			if strings.EqualFold(strings.TrimSpace(value), category) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inRange checks time range like CalDAV time-range filter, objects without dates are in every range
+func (q *SearchQuery) inRange(comp *ical.Component) bool {
+	if q.Start.IsZero() && q.End.IsZero() {
+		return true
+	}
+	if comp.Name == ical.CompEvent && comp.Props.Get(ical.PropDateTimeStart) != nil {
+		if q.Start.IsZero() || q.End.IsZero() {
+			return occursIn(comp, q.Start, q.End)
+		}
+		periods, err := EventPeriods(comp, q.Start, q.End, time.UTC)
+		return err == nil && len(periods) > 0
+	}
+	start, end := q.Start, q.End
+	if start.IsZero() {
+		start = time.Unix(0, 0)
+	}
+	if end.IsZero() {
+		end = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+	var dates []time.Time
+	for _, name := range []string{ical.PropDateTimeStart, ical.PropDue} {
+		if prop := comp.Props.Get(name); prop != nil {
+			if t, err := prop.DateTime(time.UTC); err == nil {
+				dates = append(dates, t)
+			}
+		}
+	}
+	if len(dates) == 0 {
+		return true
+	}
+	for _, t := range dates {
+		if !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// occursIn checks if some occurrence of event overlaps range open at start or end.
+// Recurrence is followed only to first occurrence after start or last one before end,
+// not expanded over the whole open side.
+func occursIn(comp *ical.Component, start, end time.Time) bool {
+	event := ical.Event{Component: comp}
+	dtStart, err := event.DateTimeStart(time.UTC)
+	if err != nil {
+		return false
+	}
+	dtEnd, err := event.DateTimeEnd(time.UTC)
+	if err != nil {
+		return false
+	}
+	set, err := comp.RecurrenceSet(time.UTC)
+	if err != nil {
+		return false
+	}
+	if set == nil {
+		return (end.IsZero() || dtStart.Before(end)) && (start.IsZero() || dtEnd.After(start))
+	}
+	if end.IsZero() {
+		// occurrence ends after start
+		return !set.After(start.Add(-dtEnd.Sub(dtStart)), false).IsZero()
+	}
+	return !set.Before(end, false).IsZero()
+}
+
+func timeRangeXML(start, end time.Time) string {
+	if start.IsZero() && end.IsZero() {
+		return ""
+	}
+	var attrs string
+	if !start.IsZero() {
+		attrs += fmt.Sprintf(` start="%s"`, start.UTC().Format("20060102T150405Z"))
+	}
+	if !end.IsZero() {
+		attrs += fmt.Sprintf(` end="%s"`, end.UTC().Format("20060102T150405Z"))
+	}
+	return "<C:time-range" + attrs + "/>"
+}
+
+// queryXML is calendar-query of component, field is property text is matched in,
+// none for query that leaves text to client
+func (q *SearchQuery) queryXML(compName, field string) string {
+	var filters strings.Builder
+	filters.WriteString(timeRangeXML(q.Start, q.End))
+	if q.Status != "" {
+		fmt.Fprintf(&filters, `<C:prop-filter name="%s"><C:text-match collation="%s">%s</C:text-match></C:prop-filter>`,
+			ical.PropStatus, CollationASCII, escapeXML(strings.ToUpper(q.Status)))
+	}
+	if q.Category != "" {
+		// substring match, whole category is checked by client
+		fmt.Fprintf(&filters, `<C:prop-filter name="%s"><C:text-match collation="%s">%s</C:text-match></C:prop-filter>`,
+			ical.PropCategories, CollationASCII, escapeXML(q.Category))
+	}
+	if field != "" {
+		fmt.Fprintf(&filters, `<C:prop-filter name="%s"><C:text-match collation="%s">%s</C:text-match></C:prop-filter>`,
+			field, q.collation(), escapeXML(q.Text))
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+	<D:prop><D:getetag/><C:calendar-data/></D:prop>
+	<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="%s">%s</C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`, compName, filters.String())
+}
+
+// queryObjects sends calendar-query REPORT, objects are keyed by path
+func queryObjects(ctx context.Context, httpClient webdav.HTTPClient, calendarURL, body string, found map[string]caldav.CalendarObject) error {
+	ms, err := davRequest(ctx, httpClient, "REPORT", calendarURL, "1", body)
+	if err != nil {
+		return err
+	}
+	for _, resp := range ms.Responses {
+		prop := resp.prop()
+		if prop.CalendarData == "" {
+			continue
+		}
+		cal, err := ical.NewDecoder(strings.NewReader(prop.CalendarData)).Decode()
+		if err != nil {
+			return fmt.Errorf("%s: %v", resp.path(), err)
+		}
+		found[resp.path()] = caldav.CalendarObject{Path: resp.path(), ETag: prop.ETag, Data: cal}
+	}
+	return nil
+}
+
+// searchCalendar asks server with one text-match query per field and component, text
+// is matched by client when server rejects query, e.g. for unsupported collation
+func searchCalendar(ctx context.Context, httpClient webdav.HTTPClient, calendarURL string, q *SearchQuery) ([]caldav.CalendarObject, error) {
+	found := make(map[string]caldav.CalendarObject)
+	var err error
+	for _, compName := range q.components() {
+		if q.Text == "" {
+			err = queryObjects(ctx, httpClient, calendarURL, q.queryXML(compName, ""), found)
+		} else {
+			for _, field := range q.fields() {
+				if err = queryObjects(ctx, httpClient, calendarURL, q.queryXML(compName, field), found); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	var de *davError
+	if errors.As(err, &de) {
+		// only time range is left to server, it is the part every server understands
+		found = make(map[string]caldav.CalendarObject)
+		for _, compName := range q.components() {
+			plain := &SearchQuery{Start: q.Start, End: q.End}
+			if err := queryObjects(ctx, httpClient, calendarURL, plain.queryXML(compName, ""), found); err != nil {
+				return nil, err
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// servers may ignore parts of filter, so results are checked again
+	var objects []caldav.CalendarObject
+	for _, obj := range found {
+		for _, comp := range obj.Data.Children {
+			if q.Matches(comp) {
+				objects = append(objects, obj)
+				break
+			}
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Path < objects[j].Path })
+	return objects, nil
+}
+
+// Search finds objects matching query in calendars
+func Search(ctx context.Context, httpClient webdav.HTTPClient, url string, calendars []CalendarProps, q *SearchQuery) ([]SearchResult, error) {
+	if err := q.Check(); err != nil {
+		return nil, err
+	}
+	var results []SearchResult
+	for _, props := range calendars {
+		objects, err := searchCalendar(ctx, httpClient, collectionURL(url, props.Path, ""), q)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", props.Name, err)
+		}
+		name := props.DisplayName
+		if name == "" {
+			name = props.Name
+		}
+		for _, obj := range objects {
+			results = append(results, SearchResult{Calendar: name, Object: obj})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,154 @@
+package mycal
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+const searchEvent = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VEVENT\r\nUID:standup\r\n" +
+	"DTSTAMP:20240701T090000Z\r\nDTSTART:20240701T090000Z\r\nDTEND:20240701T093000Z\r\nRRULE:FREQ=DAILY;COUNT=5\r\n" +
+	"SUMMARY:Daily Standup\r\nDESCRIPTION:Bring your notes\\, please\r\nLOCATION:Room Ümlaut\r\nSTATUS:CONFIRMED\r\n" +
+	"ATTENDEE;CN=Jane Roe:mailto:jane@example.com\r\nCATEGORIES:work,team\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+const searchTodo = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VTODO\r\nUID:report\r\n" +
+	"DTSTAMP:20240701T090000Z\r\nDUE:20240720T170000Z\r\nSUMMARY:Write report\r\nSTATUS:NEEDS-ACTION\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+
+func decodeComponent(t *testing.T, data string) *ical.Component {
+	cal, err := ical.NewDecoder(strings.NewReader(data)).Decode()
+	assert.NoError(t, err)
+	return cal.Children[0]
+}
+
+func TestSearchQueryMatches(t *testing.T) {
+	event := decodeComponent(t, searchEvent)
+	todo := decodeComponent(t, searchTodo)
+	day := func(d int) time.Time { return time.Date(2024, 7, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name  string
+		query SearchQuery
+		event bool
+		todo  bool
+	}{
+		{"empty matches everything", SearchQuery{}, true, true},
+		{"summary ignores case", SearchQuery{Text: "standup"}, true, false},
+		{"description is unescaped", SearchQuery{Text: "notes, please"}, true, false},
+		{"location", SearchQuery{Text: "room"}, true, false},
+		{"attendee address", SearchQuery{Text: "jane@example"}, true, false},
+		{"attendee name", SearchQuery{Text: "jane roe"}, true, false},
+		{"category", SearchQuery{Text: "team"}, true, false},
+		{"both", SearchQuery{Text: "r"}, true, true},
+		{"only chosen fields", SearchQuery{Text: "standup", Fields: []string{ical.PropLocation}}, false, false},
+		{"only chosen components", SearchQuery{Text: "r", Components: []string{ical.CompToDo}}, false, true},
+		{"octet keeps case", SearchQuery{Text: "standup", Collation: CollationOctet}, false, false},
+		{"octet exact", SearchQuery{Text: "Standup", Collation: CollationOctet}, true, false},
+		{"ascii keeps non-ASCII case", SearchQuery{Text: "ümlaut"}, false, false},
+		{"unicode ignores case", SearchQuery{Text: "ümlaut", Collation: CollationUnicode}, true, false},
+		{"status", SearchQuery{Status: "needs-action"}, false, true},
+		{"text and status", SearchQuery{Text: "standup", Status: "CANCELLED"}, false, false},
+		{"recurrence in range", SearchQuery{Start: day(4), End: day(5)}, true, false},
+		{"recurrence ended", SearchQuery{Start: day(6), End: day(10)}, false, false},
+		{"due in range", SearchQuery{Start: day(20), End: day(21)}, false, true},
+		{"open range", SearchQuery{Start: day(3)}, true, true},
+		{"open range after recurrence", SearchQuery{Start: day(6)}, false, true},
+		{"open start", SearchQuery{End: day(2)}, true, false},
+		{"open start before recurrence", SearchQuery{End: day(1)}, false, false},
+		{"range and text", SearchQuery{Text: "report", End: day(2)}, false, false},
+		{"category", SearchQuery{Category: "TEAM"}, true, false},
+		{"category is whole value", SearchQuery{Category: "tea"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.event, tt.query.Matches(event), "event")
+			assert.Equal(t, tt.todo, tt.query.Matches(todo), "todo")
+		})
+	}
+
+	// rule without end is not expanded over open side of range
+	endless := decodeComponent(t, strings.Replace(searchEvent, "COUNT=5", "INTERVAL=1", 1))
+	assert.True(t, (&SearchQuery{Start: time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)}).Matches(endless))
+	assert.True(t, (&SearchQuery{End: day(2)}).Matches(endless))
+}
+
+func TestSearchQueryCheck(t *testing.T) {
+	assert.NoError(t, (&SearchQuery{Text: "x"}).Check())
+	assert.Error(t, (&SearchQuery{Fields: []string{"UID"}}).Check())
+	assert.Error(t, (&SearchQuery{Components: []string{"VALARM"}}).Check())
+	assert.Error(t, (&SearchQuery{Collation: "i;basic"}).Check())
+	now := time.Now()
+	assert.Error(t, (&SearchQuery{Start: now, End: now}).Check())
+}
+
+// searchServer answers calendar-query with every object, rejects unicode collation
+// like servers that don't support it
+func searchServer(t *testing.T, objects map[string]string, bodies *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*bodies = append(*bodies, string(body))
+		if strings.Contains(string(body), CollationUnicode) {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `<d:error xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><c:supported-collation/></d:error>`)
+			return
+		}
+		var resp strings.Builder
+		resp.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+		for path, data := range objects {
+			fmt.Fprintf(&resp, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>"1"</d:getetag><c:calendar-data>%s</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, path, html.EscapeString(data))
+		}
+		resp.WriteString(`</d:multistatus>`)
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, resp.String())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSearch(t *testing.T) {
+	var bodies []string
+	objects := map[string]string{"/cal/work/standup.ics": searchEvent, "/cal/work/report.ics": searchTodo}
+	server := searchServer(t, objects, &bodies)
+	ctx := context.Background()
+	calendars := []CalendarProps{{Path: "/cal/work/", Name: "work", DisplayName: "Work"}}
+
+	q := &SearchQuery{Text: "Standup", Components: []string{ical.CompEvent}, Fields: []string{ical.PropSummary, ical.PropLocation},
+		Start: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), Status: "confirmed"}
+	results, err := Search(ctx, server.Client(), server.URL, calendars, q)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "Work", results[0].Calendar)
+		assert.Equal(t, "/cal/work/standup.ics", results[0].Object.Path)
+	}
+	// one query per field, server filters text, time range and status
+	assert.Len(t, bodies, 2)
+	assert.Contains(t, bodies[0], `<C:comp-filter name="VEVENT"><C:time-range start="20240701T000000Z"/>`)
+	assert.Contains(t, bodies[0], `<C:prop-filter name="STATUS"><C:text-match collation="i;ascii-casemap">CONFIRMED</C:text-match>`)
+	assert.Contains(t, bodies[0], `<C:prop-filter name="SUMMARY"><C:text-match collation="i;ascii-casemap">Standup</C:text-match>`)
+	assert.Contains(t, bodies[1], `<C:prop-filter name="LOCATION">`)
+
+	// rejected collation falls back to matching by client
+	bodies = nil
+	results, err = Search(ctx, server.Client(), server.URL, calendars, &SearchQuery{Text: "ÜMLAUT", Collation: CollationUnicode})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "/cal/work/standup.ics", results[0].Object.Path)
+	}
+	assert.NotContains(t, bodies[len(bodies)-1], "text-match")
+
+	results, err = Search(ctx, server.Client(), server.URL, calendars, &SearchQuery{Status: "NEEDS-ACTION"})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "/cal/work/report.ics", results[0].Object.Path)
+	}
+
+	_, err = Search(ctx, server.Client(), server.URL, calendars, &SearchQuery{Fields: []string{"DTSTART"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,233 @@
+package mycal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+)
+
+// SyncState is what we know about calendar after last sync
+type SyncState struct {
+	SyncToken string
+	CTag      string
+	ETags     map[string]string // object path -> ETag
+}
+
+type SyncResult struct {
+	Changed []caldav.CalendarObject
+	Deleted []string
+	// Full is true when whole calendar was compared, e.g. on first sync
+	Full bool
+}
+
+// SyncStore keeps sync state of every calendar in a json file
+type SyncStore struct {
+	Path      string
+	Calendars map[string]*SyncState
+}
+
+// DefaultCacheDir is where sync state and cached objects live
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "caldav-client"), nil
+}
+
+func LoadSyncStore(path string) (*SyncStore, error) {
+	store := &SyncStore{Path: path, Calendars: make(map[string]*SyncState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.Calendars); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *SyncStore) Save() error {
+	data, err := json.MarshalIndent(store.Calendars, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(store.Path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(store.Path, data, 0o600)
+}
+
+// State returns sync state of calendar, empty one if calendar was never synced
+func (store *SyncStore) State(calendarPath string) *SyncState {
+	state, ok := store.Calendars[calendarPath]
+	if !ok {
+		state = &SyncState{}
+		store.Calendars[calendarPath] = state
+	}
+	if state.ETags == nil {
+		state.ETags = make(map[string]string)
+	}
+	return state
+}
+
+// SyncCalendar fetches objects changed since last sync using sync-collection
+// REPORT (RFC 6578) and calendar-multiget. Servers without sync-collection are
+// synced by comparing getctag of calendar and ETags of objects.
+func SyncCalendar(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset, calendarName string, state *SyncState) (*SyncResult, error) {
+	if state.ETags == nil {
+		state.ETags = make(map[string]string)
+	}
+	calendarURL := collectionURL(url, homeset, calendarName+"/")
+
+	changed, deleted, full, err := syncCollection(ctx, httpClient, calendarURL, state)
+	var de *davError
+	if errors.As(err, &de) && state.SyncToken != "" && (de.StatusCode == 403 || de.StatusCode == 409) && strings.Contains(de.Body, "valid-sync-token") {
+		// token expired on server, start over
+		state.SyncToken = ""
+		changed, deleted, full, err = syncCollection(ctx, httpClient, calendarURL, state)
+	}
+	if errors.As(err, &de) {
+		changed, deleted, full, err = syncByETags(ctx, httpClient, calendarURL, state)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{Deleted: deleted, Full: full}
+	if len(changed) > 0 {
+		result.Changed, err = client.MultiGetCalendar(ctx, homeset+calendarName, &caldav.CalendarMultiGet{
+			Paths: changed,
+			CompRequest: caldav.CalendarCompRequest{
+				Name:     "VCALENDAR",
+				AllProps: true,
+				AllComps: true,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, obj := range result.Changed {
+		state.ETags[obj.Path] = unquoteETag(obj.ETag)
+	}
+	for _, path := range deleted {
+		delete(state.ETags, path)
+	}
+	return result, nil
+}
+
+func syncCollection(ctx context.Context, httpClient webdav.HTTPClient, calendarURL string, state *SyncState) ([]string, []string, bool, error) {
+	reqBody := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" ?>
+	<D:sync-collection xmlns:D="DAV:">
+		<D:sync-token>%s</D:sync-token>
+		<D:sync-level>1</D:sync-level>
+		<D:prop>
+			<D:getetag/>
+		</D:prop>
+	</D:sync-collection>`, state.SyncToken)
+	ms, err := davRequest(ctx, httpClient, "REPORT", calendarURL, "", reqBody)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	full := state.SyncToken == ""
+	seen := make(map[string]bool)
+	var changed, deleted []string
+	for _, resp := range ms.Responses {
+		path := resp.path()
+		if strings.HasSuffix(path, "/") {
+			continue
+		}
+		if statusCode(resp.Status) == 404 {
+			deleted = append(deleted, path)
+			continue
+		}
+		seen[path] = true
+		etag := unquoteETag(resp.prop().ETag)
+		if etag == "" || state.ETags[path] != etag {
+			changed = append(changed, path)
+		}
+	}
+	if full {
+		// initial sync lists every member, anything else was removed meanwhile
+		for path := range state.ETags {
+			if !seen[path] {
+				deleted = append(deleted, path)
+			}
+		}
+	}
+	state.SyncToken = ms.SyncToken
+	return changed, deleted, full, nil
+}
+
+func syncByETags(ctx context.Context, httpClient webdav.HTTPClient, calendarURL string, state *SyncState) ([]string, []string, bool, error) {
+	ms, err := davRequest(ctx, httpClient, "PROPFIND", calendarURL, "0", `<?xml version="1.0" encoding="utf-8" ?>
+	<D:propfind xmlns:D="DAV:" xmlns:CS="http://calendarserver.org/ns/">
+		<D:prop>
+			<CS:getctag/>
+		</D:prop>
+	</D:propfind>`)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var ctag string
+	if len(ms.Responses) > 0 {
+		ctag = ms.Responses[0].prop().CTag
+	}
+	if ctag != "" && ctag == state.CTag {
+		return nil, nil, false, nil
+	}
+
+	etags, err := listETags(ctx, httpClient, calendarURL)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	var changed, deleted []string
+	for path, etag := range etags {
+		if etag == "" || state.ETags[path] != etag {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	for path := range state.ETags {
+		if _, ok := etags[path]; !ok {
+			deleted = append(deleted, path)
+		}
+	}
+	state.CTag = ctag
+	return changed, deleted, true, nil
+}
+
+// listETags returns ETags of every object in calendar collection
+func listETags(ctx context.Context, httpClient webdav.HTTPClient, calendarURL string) (map[string]string, error) {
+	ms, err := davRequest(ctx, httpClient, "PROPFIND", calendarURL, "1", `<?xml version="1.0" encoding="utf-8" ?>
+	<D:propfind xmlns:D="DAV:">
+		<D:prop>
+			<D:getetag/>
+		</D:prop>
+	</D:propfind>`)
+	if err != nil {
+		return nil, err
+	}
+	etags := make(map[string]string)
+	for _, resp := range ms.Responses {
+		path := resp.path()
+		if strings.HasSuffix(path, "/") {
+			continue
+		}
+		etags[path] = unquoteETag(resp.prop().ETag)
+	}
+	return etags, nil
+}
@@ -0,0 +1,127 @@
+package mycal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/caldav-client-yandex/caldav"
+)
+
+const syncHomeset = "/dav.php/calendars/testuser/"
+
+func calendarData(uid string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VEVENT\r\nUID:" + uid +
+		"\r\nDTSTAMP:20240701T090000Z\r\nDTSTART:20240701T090000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+}
+
+// syncServer serves sync-collection, getctag and calendar-multiget for one calendar
+func syncServer(t *testing.T, supportsSync bool, objects map[string]string, deleted []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := string(body)
+		var resp strings.Builder
+		resp.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+		switch {
+		case strings.Contains(req, "sync-collection"):
+			if !supportsSync {
+				w.WriteHeader(http.StatusNotImplemented)
+				return
+			}
+			for name, etag := range objects {
+				fmt.Fprintf(&resp, `<d:response><d:href>%sdefault/%s</d:href><d:propstat><d:prop><d:getetag>"%s"</d:getetag></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, syncHomeset, name, etag)
+			}
+			for _, name := range deleted {
+				fmt.Fprintf(&resp, `<d:response><d:href>%sdefault/%s</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>`, syncHomeset, name)
+			}
+			resp.WriteString(`<d:sync-token>token-2</d:sync-token>`)
+		case strings.Contains(req, "getctag"):
+			fmt.Fprintf(&resp, `<d:response><d:href>%sdefault/</d:href><d:propstat><d:prop><cs:getctag>ctag-1</cs:getctag></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, syncHomeset)
+		case strings.Contains(req, "propfind"):
+			for name, etag := range objects {
+				fmt.Fprintf(&resp, `<d:response><d:href>%sdefault/%s</d:href><d:propstat><d:prop><d:getetag>"%s"</d:getetag></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, syncHomeset, name, etag)
+			}
+		case strings.Contains(req, "calendar-multiget"):
+			for name, etag := range objects {
+				if !strings.Contains(req, name) {
+					continue
+				}
+				fmt.Fprintf(&resp, `<d:response><d:href>%sdefault/%s</d:href><d:propstat><d:prop><d:getetag>"%s"</d:getetag><c:calendar-data>%s</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, syncHomeset, name, etag, calendarData(strings.TrimSuffix(name, ".ics")))
+			}
+		}
+		resp.WriteString(`</d:multistatus>`)
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, resp.String())
+	}))
+}
+
+func syncTestClient(t *testing.T, server *httptest.Server) *caldav.Client {
+	client, err := caldav.NewClient(server.Client(), server.URL+"/dav.php")
+	assert.NoError(t, err)
+	return client
+}
+
+func TestSyncCalendar(t *testing.T) {
+	server := syncServer(t, true, map[string]string{"a.ics": "1", "b.ics": "2"}, []string{"c.ics"})
+	defer server.Close()
+	client := syncTestClient(t, server)
+
+	state := &SyncState{
+		SyncToken: "token-1",
+		ETags: map[string]string{
+			syncHomeset + "default/a.ics": "1",
+			syncHomeset + "default/c.ics": "1",
+		},
+	}
+	result, err := SyncCalendar(context.Background(), server.Client(), client, server.URL+"/dav.php", syncHomeset, "default", state)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Changed))
+	assert.Equal(t, syncHomeset+"default/b.ics", result.Changed[0].Path)
+	assert.Equal(t, []string{syncHomeset + "default/c.ics"}, result.Deleted)
+	assert.Equal(t, "token-2", state.SyncToken)
+	assert.Equal(t, map[string]string{
+		syncHomeset + "default/a.ics": "1",
+		syncHomeset + "default/b.ics": "2",
+	}, state.ETags)
+}
+
+func TestSyncCalendarFallback(t *testing.T) {
+	server := syncServer(t, false, map[string]string{"a.ics": "2"}, nil)
+	defer server.Close()
+	client := syncTestClient(t, server)
+
+	state := &SyncState{ETags: map[string]string{
+		syncHomeset + "default/a.ics": "1",
+		syncHomeset + "default/c.ics": "1",
+	}}
+	result, err := SyncCalendar(context.Background(), server.Client(), client, server.URL+"/dav.php", syncHomeset, "default", state)
+	assert.NoError(t, err)
+	assert.True(t, result.Full)
+	assert.Equal(t, 1, len(result.Changed))
+	assert.Equal(t, []string{syncHomeset + "default/c.ics"}, result.Deleted)
+	assert.Equal(t, "ctag-1", state.CTag)
+
+	// nothing changed since ctag is the same
+	result, err = SyncCalendar(context.Background(), server.Client(), client, server.URL+"/dav.php", syncHomeset, "default", state)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Changed)
+	assert.Empty(t, result.Deleted)
+}
+
+func TestSyncStore(t *testing.T) {
+	path := t.TempDir() + "/sync.json"
+	store, err := LoadSyncStore(path)
+	assert.NoError(t, err)
+	store.State("/cal/").SyncToken = "token"
+	assert.NoError(t, store.Save())
+
+	store, err = LoadSyncStore(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", store.State("/cal/").SyncToken)
+}
@@ -0,0 +1,295 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// Trash keeps deleted objects in directory, one json file per object, so that
+// deletions can be undone
+type Trash struct {
+	Dir string
+}
+
+// TrashItem is deleted object, objects deleted together share Batch
+type TrashItem struct {
+	ID      string    `json:"id"`
+	Batch   string    `json:"batch"`
+	Path    string    `json:"path"`
+	UID     string    `json:"uid"`
+	Summary string    `json:"summary"`
+	Deleted time.Time `json:"deleted"`
+	// Calendar is set when whole calendar was deleted, restoring makes it again.
+	// Calendar itself is kept as item with its path and no data.
+	Calendar *CalendarProps `json:"calendar,omitempty"`
+	Data     string         `json:"data"`
+}
+
+func (t *Trash) file(id string) string {
+	return filepath.Join(t.Dir, id+".json")
+}
+
+// newTrashItem describes object text, id is derived from path and time of deletion
+func newTrashItem(path string, data []byte, batch string, deleted time.Time) *TrashItem {
+	sum := sha1.Sum([]byte(path + deleted.Format(time.RFC3339Nano)))
+	item := &TrashItem{ID: hex.EncodeToString(sum[:])[:10], Batch: batch, Path: path, Deleted: deleted, Data: string(data)}
+	if cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode(); err == nil {
+		for _, comp := range cal.Children {
+			if contains(ObjectComponents, comp.Name) {
+				item.UID, _ = comp.Props.Text(ical.PropUID)
+				item.Summary, _ = comp.Props.Text(ical.PropSummary)
+				break
+			}
+		}
+	}
+	return item
+}
+
+func (t *Trash) Put(item *TrashItem) error {
+	if err := os.MkdirAll(t.Dir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.file(item.ID), data, 0o600)
+}
+
+func (t *Trash) Get(id string) (*TrashItem, error) {
+	data, err := os.ReadFile(t.file(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no item %s in trash", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var item TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("%s: %v", id, err)
+	}
+	return &item, nil
+}
+
+func (t *Trash) Remove(id string) error {
+	err := os.Remove(t.file(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns items in trash, most recently deleted first
+func (t *Trash) List() ([]TrashItem, error) {
+	files, err := filepath.Glob(filepath.Join(t.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]TrashItem, 0, len(files))
+	for _, file := range files {
+		item, err := t.Get(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].Deleted.Equal(items[j].Deleted) {
+			return items[i].Deleted.After(items[j].Deleted)
+		}
+		return items[i].Path < items[j].Path
+	})
+	return items, nil
+}
+
+// LastBatch returns items deleted together most recently, what undo restores
+func (t *Trash) LastBatch() ([]TrashItem, error) {
+	items, err := t.List()
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	var batch []TrashItem
+	for _, item := range items {
+		if item.Batch == items[0].Batch {
+			batch = append(batch, item)
+		}
+	}
+	return batch, nil
+}
+
+// Empty removes every item for good
+func (t *Trash) Empty() error {
+	items, err := t.List()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := t.Remove(item.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newBatch(now time.Time) string {
+	return now.Format("20060102T150405.000000000")
+}
+
+// deleteObject saves object to trash and deletes it if it wasn't changed since it was
+// read, or since it had etag when that is given
+func deleteObject(ctx context.Context, httpClient webdav.HTTPClient, url, path string, trash *Trash, batch string, now time.Time, etag string) (*TrashItem, error) {
+	obj, err := OpenObject(ctx, httpClient, url, path)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" && etag != obj.ETag {
+		return nil, ErrChanged
+	}
+	item := newTrashItem(obj.Path, obj.Data, batch, now)
+	// object is in trash before it is gone from server
+	if err := trash.Put(item); err != nil {
+		return nil, err
+	}
+	_, err = writeObject(ctx, httpClient, http.MethodDelete, collectionURL(url, obj.Path, ""), obj.ETag, nil)
+	if isPrecondition(err) {
+		err = ErrChanged
+	}
+	if err != nil {
+		trash.Remove(item.ID)
+		return nil, err
+	}
+	return item, nil
+}
+
+// DeleteObjects deletes objects by path after saving them to trash in one batch,
+// objects changed on server since they were read are not deleted. Failures don't
+// stop the rest, they are returned together.
+func DeleteObjects(ctx context.Context, httpClient webdav.HTTPClient, url string, paths []string, trash *Trash) ([]TrashItem, error) {
+	now := time.Now()
+	batch := newBatch(now)
+	var deleted []TrashItem
+	var errs []error
+	for _, path := range paths {
+		item, err := deleteObject(ctx, httpClient, url, path, trash, batch, now, "")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		deleted = append(deleted, *item)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// DeleteCalendar deletes calendar after saving its properties and every object to trash
+func DeleteCalendar(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset, calendarName string, trash *Trash) ([]TrashItem, error) {
+	props, err := GetCalendarProps(ctx, httpClient, url, homeset, calendarName)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := client.QueryCalendar(ctx, props.Path, allObjectsQuery())
+	if err != nil {
+		return nil, fmt.Errorf("error getting calendar query: %v", err)
+	}
+	now := time.Now()
+	batch := newBatch(now)
+	items := make([]TrashItem, 0, len(objects)+1)
+	discard := func() {
+		for _, item := range items {
+			trash.Remove(item.ID)
+		}
+	}
+	// calendar is in trash even when it has no objects, so undo makes it again
+	item := newTrashItem(props.Path, nil, batch, now)
+	item.Summary = props.DisplayName
+	if item.Summary == "" {
+		item.Summary = props.Name
+	}
+	item.Calendar = props
+	if err := trash.Put(item); err != nil {
+		return nil, err
+	}
+	items = append(items, *item)
+	for _, obj := range objects {
+		var buf bytes.Buffer
+		if err := ical.NewEncoder(&buf).Encode(obj.Data); err != nil {
+			discard()
+			return nil, fmt.Errorf("%s: %v", obj.Path, err)
+		}
+		item := newTrashItem(obj.Path, buf.Bytes(), batch, now)
+		item.Calendar = props
+		if err := trash.Put(item); err != nil {
+			discard()
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	if err := Delete(ctx, client, props.Path); err != nil {
+		discard()
+		return nil, err
+	}
+	return items, nil
+}
+
+// RestoreItems puts objects back under their paths and removes them from trash,
+// calendars deleted with them are made again. Objects whose path is taken by
+// now stay in trash. Restored items are counted, calendars too.
+func RestoreItems(ctx context.Context, httpClient webdav.HTTPClient, url string, items []TrashItem, trash *Trash) (int, error) {
+	restored := 0
+	checked := make(map[string]bool)
+	var errs []error
+	for _, item := range items {
+		calendarPath := calendarOf(item.Path)
+		if item.Data == "" {
+			calendarPath = strings.TrimSuffix(item.Path, "/") + "/"
+		}
+		if item.Calendar != nil && !checked[calendarPath] {
+			checked[calendarPath] = true
+			homeset := calendarOf(calendarPath)
+			name := strings.TrimSuffix(strings.TrimPrefix(calendarPath, homeset), "/")
+			_, err := GetCalendarProps(ctx, httpClient, url, homeset, name)
+			var de *davError
+			if errors.As(err, &de) && de.StatusCode == http.StatusNotFound {
+				err = MakeCalendar(ctx, httpClient, url, homeset, name, item.Calendar)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("calendar %s: %w", name, err))
+				continue
+			}
+		}
+		if item.Data == "" {
+			if err := trash.Remove(item.ID); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			restored++
+			continue
+		}
+		_, err := writeObject(ctx, httpClient, http.MethodPut, collectionURL(url, item.Path, ""), "", []byte(item.Data))
+		if isPrecondition(err) {
+			err = fmt.Errorf("object exists again, it is kept in trash")
+		}
+		if err == nil {
+			restored++
+			err = trash.Remove(item.ID)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", item.Path, err))
+		}
+	}
+	return restored, errors.Join(errs...)
+}
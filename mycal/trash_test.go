@@ -0,0 +1,133 @@
+package mycal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	webdav "github.com/trvita/caldav-client-yandex"
+)
+
+func TestDeleteObjects(t *testing.T) {
+	ctx := context.Background()
+	dav := newFakeDAV("work")
+	dav.put(syncHomeset+"work/a.ics", calendarData("a"))
+	dav.put(syncHomeset+"work/b.ics", calendarData("b"))
+	end := fakeEndpoint(t, dav)
+	trash := &Trash{Dir: t.TempDir()}
+
+	deleted, err := DeleteObjects(ctx, end.HTTPClient, end.URL, []string{syncHomeset + "work/a.ics", syncHomeset + "work/missing.ics"}, trash)
+	assert.Error(t, err)
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, "a", deleted[0].UID)
+	}
+	assert.Equal(t, []string{syncHomeset + "work/b.ics"}, dav.paths(syncHomeset))
+
+	deleted, err = DeleteObjects(ctx, end.HTTPClient, end.URL, []string{syncHomeset + "work/b.ics"}, trash)
+	assert.NoError(t, err)
+	items, err := trash.List()
+	assert.NoError(t, err)
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, "b", items[0].UID)
+	}
+
+	// undo brings back last deletion only
+	batch, err := trash.LastBatch()
+	assert.NoError(t, err)
+	if assert.Len(t, batch, 1) {
+		assert.Equal(t, deleted[0].ID, batch[0].ID)
+	}
+	n, err := RestoreItems(ctx, end.HTTPClient, end.URL, batch, trash)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, calendarData("b"), dav.objects[syncHomeset+"work/b.ics"])
+	items, _ = trash.List()
+	assert.Len(t, items, 1)
+
+	// path taken meanwhile, item stays in trash
+	dav.put(syncHomeset+"work/a.ics", calendarData("other"))
+	n, err = RestoreItems(ctx, end.HTTPClient, end.URL, items, trash)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, calendarData("other"), dav.objects[syncHomeset+"work/a.ics"])
+	items, _ = trash.List()
+	assert.Len(t, items, 1)
+
+	assert.NoError(t, trash.Empty())
+	items, _ = trash.List()
+	assert.Empty(t, items)
+}
+
+// changingClient lets object be changed by someone else right after it is read
+type changingClient struct {
+	webdav.HTTPClient
+	change func()
+}
+
+func (c changingClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if req.Method == http.MethodGet {
+		c.change()
+	}
+	return resp, err
+}
+
+func TestDeleteObjectsChanged(t *testing.T) {
+	dav := newFakeDAV("work")
+	dav.put(syncHomeset+"work/a.ics", calendarData("a"))
+	end := fakeEndpoint(t, dav)
+	trash := &Trash{Dir: t.TempDir()}
+	httpClient := changingClient{end.HTTPClient, func() {
+		dav.mu.Lock()
+		dav.put(syncHomeset+"work/a.ics", calendarData("a")+"\r\n")
+		dav.mu.Unlock()
+	}}
+
+	deleted, err := DeleteObjects(context.Background(), httpClient, end.URL, []string{syncHomeset + "work/a.ics"}, trash)
+	assert.True(t, errors.Is(err, ErrChanged))
+	assert.Empty(t, deleted)
+	assert.Contains(t, dav.objects, syncHomeset+"work/a.ics")
+	items, _ := trash.List()
+	assert.Empty(t, items)
+}
+
+func TestDeleteCalendar(t *testing.T) {
+	ctx := context.Background()
+	dav := newFakeDAV("work", "home")
+	dav.put(syncHomeset+"work/a.ics", calendarData("a"))
+	dav.put(syncHomeset+"work/b.ics", calendarData("b"))
+	end := fakeEndpoint(t, dav)
+	trash := &Trash{Dir: t.TempDir()}
+
+	items, err := DeleteCalendar(ctx, end.HTTPClient, end.Client, end.URL, end.Homeset, "work", trash)
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+	assert.NotContains(t, dav.calendars, syncHomeset+"work/")
+	assert.Empty(t, dav.objects)
+
+	batch, err := trash.LastBatch()
+	assert.NoError(t, err)
+	n, err := RestoreItems(ctx, end.HTTPClient, end.URL, batch, trash)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Contains(t, dav.calendars, syncHomeset+"work/")
+	assert.Len(t, dav.made, 1)
+	assert.Equal(t, []string{syncHomeset + "work/a.ics", syncHomeset + "work/b.ics"}, dav.paths(syncHomeset))
+
+	// empty calendar is brought back too, not objects deleted before it
+	_, err = DeleteObjects(ctx, end.HTTPClient, end.URL, []string{syncHomeset + "work/a.ics"}, trash)
+	assert.NoError(t, err)
+	items, err = DeleteCalendar(ctx, end.HTTPClient, end.Client, end.URL, end.Homeset, "home", trash)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	batch, err = trash.LastBatch()
+	assert.NoError(t, err)
+	assert.Equal(t, items[0].ID, batch[0].ID)
+	n, err = RestoreItems(ctx, end.HTTPClient, end.URL, batch, trash)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Contains(t, dav.calendars, syncHomeset+"home/")
+	assert.Equal(t, []string{syncHomeset + "work/b.ics"}, dav.paths(syncHomeset))
+}
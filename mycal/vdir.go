@@ -0,0 +1,470 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/caldav-client-yandex/caldav"
+	"github.com/trvita/go-ical"
+)
+
+// ConflictPolicy decides what happens to object changed both locally and on server
+type ConflictPolicy int
+
+const (
+	RemoteWins ConflictPolicy = iota
+	LocalWins
+	KeepBoth
+	Prompt
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch s {
+	case "remote":
+		return RemoteWins, nil
+	case "local":
+		return LocalWins, nil
+	case "both":
+		return KeepBoth, nil
+	case "prompt":
+		return Prompt, nil
+	}
+	return RemoteWins, fmt.Errorf("unknown conflict policy %s", s)
+}
+
+// VdirItem is what was known about object after last sync
+type VdirItem struct {
+	Href string
+	ETag string
+	Hash string // sha1 of local file
+}
+
+// VdirStatus keeps state of synced calendars: calendar dir -> file name -> item
+type VdirStatus struct {
+	Path      string
+	Calendars map[string]map[string]*VdirItem
+}
+
+// VdirConflict describes object changed on both sides, nil data means it was deleted there
+type VdirConflict struct {
+	Calendar string
+	File     string
+	Local    *ical.Calendar
+	Remote   *ical.Calendar
+}
+
+type VdirOptions struct {
+	Policy ConflictPolicy
+	// Resolve is asked when Policy is Prompt and returns one of other policies
+	Resolve func(c *VdirConflict) ConflictPolicy
+}
+
+type VdirReport struct {
+	Downloaded    []string
+	Uploaded      []string
+	DeletedLocal  []string
+	DeletedRemote []string
+	Conflicts     []string
+}
+
+func LoadVdirStatus(dir string) (*VdirStatus, error) {
+	status := &VdirStatus{Path: filepath.Join(dir, ".status.json"), Calendars: make(map[string]map[string]*VdirItem)}
+	data, err := os.ReadFile(status.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &status.Calendars); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (status *VdirStatus) Save() error {
+	data, err := json.MarshalIndent(status.Calendars, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(status.Path, data, 0o600)
+}
+
+func hashData(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isVdirItem tells files of objects from metadata and other files, the same rule
+// is used for names of remote objects, so nothing is synced one way only
+func isVdirItem(name string) bool {
+	return strings.HasSuffix(name, ".ics") && !strings.HasPrefix(name, ".")
+}
+
+// readVdir returns hashes of .ics files in calendar directory
+func readVdir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !isVdirItem(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = hashData(data)
+	}
+	return files, nil
+}
+
+// SyncVdir mirrors calendars of homeset to dir in vdir layout: one directory per
+// calendar with one .ics file per object. Changes made on either side since
+// last run are propagated, deletions included. Empty names mean every calendar.
+func SyncVdir(ctx context.Context, httpClient webdav.HTTPClient, client *caldav.Client, url, homeset, dir string, names []string, opts VdirOptions) (*VdirReport, error) {
+	status, err := LoadVdirStatus(dir)
+	if err != nil {
+		return nil, err
+	}
+	calendars, err := client.FindCalendars(ctx, homeset)
+	if err != nil {
+		return nil, err
+	}
+	report := &VdirReport{}
+	for _, calendar := range calendars {
+		name := path.Base(strings.TrimSuffix(calendar.Path, "/"))
+		if len(names) > 0 && !contains(names, name) && !contains(names, calendar.Name) {
+			continue
+		}
+		s := &vdirSync{
+			ctx:        ctx,
+			httpClient: httpClient,
+			client:     client,
+			url:        url,
+			calendar:   calendar,
+			dir:        filepath.Join(dir, name),
+			name:       name,
+			opts:       opts,
+			report:     report,
+		}
+		if status.Calendars[name] == nil {
+			status.Calendars[name] = make(map[string]*VdirItem)
+		}
+		s.items = status.Calendars[name]
+		err := s.run()
+		// keep what was done so far, next run continues from there
+		if saveErr := status.Save(); err == nil {
+			err = saveErr
+		}
+		if err != nil {
+			return report, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return report, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+type vdirSync struct {
+	ctx        context.Context
+	httpClient webdav.HTTPClient
+	client     *caldav.Client
+	url        string
+	calendar   caldav.Calendar
+	dir        string
+	name       string
+	opts       VdirOptions
+	report     *VdirReport
+	items      map[string]*VdirItem
+	remote     map[string]string // file name -> ETag
+}
+
+func (s *vdirSync) run() error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+	if s.calendar.Name != "" {
+		if err := os.WriteFile(filepath.Join(s.dir, "displayname"), []byte(s.calendar.Name), 0o600); err != nil {
+			return err
+		}
+	}
+	local, err := readVdir(s.dir)
+	if err != nil {
+		return err
+	}
+	etags, err := listETags(s.ctx, s.httpClient, collectionURL(s.url, s.calendar.Path, ""))
+	if err != nil {
+		return err
+	}
+	s.remote = make(map[string]string)
+	for href, etag := range etags {
+		// objects that can't be files of vdir are left alone on server
+		if file := path.Base(href); isVdirItem(file) {
+			s.remote[file] = etag
+		}
+	}
+
+	files := make(map[string]bool)
+	for file := range local {
+		files[file] = true
+	}
+	for file := range s.remote {
+		files[file] = true
+	}
+	for file := range s.items {
+		files[file] = true
+	}
+	sorted := make([]string, 0, len(files))
+	for file := range files {
+		sorted = append(sorted, file)
+	}
+	sort.Strings(sorted)
+
+	for _, file := range sorted {
+		item := s.items[file]
+		hash, inLocal := local[file]
+		etag, inRemote := s.remote[file]
+		if item == nil {
+			switch {
+			case inLocal && inRemote:
+				err = s.adoptOrConflict(file, hash, etag)
+			case inRemote:
+				err = s.download(file)
+			default:
+				err = s.upload(file, "")
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		localChanged := !inLocal || hash != item.Hash
+		remoteChanged := !inRemote || etag != item.ETag
+		switch {
+		case !inLocal && !inRemote:
+			delete(s.items, file)
+		case !localChanged && !remoteChanged:
+		case !remoteChanged:
+			if inLocal {
+				err = s.upload(file, item.ETag)
+			} else {
+				err = s.deleteRemote(file, item.ETag)
+			}
+		case !localChanged:
+			if inRemote {
+				err = s.download(file)
+			} else {
+				err = s.deleteLocal(file)
+			}
+		default:
+			err = s.conflict(file, inLocal, inRemote)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *vdirSync) href(file string) string {
+	return s.calendar.Path + file
+}
+
+// objectURL is absolute url of file, hrefs are decoded, so file name is escaped again
+func (s *vdirSync) objectURL(file string) string {
+	return collectionURL(s.url, (&neturl.URL{Path: s.href(file)}).EscapedPath(), "")
+}
+
+// adoptOrConflict handles file found on both sides at first sync: the same data on
+// both sides is taken as synced, different data is a conflict
+func (s *vdirSync) adoptOrConflict(file, hash, etag string) error {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, s.objectURL(file), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return &davError{StatusCode: resp.StatusCode, Body: buf.String()}
+	}
+	if hashData(buf.Bytes()) != hash {
+		return s.conflict(file, true, true)
+	}
+	if got := unquoteETag(resp.Header.Get("ETag")); got != "" {
+		etag = got
+	}
+	s.items[file] = &VdirItem{Href: s.href(file), ETag: etag, Hash: hash}
+	return nil
+}
+
+func (s *vdirSync) download(file string) error {
+	obj, err := s.client.GetCalendarObject(s.ctx, s.href(file))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(obj.Data); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, file), buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	etag := unquoteETag(obj.ETag)
+	if etag == "" {
+		etag = s.remote[file]
+	}
+	s.items[file] = &VdirItem{Href: s.href(file), ETag: etag, Hash: hashData(buf.Bytes())}
+	s.report.Downloaded = append(s.report.Downloaded, s.name+"/"+file)
+	return nil
+}
+
+// upload puts local file to server, etag is what server had at last sync
+func (s *vdirSync) upload(file, etag string) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, file))
+	if err != nil {
+		return err
+	}
+	if _, err := ical.NewDecoder(bytes.NewReader(data)).Decode(); err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	newETag, err := writeObject(s.ctx, s.httpClient, http.MethodPut, s.objectURL(file), etag, data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	if newETag == "" {
+		obj, err := s.client.GetCalendarObject(s.ctx, s.href(file))
+		if err != nil {
+			return err
+		}
+		newETag = unquoteETag(obj.ETag)
+	}
+	s.items[file] = &VdirItem{Href: s.href(file), ETag: newETag, Hash: hashData(data)}
+	s.report.Uploaded = append(s.report.Uploaded, s.name+"/"+file)
+	return nil
+}
+
+func (s *vdirSync) deleteRemote(file, etag string) error {
+	_, err := writeObject(s.ctx, s.httpClient, http.MethodDelete, s.objectURL(file), etag, nil)
+	var de *davError
+	if err != nil && !(errors.As(err, &de) && de.StatusCode == http.StatusNotFound) {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	delete(s.items, file)
+	s.report.DeletedRemote = append(s.report.DeletedRemote, s.name+"/"+file)
+	return nil
+}
+
+func (s *vdirSync) deleteLocal(file string) error {
+	err := os.Remove(filepath.Join(s.dir, file))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(s.items, file)
+	s.report.DeletedLocal = append(s.report.DeletedLocal, s.name+"/"+file)
+	return nil
+}
+
+func (s *vdirSync) conflict(file string, inLocal, inRemote bool) error {
+	policy := s.opts.Policy
+	if policy == Prompt {
+		c := &VdirConflict{Calendar: s.name, File: file}
+		if inLocal {
+			f, err := os.Open(filepath.Join(s.dir, file))
+			if err != nil {
+				return err
+			}
+			c.Local, err = ical.NewDecoder(f).Decode()
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+		}
+		if inRemote {
+			obj, err := s.client.GetCalendarObject(s.ctx, s.href(file))
+			if err != nil {
+				return err
+			}
+			c.Remote = obj.Data
+		}
+		policy = RemoteWins
+		if s.opts.Resolve != nil {
+			policy = s.opts.Resolve(c)
+		}
+	}
+	s.report.Conflicts = append(s.report.Conflicts, s.name+"/"+file)
+
+	switch {
+	case policy == LocalWins && inLocal:
+		return s.upload(file, s.remote[file])
+	case policy == LocalWins:
+		return s.deleteRemote(file, s.remote[file])
+	case policy == KeepBoth && inLocal && inRemote:
+		if err := s.keepLocalCopy(file); err != nil {
+			return err
+		}
+		return s.download(file)
+	case policy == KeepBoth && inLocal:
+		return s.upload(file, "")
+	case inRemote:
+		return s.download(file)
+	default:
+		return s.deleteLocal(file)
+	}
+}
+
+// keepLocalCopy saves local version of file under new UID and uploads it
+func (s *vdirSync) keepLocalCopy(file string) error {
+	f, err := os.Open(filepath.Join(s.dir, file))
+	if err != nil {
+		return err
+	}
+	cal, err := ical.NewDecoder(f).Decode()
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	uid := uuid.New().String()
+	for _, comp := range cal.Children {
+		if comp.Name != ical.CompTimezone {
+			comp.Props.SetText(ical.PropUID, uid)
+		}
+	}
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, uid+".ics"), buf.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return s.upload(uid+".ics", "")
+}
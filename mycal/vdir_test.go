@@ -0,0 +1,277 @@
+package mycal
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/caldav-client-yandex/caldav"
+)
+
+// fakeDAV is in-memory CalDAV server with calendars, GET, PUT and DELETE of objects
+type fakeDAV struct {
+	mu        sync.Mutex
+	calendars map[string]string // path -> display name
+	objects   map[string]string // path -> data
+	etags     map[string]string
+	version   int
+	made      []string // bodies of MKCALENDAR requests
+	copies    bool     // COPY and MOVE are answered, not rejected
+}
+
+func newFakeDAV(calendars ...string) *fakeDAV {
+	dav := &fakeDAV{calendars: make(map[string]string), objects: make(map[string]string), etags: make(map[string]string)}
+	for _, name := range calendars {
+		dav.calendars[syncHomeset+name+"/"] = name
+	}
+	return dav
+}
+
+func (dav *fakeDAV) put(path, data string) {
+	dav.version++
+	dav.objects[path] = data
+	dav.etags[path] = strconv.Itoa(dav.version)
+}
+
+// escapeHref escapes path for href, like servers do
+func escapeHref(path string) string {
+	return html.EscapeString((&url.URL{Path: path}).EscapedPath())
+}
+
+// paths lists objects in collection
+func (dav *fakeDAV) paths(collection string) []string {
+	paths := make([]string, 0, len(dav.objects))
+	for obj := range dav.objects {
+		if strings.HasPrefix(obj, collection) {
+			paths = append(paths, obj)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (dav *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dav.mu.Lock()
+	defer dav.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	path := r.URL.Path
+	etag, exists := dav.etags[path]
+	if match := r.Header.Get("If-Match"); match != "" && (!exists || match != `"`+etag+`"`) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Header().Set("ETag", `"`+etag+`"`)
+		io.WriteString(w, dav.objects[path])
+	case http.MethodPut:
+		dav.put(path, string(body))
+		w.Header().Set("ETag", `"`+dav.etags[path]+`"`)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodDelete:
+		if _, isCalendar := dav.calendars[path]; isCalendar {
+			for _, obj := range dav.paths(path) {
+				delete(dav.objects, obj)
+				delete(dav.etags, obj)
+			}
+			delete(dav.calendars, path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(dav.objects, path)
+		delete(dav.etags, path)
+		w.WriteHeader(http.StatusNoContent)
+	case "REPORT":
+		// every query matches everything
+		var resp strings.Builder
+		resp.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+		for _, obj := range dav.paths(path) {
+			fmt.Fprintf(&resp, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>"%s"</d:getetag><c:calendar-data>%s</c:calendar-data></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, escapeHref(obj), dav.etags[obj], html.EscapeString(dav.objects[obj]))
+		}
+		resp.WriteString(`</d:multistatus>`)
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, resp.String())
+	case "PROPFIND":
+		var resp strings.Builder
+		resp.WriteString(`<?xml version="1.0"?><d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`)
+		_, isCalendar := dav.calendars[path]
+		switch {
+		case path == syncHomeset:
+			for calendar, name := range dav.calendars {
+				fmt.Fprintf(&resp, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype><d:collection/><c:calendar/></d:resourcetype><d:displayname>%s</d:displayname></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, calendar, name)
+			}
+		case r.Header.Get("Depth") == "0" && isCalendar:
+			fmt.Fprintf(&resp, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype><d:collection/><c:calendar/></d:resourcetype><d:displayname>%s</d:displayname></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, path, dav.calendars[path])
+		case r.Header.Get("Depth") == "0":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		default:
+			for _, obj := range dav.paths(path) {
+				fmt.Fprintf(&resp, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getetag>"%s"</d:getetag></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, escapeHref(obj), dav.etags[obj])
+			}
+		}
+		resp.WriteString(`</d:multistatus>`)
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, resp.String())
+	case "COPY", "MOVE":
+		dst, _ := url.Parse(r.Header.Get("Destination"))
+		if !dav.copies || !exists {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if _, taken := dav.etags[dst.Path]; taken && r.Header.Get("Overwrite") == "F" {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		dav.put(dst.Path, dav.objects[path])
+		if r.Method == "MOVE" {
+			delete(dav.objects, path)
+			delete(dav.etags, path)
+		}
+		w.WriteHeader(http.StatusCreated)
+	case "MKCALENDAR":
+		dav.calendars[path] = path
+		dav.made = append(dav.made, string(body))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func startFakeDAV(t *testing.T, dav *fakeDAV) (*httptest.Server, *caldav.Client) {
+	server := httptest.NewServer(dav)
+	t.Cleanup(server.Close)
+	return server, syncTestClient(t, server)
+}
+
+func TestSyncVdir(t *testing.T) {
+	dav := newFakeDAV("default")
+	dav.put(syncHomeset+"default/a.ics", calendarData("a"))
+	dav.put(syncHomeset+"default/b.ics", calendarData("b"))
+	server, client := startFakeDAV(t, dav)
+	ctx := context.Background()
+	dir := t.TempDir()
+	url := server.URL + "/dav.php"
+
+	report, err := SyncVdir(ctx, server.Client(), client, url, syncHomeset, dir, nil, VdirOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default/a.ics", "default/b.ics"}, report.Downloaded)
+	name, _ := os.ReadFile(filepath.Join(dir, "default", "displayname"))
+	assert.Equal(t, "default", string(name))
+
+	// local edit, local creation, remote deletion
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "default", "a.ics"), []byte(calendarData("a")+"\r\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "default", "c.ics"), []byte(calendarData("c")), 0o600))
+	delete(dav.objects, syncHomeset+"default/b.ics")
+	delete(dav.etags, syncHomeset+"default/b.ics")
+
+	report, err = SyncVdir(ctx, server.Client(), client, url, syncHomeset, dir, nil, VdirOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default/a.ics", "default/c.ics"}, report.Uploaded)
+	assert.Equal(t, []string{"default/b.ics"}, report.DeletedLocal)
+	assert.Contains(t, dav.objects, syncHomeset+"default/c.ics")
+	_, err = os.Stat(filepath.Join(dir, "default", "b.ics"))
+	assert.True(t, os.IsNotExist(err))
+
+	// nothing changed
+	report, err = SyncVdir(ctx, server.Client(), client, url, syncHomeset, dir, nil, VdirOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, &VdirReport{}, report)
+
+	// local deletion goes to server
+	assert.NoError(t, os.Remove(filepath.Join(dir, "default", "c.ics")))
+	report, err = SyncVdir(ctx, server.Client(), client, url, syncHomeset, dir, nil, VdirOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default/c.ics"}, report.DeletedRemote)
+	assert.NotContains(t, dav.objects, syncHomeset+"default/c.ics")
+}
+
+func TestSyncVdirNames(t *testing.T) {
+	dav := newFakeDAV("default")
+	dav.put(syncHomeset+"default/no-suffix", calendarData("x"))
+	dav.put(syncHomeset+"default/a b.ics", calendarData("a"))
+	dav.put(syncHomeset+"default/same.ics", calendarData("s"))
+	server, client := startFakeDAV(t, dav)
+	ctx := context.Background()
+	dir := t.TempDir()
+	url := server.URL + "/dav.php"
+	// the same object is on both sides before first sync
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "default"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "default", "same.ics"), []byte(calendarData("s")), 0o600))
+
+	report, err := SyncVdir(ctx, server.Client(), client, url, syncHomeset, dir, nil, VdirOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default/a b.ics"}, report.Downloaded)
+	assert.Empty(t, report.Conflicts)
+
+	// object that is no vdir file stays on server after second sync
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "default", "a b.ics"), []byte(calendarData("a")+"\r\n"), 0o600))
+	report, err = SyncVdir(ctx, server.Client(), client, url, syncHomeset, dir, nil, VdirOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, report.DeletedRemote)
+	assert.Equal(t, []string{"default/a b.ics"}, report.Uploaded)
+	assert.Contains(t, dav.objects, syncHomeset+"default/no-suffix")
+	assert.Equal(t, calendarData("a")+"\r\n", dav.objects[syncHomeset+"default/a b.ics"])
+	assert.Equal(t, 3, len(dav.objects))
+}
+
+func TestSyncVdirConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		policy    ConflictPolicy
+		localData bool
+		files     int
+	}{
+		{policy: RemoteWins, localData: false, files: 2},
+		{policy: LocalWins, localData: true, files: 2},
+		{policy: KeepBoth, localData: false, files: 3},
+	} {
+		dav := newFakeDAV("default")
+		dav.put(syncHomeset+"default/a.ics", calendarData("a"))
+		server, client := startFakeDAV(t, dav)
+		ctx := context.Background()
+		dir := t.TempDir()
+		url := server.URL + "/dav.php"
+
+		_, err := SyncVdir(ctx, server.Client(), client, url, syncHomeset, dir, nil, VdirOptions{})
+		assert.NoError(t, err)
+		local := strings.Replace(calendarData("a"), "DTSTART:20240701T090000Z", "DTSTART:20240702T090000Z", 1)
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "default", "a.ics"), []byte(local), 0o600))
+		dav.put(syncHomeset+"default/a.ics", strings.Replace(calendarData("a"), "DTSTART:20240701T090000Z", "DTSTART:20240703T090000Z", 1))
+
+		report, err := SyncVdir(ctx, server.Client(), client, url, syncHomeset, dir, nil, VdirOptions{Policy: tc.policy})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"default/a.ics"}, report.Conflicts)
+		assert.Equal(t, tc.localData, strings.Contains(dav.objects[syncHomeset+"default/a.ics"], "20240702"))
+		data, _ := os.ReadFile(filepath.Join(dir, "default", "a.ics"))
+		assert.Equal(t, tc.localData, strings.Contains(string(data), "20240702"))
+		entries, _ := os.ReadDir(filepath.Join(dir, "default"))
+		assert.Equal(t, tc.files, len(entries), "policy %v", tc.policy)
+	}
+}
@@ -0,0 +1,149 @@
+package mycal
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	webdav "github.com/trvita/caldav-client-yandex"
+	"github.com/trvita/go-ical"
+)
+
+type multistatus struct {
+	XMLName   xml.Name      `xml:"DAV: multistatus"`
+	Responses []davResponse `xml:"DAV: response"`
+	SyncToken string        `xml:"DAV: sync-token"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"DAV: href"`
+	Status    string        `xml:"DAV: status"`
+	Propstats []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Status string  `xml:"DAV: status"`
+	Prop   davProp `xml:"DAV: prop"`
+}
+
+type davProp struct {
+	ETag         string `xml:"DAV: getetag"`
+	CTag         string `xml:"http://calendarserver.org/ns/ getctag"`
+	SyncToken    string `xml:"DAV: sync-token"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+
+	ResourceType struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	DisplayName string `xml:"DAV: displayname"`
+	Description string `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+	Timezone    string `xml:"urn:ietf:params:xml:ns:caldav calendar-timezone"`
+	Color       string `xml:"http://apple.com/ns/ical/ calendar-color"`
+	Order       string `xml:"http://apple.com/ns/ical/ calendar-order"`
+	Components  []struct {
+		Name string `xml:"name,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set>comp"`
+}
+
+// statusCode returns code of status line like "HTTP/1.1 404 Not Found"
+func statusCode(status string) int {
+	var code int
+	fields := strings.Fields(status)
+	if len(fields) >= 2 {
+		fmt.Sscanf(fields[1], "%d", &code)
+	}
+	return code
+}
+
+// prop returns properties from successful propstat of response
+func (resp *davResponse) prop() davProp {
+	for _, ps := range resp.Propstats {
+		if code := statusCode(ps.Status); code >= 200 && code < 300 {
+			return ps.Prop
+		}
+	}
+	return davProp{}
+}
+
+// path returns decoded path of href, hosts are dropped from absolute hrefs
+func (resp *davResponse) path() string {
+	href := strings.TrimSpace(resp.Href)
+	if u, err := url.Parse(href); err == nil {
+		return u.Path
+	}
+	return href
+}
+
+func unquoteETag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), "\"")
+}
+
+// davError is returned when server answers with something else than 207 Multi-Status
+type davError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *davError) Error() string {
+	return fmt.Sprintf("unexpected status code: %v", e.StatusCode)
+}
+
+// davRequest sends WebDAV request with XML body and decodes multistatus answer
+func davRequest(ctx context.Context, httpClient webdav.HTTPClient, method, url, depth, body string) (*multistatus, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=\"utf-8\"")
+	if depth != "" {
+		req.Header.Set("Depth", depth)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return nil, &davError{StatusCode: resp.StatusCode, Body: buf.String()}
+	}
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, err
+	}
+	return &ms, nil
+}
+
+// writeObject sends PUT or DELETE of calendar object guarded by ETag: If-Match
+// when etag is set, If-None-Match for new objects. Failed preconditions come back
+// as davError with 412. Returned ETag is empty when server doesn't send one.
+func writeObject(ctx context.Context, httpClient webdav.HTTPClient, method, url, etag string, data []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", ical.MIMEType)
+	}
+	if etag != "" {
+		req.Header.Set("If-Match", `"`+etag+`"`)
+	} else if method == http.MethodPut {
+		req.Header.Set("If-None-Match", "*")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return "", &davError{StatusCode: resp.StatusCode, Body: buf.String()}
+	}
+	return unquoteETag(resp.Header.Get("ETag")), nil
+}
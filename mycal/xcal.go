@@ -0,0 +1,286 @@
+package mycal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/trvita/go-ical"
+)
+
+// xCal (RFC 6321) is iCalendar as XML, values are written the same way as in jCal
+
+const XCalNamespace = "urn:ietf:params:xml:ns:icalendar-2.0"
+
+// xnode is any XML element
+type xnode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Content  string     `xml:",chardata"`
+	Children []xnode    `xml:",any"`
+}
+
+func xelem(name string, children ...xnode) xnode {
+	return xnode{XMLName: xml.Name{Local: name}, Children: children}
+}
+
+func xtext(name, content string) xnode {
+	return xnode{XMLName: xml.Name{Local: name}, Content: content}
+}
+
+func (n *xnode) child(name string) *xnode {
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == name {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+// order of recur parts in RFC 6321 schema
+var recurParts = []string{"freq", "until", "count", "interval", "bysecond", "byminute", "byhour", "byday",
+	"bymonthday", "byyearday", "byweekno", "bymonth", "bysetpos", "wkst"}
+
+// parameters with other value type than text
+var paramTypes = map[string]string{
+	ical.ParamDelegatedTo:   "cal-address",
+	ical.ParamDelegatedFrom: "cal-address",
+	ical.ParamMember:        "cal-address",
+	ical.ParamSentBy:        "cal-address",
+	ical.ParamAltRep:        "uri",
+	ical.ParamDir:           "uri",
+}
+
+// EncodeXCal writes calendars as one xCal document
+func EncodeXCal(w io.Writer, cals ...*ical.Calendar) error {
+	root := xelem("icalendar")
+	root.Attrs = []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: XCalNamespace}}
+	for _, cal := range cals {
+		root.Children = append(root.Children, xcalComponent(cal.Component))
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func xcalComponent(comp *ical.Component) xnode {
+	node := xelem(strings.ToLower(comp.Name))
+	names := make([]string, 0, len(comp.Props))
+	for name := range comp.Props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		props := xelem("properties")
+		for _, name := range names {
+			for _, prop := range comp.Props[name] {
+				props.Children = append(props.Children, xcalProp(&prop))
+			}
+		}
+		node.Children = append(node.Children, props)
+	}
+	if len(comp.Children) > 0 {
+		children := xelem("components")
+		for _, child := range comp.Children {
+			children.Children = append(children.Children, xcalComponent(child))
+		}
+		node.Children = append(node.Children, children)
+	}
+	return node
+}
+
+func xcalProp(prop *ical.Prop) xnode {
+	node := xelem(strings.ToLower(prop.Name))
+	var paramNames []string
+	for name := range prop.Params {
+		if name != ical.ParamValue {
+			paramNames = append(paramNames, name)
+		}
+	}
+	sort.Strings(paramNames)
+	if len(paramNames) > 0 {
+		params := xelem("parameters")
+		for _, name := range paramNames {
+			param := xelem(strings.ToLower(name))
+			typeName, ok := paramTypes[name]
+			if !ok {
+				typeName = "text"
+			}
+			for _, value := range prop.Params[name] {
+				param.Children = append(param.Children, xtext(typeName, value))
+			}
+			params.Children = append(params.Children, param)
+		}
+		node.Children = append(node.Children, params)
+	}
+
+	t, values := propValues(prop)
+	typeName := strings.ToLower(string(t))
+	if t == ical.ValueDefault {
+		typeName = "unknown"
+	}
+	for _, value := range values {
+		node.Children = append(node.Children, xcalValue(typeName, value)...)
+	}
+	return node
+}
+
+func xcalScalar(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// xcalValue converts jCal value to elements, geo is latitude and longitude
+// right under property
+func xcalValue(typeName string, value interface{}) []xnode {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		recur := xelem("recur")
+		for _, part := range recurParts {
+			items, ok := v[part].([]interface{})
+			if !ok && v[part] != nil {
+				items = []interface{}{v[part]}
+			}
+			for _, item := range items {
+				recur.Children = append(recur.Children, xtext(part, xcalScalar(item)))
+			}
+		}
+		return []xnode{recur}
+	case []interface{}:
+		if typeName == "float" && len(v) == 2 {
+			return []xnode{xtext("latitude", xcalScalar(v[0])), xtext("longitude", xcalScalar(v[1]))}
+		}
+		if len(v) == 2 {
+			end := xcalScalar(v[1])
+			endName := "end"
+			if strings.Contains(end, "P") {
+				endName = "duration"
+			}
+			return []xnode{xelem("period", xtext("start", xcalScalar(v[0])), xtext(endName, end))}
+		}
+	}
+	return []xnode{xtext(typeName, xcalScalar(value))}
+}
+
+// DecodeXCal reads calendars of xCal document
+func DecodeXCal(r io.Reader) ([]*ical.Calendar, error) {
+	var root xnode
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	if root.XMLName.Local != "icalendar" {
+		return nil, fmt.Errorf("xcal: expected icalendar, got %s", root.XMLName.Local)
+	}
+	var cals []*ical.Calendar
+	for i := range root.Children {
+		comp, err := parseXCalComponent(&root.Children[i])
+		if err != nil {
+			return nil, err
+		}
+		if comp.Name != ical.CompCalendar {
+			return nil, fmt.Errorf("xcal: expected vcalendar, got %s", comp.Name)
+		}
+		cals = append(cals, &ical.Calendar{Component: comp})
+	}
+	return cals, nil
+}
+
+func parseXCalComponent(node *xnode) (*ical.Component, error) {
+	comp := ical.NewComponent(strings.ToUpper(node.XMLName.Local))
+	if props := node.child("properties"); props != nil {
+		for i := range props.Children {
+			prop, err := parseXCalProp(&props.Children[i])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", comp.Name, err)
+			}
+			comp.Props.Add(prop)
+		}
+	}
+	if children := node.child("components"); children != nil {
+		for i := range children.Children {
+			child, err := parseXCalComponent(&children.Children[i])
+			if err != nil {
+				return nil, err
+			}
+			comp.Children = append(comp.Children, child)
+		}
+	}
+	return comp, nil
+}
+
+func parseXCalProp(node *xnode) (*ical.Prop, error) {
+	prop := ical.NewProp(strings.ToUpper(node.XMLName.Local))
+	var values []interface{}
+	t := ical.ValueDefault
+	for _, child := range node.Children {
+		name := child.XMLName.Local
+		switch name {
+		case "parameters":
+			for _, param := range child.Children {
+				for _, value := range param.Children {
+					prop.Params.Add(strings.ToUpper(param.XMLName.Local), value.Content)
+				}
+			}
+			continue
+		case "recur":
+			t = ical.ValueRecurrence
+			recur := map[string]interface{}{}
+			for _, part := range child.Children {
+				key := part.XMLName.Local
+				switch existing := recur[key].(type) {
+				case nil:
+					recur[key] = part.Content
+				case []interface{}:
+					recur[key] = append(existing, part.Content)
+				default:
+					recur[key] = []interface{}{existing, part.Content}
+				}
+			}
+			values = append(values, recur)
+		case "period":
+			t = ical.ValuePeriod
+			start, end := child.child("start"), child.child("end")
+			if end == nil {
+				end = child.child("duration")
+			}
+			if start == nil || end == nil {
+				return nil, fmt.Errorf("xcal: period of %s needs start and end or duration", prop.Name)
+			}
+			values = append(values, []interface{}{start.Content, end.Content})
+		case "latitude":
+			t = ical.ValueFloat
+			lon := node.child("longitude")
+			if lon == nil {
+				return nil, fmt.Errorf("xcal: %s needs latitude and longitude", prop.Name)
+			}
+			values = append(values, []interface{}{child.Content, lon.Content})
+		case "longitude":
+			continue
+		case "unknown":
+			values = append(values, child.Content)
+		default:
+			t = ical.ValueType(strings.ToUpper(name))
+			values = append(values, child.Content)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("xcal: %s has no value", prop.Name)
+	}
+	setPropValues(prop, t, values)
+	return prop, nil
+}
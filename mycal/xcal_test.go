@@ -0,0 +1,70 @@
+package mycal
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/trvita/go-ical"
+)
+
+func TestEncodeXCal(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(jcalData)).Decode()
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeXCal(&buf, cal))
+	xcal := regexp.MustCompile(`>\s+<`).ReplaceAllString(buf.String(), "><")
+
+	for _, expected := range []string{
+		`<icalendar xmlns="urn:ietf:params:xml:ns:icalendar-2.0"><vcalendar><properties>`,
+		"<dtstart><parameters><tzid><text>Custom/Zone</text></tzid></parameters><date-time>2024-07-01T09:00:00</date-time></dtstart>",
+		"<dtend><date>2024-07-02</date></dtend>",
+		"<summary><text>Planning, weekly</text></summary>",
+		"<categories><text>work</text><text>planning</text></categories>",
+		"<recur><freq>WEEKLY</freq><until>2024-12-31T00:00:00Z</until><count>3</count><byday>MO</byday><byday>WE</byday></recur>",
+		"<geo><latitude>37.386013</latitude><longitude>-122.082932</longitude></geo>",
+		"<sequence><integer>2</integer></sequence>",
+		"<delegated-to><cal-address>mailto:a@example.com</cal-address><cal-address>mailto:b@example.com</cal-address></delegated-to>",
+		"<x-custom><unknown>anything</unknown></x-custom>",
+		"<tzoffsetto><utc-offset>-03:30</utc-offset></tzoffsetto>",
+		"</properties><components><valarm><properties><action><text>DISPLAY</text></action><trigger><duration>-PT15M</duration></trigger>",
+	} {
+		assert.Contains(t, xcal, expected)
+	}
+}
+
+func TestDecodeXCal(t *testing.T) {
+	cal, err := ical.NewDecoder(strings.NewReader(jcalData)).Decode()
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeXCal(&buf, cal, cal))
+
+	cals, err := ReadCalendars(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(cals))
+	decoded := cals[0]
+	for i, comp := range cal.Children {
+		for name, props := range comp.Props {
+			for j, prop := range props {
+				got := decoded.Children[i].Props[name][j]
+				if name == ical.PropRecurrenceRule {
+					assert.ElementsMatch(t, strings.Split(prop.Value, ";"), strings.Split(got.Value, ";"))
+					continue
+				}
+				assert.Equal(t, prop.Value, got.Value, name)
+				assert.Equal(t, prop.Params, got.Params, name)
+			}
+		}
+	}
+	assert.Equal(t, ical.CompAlarm, decoded.Children[1].Children[0].Name)
+
+	buf.Reset()
+	assert.NoError(t, ical.NewEncoder(&buf).Encode(decoded))
+
+	_, err = DecodeXCal(strings.NewReader(`<icalendar xmlns="urn:ietf:params:xml:ns:icalendar-2.0"><vevent/></icalendar>`))
+	assert.Error(t, err)
+	_, err = DecodeXCal(strings.NewReader(`<icalendar><vcalendar><properties><version/></properties></vcalendar></icalendar>`))
+	assert.Error(t, err)
+}